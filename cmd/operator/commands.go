@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// commandEnv is what the commands run with.
+type commandEnv struct {
+	logger   *logrus.Logger
+	cfg      *config.Config
+	notifier notification.Notifier
+}
+
+// commandOptions are the flags of the commands.
+type commandOptions struct {
+	output  string
+	region  string
+	project string
+	limit   int
+
+	// Used by the simulate command.
+	strategy string
+	service  string
+	start    string
+	end      string
+	interval time.Duration
+}
+
+// command is a command of the Release Manager, given after its flags.
+type command struct {
+	name string
+	args string
+	help string
+
+	// needsRegion is set if the -region flag is required.
+	needsRegion bool
+
+	run func(ctx context.Context, env commandEnv, opts commandOptions, args []string) error
+}
+
+var (
+	statusCommand = &command{
+		name: "status",
+		args: "[service]",
+		help: "describe the rollout of the targeted services, or of a single one",
+		run:  runStatus,
+	}
+	historyCommand = &command{
+		name: "history",
+		args: "<service>",
+		help: "list the decisions recorded for a service",
+		run:  runHistory,
+	}
+	simulateCommand = &command{
+		name: "simulate",
+		args: "[metrics file]",
+		help: "replay a strategy against recorded metrics, or against the metrics of a service in Cloud Monitoring",
+		run:  runSimulate,
+	}
+	validateConfigCommand = &command{
+		name: "validate-config",
+		help: "check the configuration and summarize its strategies",
+		run:  runValidateConfig,
+	}
+)
+
+// commands are all the commands, including one per manual action.
+var commands = append([]*command{statusCommand, historyCommand}, append(actionCommands(), simulateCommand, validateConfigCommand)...)
+
+// actionCommands returns a command for each manual action.
+func actionCommands() []*command {
+	help := map[rollout.Action]string{
+		rollout.PauseAction:    "keep the current traffic split until the rollout is resumed",
+		rollout.ResumeAction:   "resume a paused rollout",
+		rollout.AbortAction:    "send all the traffic to the stable revision and pause the rollout",
+		rollout.PromoteAction:  "make the candidate stable right away",
+		rollout.RollbackAction: "send all the traffic to the stable revision and mark the candidate as failed",
+		rollout.RetryAction:    "roll out the last failed candidate again",
+	}
+	var cmds []*command
+	for _, action := range rollout.Actions {
+		action := action
+		cmds = append(cmds, &command{
+			name:        string(action),
+			args:        "<service>",
+			help:        help[action],
+			needsRegion: true,
+			run: func(ctx context.Context, env commandEnv, opts commandOptions, args []string) error {
+				return runAction(ctx, env, opts, args, action)
+			},
+		})
+	}
+	return cmds
+}
+
+// findCommand returns the command with the name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// usage prints the usage of the flags and commands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command [command flags] [args]]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command, rollouts are run by the server, or in a loop with -cli.")
+	fmt.Fprintln(out, "\nCommands:")
+	w := newTableWriter(out)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runCommand parses the arguments of the command and runs it. It returns the
+// exit code of the process.
+func runCommand(ctx context.Context, cmd *command, env commandEnv, args []string) int {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	var opts commandOptions
+	fs.StringVar(&opts.output, "o", tableOutput, fmt.Sprintf("output format, one of %v", outputFormats))
+	fs.StringVar(&opts.region, "region", "", "the region of the service")
+	fs.StringVar(&opts.project, "project", "", "the project of the service, if the strategies target more than one")
+	if cmd == historyCommand {
+		fs.IntVar(&opts.limit, "limit", 20, "maximum number of decisions to list, the latest ones (set 0 for all)")
+	}
+	if cmd == simulateCommand {
+		fs.StringVar(&opts.strategy, "strategy", "", "name of the strategy to simulate, required if the configuration has more than one")
+		fs.StringVar(&opts.service, "service", "", "service whose metrics are queried from Cloud Monitoring, if no metrics file is given")
+		fs.StringVar(&opts.start, "start", "", "start of the simulation (RFC3339), defaults to the first sample of the metrics file")
+		fs.StringVar(&opts.end, "end", "", "end of the simulation (RFC3339), defaults to the last sample of the metrics file")
+		fs.DurationVar(&opts.interval, "interval", time.Minute, "time between rollout passes")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] %s [command flags] %s\n\n%s.\n\nCommand flags:\n", os.Args[0], cmd.name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+
+	args, err := parseInterspersed(fs, args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if !isOutputFormat(opts.output) {
+		fmt.Fprintf(fs.Output(), "unknown output format %q, must be one of %v\n", opts.output, outputFormats)
+		return 2
+	}
+	if cmd.needsRegion && opts.region == "" {
+		fmt.Fprintf(fs.Output(), "-region must be specified\n")
+		fs.Usage()
+		return 2
+	}
+
+	if err := cmd.run(ctx, env, opts, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses the flags of the arguments, which may come before
+// or after the positional arguments, and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// singleService returns the service name of the arguments of a command that
+// expects exactly one.
+func singleService(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.Errorf("expected a service name, got %d arguments", len(args))
+	}
+	return args[0], nil
+}
+
+// runStatus describes the rollout of the targeted services. With a service
+// name, it only describes that service, in more detail.
+func runStatus(ctx context.Context, env commandEnv, opts commandOptions, args []string) error {
+	if len(args) > 1 {
+		return errors.Errorf("expected at most a service name, got %d arguments", len(args))
+	}
+	var service string
+	if len(args) == 1 {
+		service = args[0]
+	}
+
+	all, errs := getStatuses(ctx, env.logger, env.cfg)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+	var statuses []rollout.Status
+	for _, status := range all {
+		if (service == "" || status.Service == service) &&
+			(opts.region == "" || status.Region == opts.region) &&
+			(opts.project == "" || status.Project == opts.project) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	if service == "" {
+		resp := statusResponse{Services: statuses, Errors: errs}
+		if resp.Services == nil {
+			resp.Services = []rollout.Status{}
+		}
+		return writeOutput(os.Stdout, opts.output, resp, func(w io.Writer) {
+			writeStatusTable(w, statuses)
+		})
+	}
+	switch len(statuses) {
+	case 0:
+		return errors.Errorf("service %q is not targeted by any strategy", service)
+	case 1:
+		return writeOutput(os.Stdout, opts.output, statuses[0], func(w io.Writer) {
+			writeStatusDetails(w, statuses[0])
+		})
+	default:
+		fmt.Fprintf(os.Stderr, "warning: %d services named %q, use -region and -project to select one\n", len(statuses), service)
+		return writeOutput(os.Stdout, opts.output, statuses, func(w io.Writer) {
+			writeStatusTable(w, statuses)
+		})
+	}
+}
+
+// writeStatusTable writes a line for each service.
+func writeStatusTable(w io.Writer, statuses []rollout.Status) {
+	fmt.Fprintln(w, "SERVICE\tREGION\tPROJECT\tSTRATEGY\tSTATE\tSTABLE\tCANDIDATE\tPERCENT\tNEXT STEP\tREASON")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d%%\t%s\t%s\n", s.Service, s.Region, s.Project, s.Strategy, s.State,
+			orDash(s.StableRevision), orDash(s.CandidateRevision), s.CandidatePercent, nextStepString(s), orDash(reasonCode(s.Reason)))
+	}
+}
+
+// writeStatusDetails writes all the details of the rollout of a service.
+func writeStatusDetails(w io.Writer, s rollout.Status) {
+	fmt.Fprintf(w, "Service:\t%s\n", s.Service)
+	fmt.Fprintf(w, "Region:\t%s\n", s.Region)
+	fmt.Fprintf(w, "Project:\t%s\n", s.Project)
+	fmt.Fprintf(w, "Strategy:\t%s\n", s.Strategy)
+	fmt.Fprintf(w, "State:\t%s\n", s.State)
+	fmt.Fprintf(w, "Stable:\t%s\n", orDash(s.StableRevision))
+	if s.CandidateRevision != "" {
+		fmt.Fprintf(w, "Candidate:\t%s (%d%%)\n", s.CandidateRevision, s.CandidatePercent)
+	} else {
+		fmt.Fprintf(w, "Candidate:\t-\n")
+	}
+	fmt.Fprintf(w, "Next step:\t%s\n", nextStepString(s))
+	if s.Reason != nil {
+		fmt.Fprintf(w, "Reason:\t%s (%s)\n", s.Reason.Message, s.Reason.Code)
+		if s.Reason.Hint != "" {
+			fmt.Fprintf(w, "Hint:\t%s\n", s.Reason.Hint)
+		}
+	}
+	fmt.Fprintf(w, "Last rollout:\t%s\n", orDash(s.LastRollout))
+	fmt.Fprintf(w, "Last event:\t%s\n", orDash(s.LastEvent))
+	if s.LastFailedCandidateRevision != "" {
+		fmt.Fprintf(w, "Last failed candidate:\t%s\n", s.LastFailedCandidateRevision)
+	}
+	if s.LastFailedUpdate != "" {
+		fmt.Fprintf(w, "Last failed update:\t%s\n", s.LastFailedUpdate)
+	}
+
+	fmt.Fprintln(w, "\nTraffic:")
+	for _, target := range s.Traffic {
+		revision := target.Revision
+		if target.LatestRevision {
+			revision = "(latest)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d%%\n", revision, orDash(target.Tag), target.Percent)
+	}
+	if s.LastDiagnosis != nil {
+		fmt.Fprintf(w, "\nLast diagnosis:\t%s\n", s.LastDiagnosis.Result)
+		for _, check := range s.LastDiagnosis.Checks {
+			fmt.Fprintf(w, "  %s\t%s\n", checkName(check.Metric, check.Percentile), checkString(check.ActualValue, check.Threshold, check.Met))
+		}
+	}
+	if s.LastHealthReport != "" {
+		fmt.Fprintln(w, "\nLast health report:")
+		writeIndented(w, "  ", s.LastHealthReport)
+	}
+	if len(s.Errors) != 0 {
+		fmt.Fprintln(w, "\nErrors:")
+		for _, err := range s.Errors {
+			fmt.Fprintf(w, "  %s\n", err)
+		}
+	}
+}
+
+// nextStepString describes the next step of the candidate.
+func nextStepString(s rollout.Status) string {
+	if s.Paused != "" {
+		return "paused, " + s.Paused
+	}
+	if s.NextStep == nil {
+		return "-"
+	}
+	step := fmt.Sprintf("%d%%", s.NextStep.Percent)
+	if s.NextStep.Promotion {
+		step = "promotion"
+	}
+	switch s.NextStep.EligibleIn {
+	case "":
+		return step
+	case "0s":
+		return step + " at next pass"
+	default:
+		return step + " in " + s.NextStep.EligibleIn
+	}
+}
+
+// checkName returns the name of a health criterion.
+func checkName(metric config.MetricsCheck, percentile float64) string {
+	if metric == config.LatencyMetricsCheck {
+		return fmt.Sprintf("%s[p%.0f]", metric, percentile)
+	}
+	return string(metric)
+}
+
+// checkString describes the result of a health criterion check.
+func checkString(value, threshold float64, met bool) string {
+	result := "met"
+	if !met {
+		result = "not met"
+	}
+	return fmt.Sprintf("%.2f (needs %.2f, %s)", value, threshold, result)
+}
+
+// runHistory lists the decisions recorded for a service.
+func runHistory(ctx context.Context, env commandEnv, opts commandOptions, args []string) error {
+	service, err := singleService(args)
+	if err != nil {
+		return err
+	}
+	if historyStore == nil {
+		return errors.New("history is not configured, add a history object to the config file")
+	}
+	records, err := historyStore.List(ctx, history.Filter{
+		Project: opts.project,
+		Region:  opts.region,
+		Service: service,
+		Limit:   opts.limit,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list decisions")
+	}
+	if records == nil {
+		records = []history.Record{}
+	}
+
+	return writeOutput(os.Stdout, opts.output, records, func(w io.Writer) {
+		fmt.Fprintln(w, "TIME\tREGION\tACTOR\tACTION\tCANDIDATE\tTRAFFIC\tDIAGNOSIS\tERROR")
+		for _, r := range records {
+			diagnosis := "-"
+			if r.Diagnosis != nil {
+				var unmet []string
+				for _, check := range r.Diagnosis.Checks {
+					if !check.Met {
+						unmet = append(unmet, checkName(check.Metric, check.Percentile))
+					}
+				}
+				diagnosis = r.Diagnosis.Result
+				if len(unmet) != 0 {
+					diagnosis += " (" + strings.Join(unmet, ", ") + ")"
+				}
+			}
+			traffic := fmt.Sprintf("%d%% -> %d%%", trafficPercent(r.TrafficBefore, r.CandidateRevision), trafficPercent(r.TrafficAfter, r.CandidateRevision))
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format(time.RFC3339), r.Region, r.Actor, r.Action,
+				orDash(r.CandidateRevision), traffic, diagnosis, orDash(r.Error))
+		}
+	})
+}
+
+// trafficPercent returns the share of traffic of the revision.
+func trafficPercent(traffic []history.Traffic, revision string) int64 {
+	var percent int64
+	for _, t := range traffic {
+		if revision != "" && t.RevisionName == revision {
+			percent += t.Percent
+		}
+	}
+	return percent
+}
+
+// runAction applies a manual action on the rollout of a service.
+func runAction(ctx context.Context, env commandEnv, opts commandOptions, args []string, action rollout.Action) error {
+	service, err := singleService(args)
+	if err != nil {
+		return err
+	}
+	svc, strategy, err := findTargetedService(ctx, env.logger, env.cfg, opts.project, opts.region, service)
+	if err != nil {
+		return err
+	}
+	if svc == nil {
+		return errors.Errorf("service %q is not targeted in region %q", service, opts.region)
+	}
+
+	resp, err := applyAction(ctx, env.logger, svc, strategy, action, env.notifier)
+	if err != nil {
+		return err
+	}
+	return writeOutput(os.Stdout, opts.output, resp, func(w io.Writer) {
+		changed := "traffic unchanged"
+		if resp.TrafficChanged {
+			changed = "traffic changed"
+		}
+		fmt.Fprintf(w, "Applied %s to %s in %s, %s.\n\n", action, service, opts.region, changed)
+		writeStatusDetails(w, resp.Status)
+	})
+}
+
+// runValidateConfig checks the configuration, which is not validated before
+// this command runs, and summarizes its strategies.
+func runValidateConfig(ctx context.Context, env commandEnv, opts commandOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Errorf("expected no arguments, got %d", len(args))
+	}
+	if err := env.cfg.Validate(); err != nil {
+		return errors.Wrap(err, "invalid rollout configuration")
+	}
+
+	type strategySummary struct {
+		Name           string                   `json:"name"`
+		Target         config.Target            `json:"target"`
+		Steps          []int64                  `json:"steps"`
+		HealthCriteria []config.HealthCriterion `json:"healthCriteria"`
+	}
+	var summary []strategySummary
+	for _, strategy := range env.cfg.Strategies {
+		summary = append(summary, strategySummary{
+			Name:           strategy.DisplayName(),
+			Target:         strategy.Target,
+			Steps:          strategy.Steps,
+			HealthCriteria: strategy.HealthCriteria,
+		})
+	}
+	return writeOutput(os.Stdout, opts.output, summary, func(w io.Writer) {
+		fmt.Fprint(w, "Configuration is valid.\n\n")
+		fmt.Fprintln(w, "STRATEGY\tPROJECT\tREGIONS\tLABEL SELECTOR\tSTEPS\tHEALTH CRITERIA")
+		for _, s := range summary {
+			regions := "all"
+			if len(s.Target.Regions) != 0 {
+				regions = strings.Join(s.Target.Regions, ",")
+			}
+			var steps, criteria []string
+			for _, step := range s.Steps {
+				steps = append(steps, fmt.Sprintf("%d%%", step))
+			}
+			for _, c := range s.HealthCriteria {
+				criteria = append(criteria, fmt.Sprintf("%s=%v", checkName(c.Metric, c.Percentile), c.Threshold))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, orDash(s.Target.Project), regions, s.Target.LabelSelector,
+				strings.Join(steps, ","), strings.Join(criteria, ","))
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	var tests = []struct {
+		name          string
+		args          []string
+		outPositional []string
+		outRegion     string
+		outLimit      int
+		outErr        error
+		shouldErr     bool
+	}{
+		{
+			name: "no arguments",
+		},
+		{
+			name:          "flags before the arguments",
+			args:          []string{"-region", "us-east1", "hello"},
+			outPositional: []string{"hello"},
+			outRegion:     "us-east1",
+		},
+		{
+			name:          "flags after the arguments",
+			args:          []string{"hello", "-region=us-east1"},
+			outPositional: []string{"hello"},
+			outRegion:     "us-east1",
+		},
+		{
+			name:          "flags between the arguments",
+			args:          []string{"hello", "-region", "us-east1", "world", "-limit", "5", "again"},
+			outPositional: []string{"hello", "world", "again"},
+			outRegion:     "us-east1",
+			outLimit:      5,
+		},
+		{
+			name:      "unknown flag",
+			args:      []string{"hello", "-zone", "us-east1-b"},
+			shouldErr: true,
+		},
+		{
+			name:      "help",
+			args:      []string{"hello", "-h"},
+			outErr:    flag.ErrHelp,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Usage = func() {}
+			region := fs.String("region", "", "")
+			limit := fs.Int("limit", 0, "")
+
+			positional, err := parseInterspersed(fs, test.args)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				if test.outErr != nil {
+					assert.Equal(tt, test.outErr, err)
+				}
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outPositional, positional)
+			assert.Equal(tt, test.outRegion, *region)
+			assert.Equal(tt, test.outLimit, *limit)
+		})
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"status", "history", "pause", "rollback", "simulate", "validate-config"} {
+		cmd := findCommand(name)
+		if assert.NotNil(t, cmd, name) {
+			assert.Equal(t, name, cmd.name)
+		}
+	}
+	assert.True(t, findCommand("pause").needsRegion)
+	assert.Nil(t, findCommand("deploy"))
+	assert.Nil(t, findCommand(""))
+}
+
+func TestRunCommand(t *testing.T) {
+	var tests = []struct {
+		name        string
+		args        []string
+		needsRegion bool
+		runErr      error
+		outCode     int
+		outArgs     []string
+		outOutput   string
+		outRan      bool
+	}{
+		{
+			name:      "success",
+			args:      []string{"hello", "-o", "json"},
+			outCode:   0,
+			outArgs:   []string{"hello"},
+			outOutput: jsonOutput,
+			outRan:    true,
+		},
+		{
+			name:      "command error",
+			args:      []string{"hello"},
+			runErr:    errors.New("failed to get service"),
+			outCode:   1,
+			outArgs:   []string{"hello"},
+			outOutput: tableOutput,
+			outRan:    true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-zone", "us-east1-b", "hello"},
+			outCode: 2,
+		},
+		{
+			name:    "unknown output format",
+			args:    []string{"-o", "xml", "hello"},
+			outCode: 2,
+		},
+		{
+			name:        "missing region",
+			args:        []string{"hello"},
+			needsRegion: true,
+			outCode:     2,
+		},
+		{
+			name:        "region given",
+			args:        []string{"hello", "-region", "us-east1"},
+			needsRegion: true,
+			outCode:     0,
+			outArgs:     []string{"hello"},
+			outOutput:   tableOutput,
+			outRan:      true,
+		},
+		{
+			name:    "help",
+			args:    []string{"-h"},
+			outCode: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var (
+				ran  bool
+				args []string
+				opts commandOptions
+			)
+			cmd := &command{
+				name:        "test",
+				args:        "<service>",
+				help:        "test the commands",
+				needsRegion: test.needsRegion,
+				run: func(ctx context.Context, env commandEnv, o commandOptions, a []string) error {
+					ran, args, opts = true, a, o
+					return test.runErr
+				},
+			}
+
+			code := runCommand(context.Background(), cmd, commandEnv{logger: newTestLogger()}, test.args)
+			assert.Equal(tt, test.outCode, code)
+			assert.Equal(tt, test.outRan, ran)
+			if test.outRan {
+				assert.Equal(tt, test.outArgs, args)
+				assert.Equal(tt, test.outOutput, opts.output)
+			}
+		})
+	}
+}
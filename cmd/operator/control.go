@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// controlResponse is the response of a manual action on a rollout.
+type controlResponse struct {
+	Action         rollout.Action `json:"action"`
+	TrafficChanged bool           `json:"trafficChanged"`
+	Status         rollout.Status `json:"status"`
+}
+
+// regionPattern matches the names of Cloud Run regions, such as us-central1.
+var regionPattern = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+$`)
+
+// errInvalidRegion is the cause of the error returned when a service is
+// looked up in a region that is not a valid region name. The region ends up
+// in the host of the Cloud Run API endpoint, so it must be checked before
+// making any request.
+var errInvalidRegion = errors.New("invalid region")
+
+// findTargetedService returns the service with the given name in the region,
+// along with the first strategy that targets it. If project is empty, the
+// projects of all the strategies are searched.
+//
+// The service is retrieved directly and matched against the label selector
+// of the strategies, instead of listing all the services of the region.
+// Nil is returned if no strategy targets the service, including if the region
+// is not one of the regions listed by the targets. An error is returned if
+// the region is not a valid region name.
+func findTargetedService(ctx context.Context, logger *logrus.Logger, cfg *config.Config, project, region, name string) (*rollout.ServiceRecord, *config.Strategy, error) {
+	if !regionPattern.MatchString(region) {
+		return nil, nil, errors.Wrapf(errInvalidRegion, "region %q", region)
+	}
+
+	services := make(map[string]*run.Service)
+	for i := range cfg.Strategies {
+		strategy := &cfg.Strategies[i]
+		target := strategy.Target
+		if (project != "" && target.Project != project) || !targetsRegion(target, region) {
+			continue
+		}
+
+		// Set-based selectors are only evaluated by the Cloud Run API.
+		if strings.ContainsAny(target.LabelSelector, "()") {
+			svcs, err := getServicesByRegionAndLabel(ctx, logger, target.Project, region, target.LabelSelector)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to get services targeted by strategy %q", strategy.DisplayName())
+			}
+			for _, svc := range svcs {
+				if svc.Metadata.Name == name {
+					return newServiceRecord(svc, target.Project, region), strategy, nil
+				}
+			}
+			continue
+		}
+
+		svc, fetched := services[target.Project]
+		if !fetched {
+			var err error
+			svc, err = getService(ctx, target.Project, region, name)
+			if err != nil && !runapi.IsNotFound(err) {
+				return nil, nil, err
+			}
+			services[target.Project] = svc
+		}
+		if svc != nil && config.MatchLabels(target.LabelSelector, svc.Metadata.Labels) {
+			return newServiceRecord(svc, target.Project, region), strategy, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// targetsRegion determines if the target includes the region. A target
+// without regions includes all of them.
+func targetsRegion(target config.Target, region string) bool {
+	if len(target.Regions) == 0 {
+		return true
+	}
+	for _, r := range target.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAction performs the manual action on the rollout of the service.
+func applyAction(ctx context.Context, logger *logrus.Logger, svc *rollout.ServiceRecord, strategy *config.Strategy, action rollout.Action, notifier notification.Notifier) (controlResponse, error) {
+	lg := logger.WithFields(logrus.Fields{
+		"project": svc.Project,
+		"service": svc.Metadata.Name,
+		"region":  svc.Region,
+		"action":  action,
+	})
+
+	client, err := runapi.NewAPIClient(ctx, svc.Region)
+	if err != nil {
+		return controlResponse{}, errors.Wrap(err, "failed to initialize Cloud Run API client")
+	}
+	// Manual actions do not diagnose the candidate, so no metrics provider
+	// is needed.
+	roll := rollout.New(ctx, nil, svc, *strategy).
+		WithClient(client).
+		WithLogger(lg.Logger).
+		WithUpdateVerification(flVerifyTimeout, verifyInterval)
+	if notifier != nil {
+		roll = roll.WithNotifier(notifier)
+	}
+	if historyStore != nil {
+		roll = roll.WithHistory(historyStore)
+	}
+
+	changed, err := roll.Apply(action)
+	if err != nil {
+		return controlResponse{}, err
+	}
+	lg.Info("manual action applied")
+	return controlResponse{
+		Action:         action,
+		TrafficChanged: changed,
+		Status:         rollout.NewStatus(svc, *strategy, time.Now()),
+	}, nil
+}
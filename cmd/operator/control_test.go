@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTargetedService(t *testing.T) {
+	var tests = []struct {
+		name         string
+		regions      []string
+		region       string
+		outFound     bool
+		outRetrieved []string
+		outErr       error
+	}{
+		{
+			name:         "target without regions",
+			region:       "us-east1",
+			outFound:     true,
+			outRetrieved: []string{"project/us-east1/hello"},
+		},
+		{
+			name:         "region listed by the target",
+			regions:      []string{"us-central1", "us-east1"},
+			region:       "us-east1",
+			outFound:     true,
+			outRetrieved: []string{"project/us-east1/hello"},
+		},
+		{
+			name:    "region not listed by the target",
+			regions: []string{"us-central1"},
+			region:  "us-east1",
+		},
+		{
+			name:   "host in region",
+			region: "attacker.example#",
+			outErr: errInvalidRegion,
+		},
+		{
+			name:   "path in region",
+			region: "us-east1/../v1",
+			outErr: errInvalidRegion,
+		},
+		{
+			name:    "invalid region listed by the target",
+			regions: []string{"us-east1.example"},
+			region:  "us-east1.example",
+			outErr:  errInvalidRegion,
+		},
+		{
+			name:   "empty region",
+			outErr: errInvalidRegion,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			services := []*rollout.ServiceRecord{
+				newTestService("project", "us-east1", "hello", rollout.StableState),
+			}
+			var retrieved []string
+			defer stubGetService(services, &retrieved)()
+
+			cfg := &config.Config{
+				Strategies: []config.Strategy{
+					{Target: config.Target{Project: "project", Regions: test.regions}},
+				},
+			}
+			svc, strategy, err := findTargetedService(context.Background(), newTestLogger(), cfg, "", test.region, "hello")
+			assert.Equal(tt, test.outErr, errors.Cause(err))
+			assert.Equal(tt, test.outFound, svc != nil)
+			assert.Equal(tt, test.outFound, strategy != nil)
+			assert.Equal(tt, test.outRetrieved, retrieved)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// serviceKey identifies a service in a project and region.
+func serviceKey(project, region, name string) string {
+	return fmt.Sprintf("%s/%s/%s", project, region, name)
+}
+
+// tasksByService indexes the tasks by their service key.
+func tasksByService(tasks []*rolloutTask) map[string]*rolloutTask {
+	byKey := make(map[string]*rolloutTask, len(tasks))
+	for _, task := range tasks {
+		svc := task.service
+		byKey[serviceKey(svc.Project, svc.Region, svc.Metadata.Name)] = task
+	}
+	return byKey
+}
+
+// taskDependencies returns the ordering constraints of the task's service.
+func taskDependencies(task *rolloutTask) []config.Dependency {
+	var deps []config.Dependency
+	for _, dep := range task.strategy.Dependencies {
+		if dep.Service == task.service.Metadata.Name {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// orderTasks groups the tasks in levels. A task is placed in a level after all
+// the tasks it must wait for: the tasks of the services it depends on and, if
+// the strategy rolls out in region waves, the tasks of the same service in
+// earlier waves.
+//
+// Dependencies on services that are not part of the tasks are ignored for
+// ordering purposes. If the constraints form a cycle across strategies, the
+// remaining tasks are placed in a final level.
+func orderTasks(logger *logrus.Logger, tasks []*rolloutTask) [][]*rolloutTask {
+	byKey := tasksByService(tasks)
+	pending := make(map[*rolloutTask][]*rolloutTask)
+	for _, task := range tasks {
+		svc := task.service
+		var deps []*rolloutTask
+		for _, dep := range taskDependencies(task) {
+			if depTask, ok := byKey[serviceKey(svc.Project, svc.Region, dep.DependsOn)]; ok {
+				deps = append(deps, depTask)
+			}
+		}
+		deps = append(deps, earlierWaveTasks(task, tasks)...)
+		pending[task] = deps
+	}
+
+	var levels [][]*rolloutTask
+	done := make(map[*rolloutTask]bool)
+	for len(done) < len(tasks) {
+		var level []*rolloutTask
+		for _, task := range tasks {
+			if done[task] || !allDone(pending[task], done) {
+				continue
+			}
+			level = append(level, task)
+		}
+
+		if len(level) == 0 {
+			logger.Warn("found a dependency cycle between services, ignoring the order of the remaining services")
+			for _, task := range tasks {
+				if !done[task] {
+					level = append(level, task)
+				}
+			}
+		}
+		for _, task := range level {
+			done[task] = true
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// allDone determines if all the tasks were marked as done.
+func allDone(tasks []*rolloutTask, done map[*rolloutTask]bool) bool {
+	for _, task := range tasks {
+		if !done[task] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDependencies limits the traffic the task's candidate can get if any of
+// the services it depends on has not been fully promoted.
+//
+// The state of a dependency is read from the tasks of the current pass, which
+// reflect the changes made during the pass. If the dependency is not part of
+// the pass, it is retrieved from the Cloud Run API.
+func applyDependencies(ctx context.Context, logger *logrus.Logger, task *rolloutTask, byKey map[string]*rolloutTask) error {
+	svc := task.service
+	var (
+		waitingFor []string
+		retErr     error
+	)
+	for _, dep := range taskDependencies(task) {
+		var depSvc *run.Service
+		if depTask, ok := byKey[serviceKey(svc.Project, svc.Region, dep.DependsOn)]; ok {
+			depSvc = depTask.service.Service
+		} else {
+			var err error
+			depSvc, err = getService(ctx, svc.Project, svc.Region, dep.DependsOn)
+			if err != nil {
+				retErr = errors.Wrapf(err, "failed to get dependency %q of service %q", dep.DependsOn, svc.Metadata.Name)
+			}
+		}
+
+		if depSvc != nil && rollout.DetectState(depSvc) == rollout.StableState {
+			continue
+		}
+		waitingFor = append(waitingFor, dep.DependsOn)
+		if dep.MaxPercent < task.trafficLimit {
+			task.trafficLimit = dep.MaxPercent
+		}
+	}
+
+	if len(waitingFor) != 0 {
+		task.limitReason = fmt.Sprintf("waiting for %s to be fully promoted", strings.Join(waitingFor, ", "))
+		logger.WithFields(logrus.Fields{
+			"service":      svc.Metadata.Name,
+			"region":       svc.Region,
+			"trafficLimit": task.trafficLimit,
+		}).Debug(task.limitReason)
+	}
+	return retErr
+}
+
+// getService retrieves a service from the Cloud Run API. It is a variable so
+// that tests can replace it.
+var getService = func(ctx context.Context, project, region, name string) (*run.Service, error) {
+	client, err := runapi.NewAPIClient(ctx, region)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Cloud Run API client")
+	}
+	svc, err := client.Service(project, name)
+	return svc, errors.Wrapf(err, "failed to get service %q", name)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+// stubGetService makes getService return the given services, and records the
+// keys of the services retrieved. The returned function restores getService.
+func stubGetService(services []*rollout.ServiceRecord, retrieved *[]string) func() {
+	original := getService
+	getService = func(ctx context.Context, project, region, name string) (*run.Service, error) {
+		key := serviceKey(project, region, name)
+		*retrieved = append(*retrieved, key)
+		for _, svc := range services {
+			if serviceKey(svc.Project, svc.Region, svc.Metadata.Name) == key {
+				return svc.Service, nil
+			}
+		}
+		return nil, errors.Errorf("service %q not found", name)
+	}
+	return func() { getService = original }
+}
+
+// levelNames returns the names of the services of each level.
+func levelNames(levels [][]*rolloutTask) [][]string {
+	var names [][]string
+	for _, level := range levels {
+		var levelNames []string
+		for _, task := range level {
+			levelNames = append(levelNames, task.service.Metadata.Name)
+		}
+		names = append(names, levelNames)
+	}
+	return names
+}
+
+func TestOrderTasks(t *testing.T) {
+	var tests = []struct {
+		name         string
+		services     []string
+		dependencies []config.Dependency
+		outLevels    [][]string
+	}{
+		{
+			name:      "no dependencies",
+			services:  []string{"a", "b"},
+			outLevels: [][]string{{"a", "b"}},
+		},
+		{
+			name:     "dependency chain",
+			services: []string{"c", "b", "a", "d"},
+			dependencies: []config.Dependency{
+				{Service: "b", DependsOn: "a"},
+				{Service: "c", DependsOn: "b"},
+			},
+			outLevels: [][]string{{"a", "d"}, {"b"}, {"c"}},
+		},
+		{
+			name:     "multiple dependencies",
+			services: []string{"a", "b", "c"},
+			dependencies: []config.Dependency{
+				{Service: "c", DependsOn: "a"},
+				{Service: "c", DependsOn: "b"},
+				{Service: "b", DependsOn: "a"},
+			},
+			outLevels: [][]string{{"a"}, {"b"}, {"c"}},
+		},
+		{
+			name:     "dependency outside the pass is ignored",
+			services: []string{"a", "b"},
+			dependencies: []config.Dependency{
+				{Service: "a", DependsOn: "x"},
+			},
+			outLevels: [][]string{{"a", "b"}},
+		},
+		{
+			name:     "cycle",
+			services: []string{"a", "b", "c", "d"},
+			dependencies: []config.Dependency{
+				{Service: "a", DependsOn: "b"},
+				{Service: "b", DependsOn: "a"},
+				{Service: "d", DependsOn: "c"},
+			},
+			outLevels: [][]string{{"c"}, {"d"}, {"a", "b"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			strategy := &config.Strategy{Dependencies: test.dependencies}
+			var tasks []*rolloutTask
+			for _, name := range test.services {
+				svc := newTestService("project", "us-east1", name, rollout.NewCandidateState)
+				tasks = append(tasks, &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100})
+			}
+			assert.Equal(tt, test.outLevels, levelNames(orderTasks(newTestLogger(), tasks)))
+		})
+	}
+}
+
+func TestApplyDependencies(t *testing.T) {
+	var tests = []struct {
+		name            string
+		dependencies    []config.Dependency
+		inPass          map[string]rollout.State
+		outsidePass     map[string]rollout.State
+		outTrafficLimit int64
+		outLimitReason  string
+		outRetrieved    []string
+		outErr          string
+	}{
+		{
+			name:            "dependency promoted during the pass",
+			dependencies:    []config.Dependency{{Service: "b", DependsOn: "a", MaxPercent: 10}},
+			inPass:          map[string]rollout.State{"a": rollout.StableState},
+			outTrafficLimit: 100,
+		},
+		{
+			name:            "dependency in progress",
+			dependencies:    []config.Dependency{{Service: "b", DependsOn: "a", MaxPercent: 10}},
+			inPass:          map[string]rollout.State{"a": rollout.InProgressState},
+			outTrafficLimit: 10,
+			outLimitReason:  "waiting for a to be fully promoted",
+		},
+		{
+			name: "lowest limit of the pending dependencies",
+			dependencies: []config.Dependency{
+				{Service: "b", DependsOn: "a", MaxPercent: 50},
+				{Service: "b", DependsOn: "c", MaxPercent: 20},
+				{Service: "b", DependsOn: "d", MaxPercent: 0},
+			},
+			inPass: map[string]rollout.State{
+				"a": rollout.NewCandidateState,
+				"c": rollout.FailedState,
+				"d": rollout.StableState,
+			},
+			outTrafficLimit: 20,
+			outLimitReason:  "waiting for a, c to be fully promoted",
+		},
+		{
+			name:            "dependency outside the pass is retrieved",
+			dependencies:    []config.Dependency{{Service: "b", DependsOn: "x", MaxPercent: 30}},
+			outsidePass:     map[string]rollout.State{"x": rollout.InProgressState},
+			outTrafficLimit: 30,
+			outLimitReason:  "waiting for x to be fully promoted",
+			outRetrieved:    []string{"project/us-east1/x"},
+		},
+		{
+			name:            "stable dependency outside the pass",
+			dependencies:    []config.Dependency{{Service: "b", DependsOn: "x", MaxPercent: 30}},
+			outsidePass:     map[string]rollout.State{"x": rollout.StableState},
+			outTrafficLimit: 100,
+			outRetrieved:    []string{"project/us-east1/x"},
+		},
+		{
+			name:            "dependency outside the pass cannot be retrieved",
+			dependencies:    []config.Dependency{{Service: "b", DependsOn: "x", MaxPercent: 30}},
+			outTrafficLimit: 30,
+			outLimitReason:  "waiting for x to be fully promoted",
+			outRetrieved:    []string{"project/us-east1/x"},
+			outErr:          `failed to get dependency "x" of service "b"`,
+		},
+		{
+			name:            "dependencies of other services",
+			dependencies:    []config.Dependency{{Service: "c", DependsOn: "a", MaxPercent: 30}},
+			inPass:          map[string]rollout.State{"a": rollout.InProgressState},
+			outTrafficLimit: 100,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var outside []*rollout.ServiceRecord
+			for name, state := range test.outsidePass {
+				outside = append(outside, newTestService("project", "us-east1", name, state))
+			}
+			var retrieved []string
+			defer stubGetService(outside, &retrieved)()
+
+			strategy := &config.Strategy{Dependencies: test.dependencies}
+			task := &rolloutTask{
+				service:      newTestService("project", "us-east1", "b", rollout.NewCandidateState),
+				strategy:     strategy,
+				trafficLimit: 100,
+			}
+			tasks := []*rolloutTask{task}
+			for name, state := range test.inPass {
+				svc := newTestService("project", "us-east1", name, state)
+				tasks = append(tasks, &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100})
+			}
+
+			err := applyDependencies(context.Background(), newTestLogger(), task, tasksByService(tasks))
+			if test.outErr != "" {
+				assert.NotNil(tt, err)
+				assert.Contains(tt, err.Error(), test.outErr)
+			} else {
+				assert.Nil(tt, err)
+			}
+			assert.Equal(tt, test.outTrafficLimit, task.trafficLimit)
+			assert.Equal(tt, test.outLimitReason, task.limitReason)
+			assert.Equal(tt, test.outRetrieved, retrieved)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/auditlog"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/sirupsen/logrus"
+)
+
+// eventResponse is the response to an event that did not trigger a rollout.
+type eventResponse struct {
+	Ignored string `json:"ignored"`
+}
+
+// makeEventsHandler creates a request handler for the audit logs of Cloud Run
+// deployments delivered by Eventarc, which rolls out the deployed service
+// right away instead of waiting for the next pass.
+//
+// Ignored events are acknowledged with 200 OK so that they are not retried.
+// Updates made by the Release Manager itself are ignored, otherwise each
+// rollout would trigger another one.
+func makeEventsHandler(logger *logrus.Logger, cfg *config.Config, notifier notification.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		entry, err := auditlog.Decode(req)
+		if err != nil {
+			logger.WithError(err).Warn("received invalid event")
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if entry.CalledBy(runapi.UserAgent) {
+			writeJSON(w, http.StatusOK, eventResponse{Ignored: "update made by the Release Manager"})
+			return
+		}
+		deployment, reason := entry.Deployment()
+		if deployment == nil {
+			logger.WithField("reason", reason).Debug("ignoring event")
+			writeJSON(w, http.StatusOK, eventResponse{Ignored: reason})
+			return
+		}
+
+		lg := logger.WithFields(logrus.Fields{
+			"project":   deployment.Project,
+			"service":   deployment.Service,
+			"region":    deployment.Region,
+			"method":    deployment.Method,
+			"principal": deployment.Principal,
+		})
+		// The location comes from the event, so it is checked before it ends
+		// up in the host of the Cloud Run API endpoint.
+		if !regionPattern.MatchString(deployment.Region) {
+			lg.Warn("received event with an invalid location")
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid location %q", deployment.Region))
+			return
+		}
+
+		ctx := req.Context()
+		svc, strategy, err := findTargetedService(ctx, logger, cfg, deployment.Project, deployment.Region, deployment.Service)
+		if err != nil {
+			lg.WithError(err).Error("failed to find deployed service")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if svc == nil {
+			lg.Debug("deployed service is not targeted by any strategy")
+			writeJSON(w, http.StatusOK, eventResponse{Ignored: "service is not targeted by any strategy"})
+			return
+		}
+
+		lg.Info("rolling out deployed service")
+		tasks, errs := runServiceRollout(ctx, logger, cfg, svc, strategy, notifier)
+		if len(errs) != 0 {
+			lg.Warnf("there were %d errors: \n%s", len(errs), rolloutErrsToString(errs))
+		}
+		resp := newRolloutResponse(tasks, errs)
+		writeJSON(w, resp.statusCode(), resp)
+	}
+}
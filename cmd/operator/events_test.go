@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsHandlerLocation(t *testing.T) {
+	const entry = `{
+  "protoPayload": {
+    "methodName": "google.cloud.run.v1.Services.ReplaceService",
+    "resourceName": "namespaces/project/services/hello"
+  },
+  "resource": {
+    "type": "cloud_run_revision",
+    "labels": {"project_id": "project", "location": %q, "service_name": "hello"}
+  }
+}`
+
+	var tests = []struct {
+		name     string
+		location string
+		outCode  int
+	}{
+		{
+			name:     "host in location",
+			location: "attacker.example#",
+			outCode:  http.StatusBadRequest,
+		},
+		{
+			name:     "path in location",
+			location: "us-east1/../v1",
+			outCode:  http.StatusBadRequest,
+		},
+		{
+			name:     "location not targeted",
+			location: "us-east1",
+			outCode:  http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var retrieved []string
+			defer stubGetService(nil, &retrieved)()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(fmt.Sprintf(entry, test.location)))
+			makeEventsHandler(newTestLogger(), &config.Config{}, nil)(w, req)
+			assert.Equal(tt, test.outCode, w.Code)
+			assert.Empty(tt, retrieved)
+		})
+	}
+}
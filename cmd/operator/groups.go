@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// configurationsReadyCondition is the condition of a service that becomes true
+// once its latest revision is deployed. Traffic changes do not affect it.
+const configurationsReadyCondition = "ConfigurationsReady"
+
+// releaseGroupsOf returns the names of the release groups the task's service
+// belongs to, either through the release group label or the configuration.
+func releaseGroupsOf(cfg *config.Config, task *rolloutTask) []string {
+	var groups []string
+	if group := task.service.Metadata.Labels[rollout.ReleaseGroupLabel]; group != "" {
+		groups = append(groups, group)
+	}
+	for _, group := range cfg.ReleaseGroups {
+		for _, name := range group.Services {
+			if name == task.service.Metadata.Name {
+				groups = append(groups, group.Name)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// rollbackReleaseGroups rolls back the candidates of the services that share a
+// release group with a service whose latest revision is a failed candidate of
+// the same release.
+//
+// A failed member is detected from its last failed candidate annotation rather
+// than from the changes made during this pass, so the rollback of the other
+// members is retried on the next passes if it fails. Candidates deployed after
+// the member failed belong to a later release and are not rolled back.
+//
+// Groups are scoped to a project and region. Only candidates that are new or
+// receiving traffic are rolled back.
+func rollbackReleaseGroups(ctx context.Context, logger *logrus.Logger, cfg *config.Config, tasks []*rolloutTask, notifier notification.Notifier) []error {
+	rollbacks, errs := releaseGroupRollbacks(ctx, logger, cfg, tasks)
+	return append(errs, runTasks(ctx, logger, rollbacks, notifier)...)
+}
+
+// releaseGroupRollbacks returns the tasks whose candidate must be rolled back
+// because a member of their release group failed, with their rollback reason
+// set.
+func releaseGroupRollbacks(ctx context.Context, logger *logrus.Logger, cfg *config.Config, tasks []*rolloutTask) ([]*rolloutTask, []error) {
+	members := make(map[string][]*rolloutTask)
+	failed := make(map[string][]*rolloutTask)
+	var keys []string
+	for _, task := range tasks {
+		svc := task.service
+		for _, group := range releaseGroupsOf(cfg, task) {
+			key := serviceKey(svc.Project, svc.Region, group)
+			if members[key] == nil {
+				keys = append(keys, key)
+			}
+			members[key] = append(members[key], task)
+			if rollout.DetectState(svc.Service) == rollout.FailedState {
+				failed[key] = append(failed[key], task)
+			}
+		}
+	}
+
+	var (
+		errs      []error
+		rollbacks []*rolloutTask
+		seen      = make(map[*rolloutTask]bool)
+	)
+	for _, key := range keys {
+		if len(failed[key]) == 0 {
+			continue
+		}
+		for _, task := range members[key] {
+			svc := task.service
+			if seen[task] || !isRollingOut(svc.Service) {
+				continue
+			}
+			failedTask := failedInRelease(svc.Service, failed[key])
+			if failedTask == nil {
+				continue
+			}
+
+			// The service might have been updated during this pass.
+			fresh, err := getService(ctx, svc.Project, svc.Region, svc.Metadata.Name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			svc.Service = fresh
+			if !isRollingOut(fresh) {
+				continue
+			}
+
+			task.rollbackReason = fmt.Sprintf("candidate of %s failed in the same release group", failedTask.service.Metadata.Name)
+			logger.WithFields(logrus.Fields{
+				"service": svc.Metadata.Name,
+				"region":  svc.Region,
+			}).Info(task.rollbackReason)
+			seen[task] = true
+			rollbacks = append(rollbacks, task)
+		}
+	}
+	return rollbacks, errs
+}
+
+// isRollingOut determines if the service has a candidate that is new or
+// receiving traffic.
+func isRollingOut(svc *run.Service) bool {
+	state := rollout.DetectState(svc)
+	return state == rollout.NewCandidateState || state == rollout.InProgressState
+}
+
+// failedInRelease returns the first of the failed members whose candidate
+// belongs to the same release as the candidate of the service, or nil if
+// there is none.
+//
+// Services of a group have different images, so unlike region waves, the
+// release is identified by time: a candidate belongs to the release of a
+// failed candidate if it was deployed before that candidate failed. If either
+// time is unknown, the candidates are assumed to be of the same release.
+func failedInRelease(svc *run.Service, failed []*rolloutTask) *rolloutTask {
+	deployed, known := deployedAt(svc)
+	for _, task := range failed {
+		annotation := task.service.Metadata.Annotations[rollout.LastFailedCandidateTimeAnnotation]
+		failedAt, err := time.Parse(time.RFC3339, annotation)
+		if !known || err != nil || !deployed.After(failedAt) {
+			return task
+		}
+	}
+	return nil
+}
+
+// deployedAt returns the time the latest revision of the service was
+// deployed, which is when the service's configuration last became ready.
+func deployedAt(svc *run.Service) (time.Time, bool) {
+	if svc.Status == nil {
+		return time.Time{}, false
+	}
+	for _, condition := range svc.Status.Conditions {
+		if condition.Type == configurationsReadyCondition {
+			t, err := time.Parse(time.RFC3339, condition.LastTransitionTime)
+			return t, err == nil
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestReleaseGroupRollbacks(t *testing.T) {
+	type service struct {
+		region string
+		name   string
+		state  rollout.State
+		group  string
+		// at is the time the candidate failed for failed services, and the
+		// time the latest revision was deployed for the others.
+		at string
+	}
+	var tests = []struct {
+		name         string
+		services     []service
+		latest       []service
+		outRollbacks map[string]string
+		outRetrieved []string
+		outErrs      int
+	}{
+		{
+			name: "no failed member",
+			services: []service{
+				{"us-east1", "cart", rollout.InProgressState, "", ""},
+				{"us-east1", "payments", rollout.NewCandidateState, "", ""},
+			},
+		},
+		{
+			name: "failed member rolls back the candidates of the group",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"us-east1", "payments", rollout.InProgressState, "", ""},
+				{"us-east1", "orders", rollout.NewCandidateState, "checkout", ""},
+				{"us-east1", "search", rollout.InProgressState, "", ""},
+			},
+			outRollbacks: map[string]string{
+				"payments": "candidate of cart failed in the same release group",
+				"orders":   "candidate of cart failed in the same release group",
+			},
+			outRetrieved: []string{"project/us-east1/payments", "project/us-east1/orders"},
+		},
+		{
+			// The rollback of payments failed during the pass that rolled back
+			// cart, so cart is not a new failure.
+			name: "rollback is retried on the next passes",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"us-east1", "payments", rollout.InProgressState, "", ""},
+			},
+			outRollbacks: map[string]string{
+				"payments": "candidate of cart failed in the same release group",
+			},
+			outRetrieved: []string{"project/us-east1/payments"},
+		},
+		{
+			name: "candidate deployed before the failure",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", "2020-08-13T15:00:00Z"},
+				{"us-east1", "payments", rollout.InProgressState, "", "2020-08-13T14:00:00Z"},
+			},
+			outRollbacks: map[string]string{
+				"payments": "candidate of cart failed in the same release group",
+			},
+			outRetrieved: []string{"project/us-east1/payments"},
+		},
+		{
+			name: "candidate deployed after the failure",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", "2020-08-13T15:00:00Z"},
+				{"us-east1", "payments", rollout.NewCandidateState, "", "2020-08-13T16:00:00Z"},
+			},
+		},
+		{
+			name: "candidate deployed after one of the failures",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", "2020-08-13T15:00:00Z"},
+				{"us-east1", "orders", rollout.FailedState, "checkout", "2020-08-13T17:00:00Z"},
+				{"us-east1", "payments", rollout.InProgressState, "", "2020-08-13T16:00:00Z"},
+			},
+			outRollbacks: map[string]string{
+				"payments": "candidate of orders failed in the same release group",
+			},
+			outRetrieved: []string{"project/us-east1/payments"},
+		},
+		{
+			name: "stable and failed members are not rolled back",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"us-east1", "payments", rollout.StableState, "", ""},
+				{"us-east1", "orders", rollout.FailedState, "checkout", ""},
+			},
+		},
+		{
+			name: "groups are scoped to a region",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"europe-west1", "payments", rollout.InProgressState, "", ""},
+			},
+		},
+		{
+			name: "member promoted since it was retrieved",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"us-east1", "payments", rollout.InProgressState, "", ""},
+			},
+			latest: []service{
+				{"us-east1", "payments", rollout.StableState, "", ""},
+			},
+			outRetrieved: []string{"project/us-east1/payments"},
+		},
+		{
+			name: "member cannot be retrieved",
+			services: []service{
+				{"us-east1", "cart", rollout.FailedState, "", ""},
+				{"us-east1", "orders", rollout.InProgressState, "checkout", ""},
+			},
+			latest:       []service{},
+			outRetrieved: []string{"project/us-east1/orders"},
+			outErrs:      1,
+		},
+	}
+
+	cfg := &config.Config{
+		ReleaseGroups: []config.ReleaseGroup{
+			{Name: "checkout", Services: []string{"cart", "payments"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var tasks []*rolloutTask
+			for _, s := range test.services {
+				svc := newTestService("project", s.region, s.name, s.state)
+				if s.group != "" {
+					svc.Metadata.Labels[rollout.ReleaseGroupLabel] = s.group
+				}
+				if s.at != "" && s.state == rollout.FailedState {
+					svc.Metadata.Annotations[rollout.LastFailedCandidateTimeAnnotation] = s.at
+				} else if s.at != "" {
+					svc.Status.Conditions = []*run.GoogleCloudRunV1Condition{
+						{Type: configurationsReadyCondition, Status: "True", LastTransitionTime: s.at},
+					}
+				}
+				tasks = append(tasks, &rolloutTask{service: svc, strategy: &config.Strategy{}, trafficLimit: 100})
+			}
+			// The members are retrieved again, unchanged unless specified.
+			var latest []*rollout.ServiceRecord
+			if test.latest == nil {
+				for _, task := range tasks {
+					latest = append(latest, task.service)
+				}
+			}
+			for _, s := range test.latest {
+				latest = append(latest, newTestService("project", s.region, s.name, s.state))
+			}
+			var retrieved []string
+			defer stubGetService(latest, &retrieved)()
+
+			rollbacks, errs := releaseGroupRollbacks(context.Background(), newTestLogger(), cfg, tasks)
+			assert.Len(tt, errs, test.outErrs)
+			reasons := make(map[string]string)
+			for _, task := range rollbacks {
+				reasons[task.service.Metadata.Name] = task.rollbackReason
+			}
+			if test.outRollbacks == nil {
+				test.outRollbacks = map[string]string{}
+			}
+			assert.Equal(tt, test.outRollbacks, reasons)
+			assert.Equal(tt, test.outRetrieved, retrieved)
+		})
+	}
+}
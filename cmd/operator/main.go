@@ -22,12 +22,26 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/auth"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/cloudevents"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/github"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/incident"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/pubsub"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/slack"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/webhook"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
 	sdlog "github.com/TV4/logrus-stackdriver-formatter"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
@@ -61,6 +75,27 @@ var (
 	flHTTPAddr        string
 	flProject         string
 	flLabelSelector   string
+	flConfigFile      string
+
+	// Maximum number of services whose candidate receives traffic at once.
+	flMaxConcurrentRollouts int
+
+	// Maximum time to wait for an update to take effect.
+	flVerifyTimeout time.Duration
+
+	// Topic to publish rollout events to.
+	flPubSubTopic string
+
+	// Default Slack incoming webhook to post rollout events to.
+	flSlackWebhook string
+
+	// Service to roll out on its own in CLI mode, instead of all the targeted
+	// services.
+	flService       string
+	flServiceRegion string
+
+	// File to export the history of decisions to, for BigQuery.
+	flExportHistory string
 
 	// Empty array means all regions.
 	flRegions       []string
@@ -93,6 +128,14 @@ func init() {
 	flag.StringVar(&flHTTPAddr, "http-addr", defaultAddr, "address where to listen to http requests (e.g. :8080)")
 	flag.StringVar(&flProject, "project", "", "project in which the service is deployed")
 	flag.StringVar(&flLabelSelector, "label", "rollout-strategy=gradual", "filter services based on a label (e.g. team=backend)")
+	flag.StringVar(&flConfigFile, "config", "", "path to a JSON config file with the rollout strategies (overrides the strategy flags)")
+	flag.IntVar(&flMaxConcurrentRollouts, "max-concurrent-rollouts", 0, "maximum number of services whose candidate receives traffic at the same time (set 0 for no limit)")
+	flag.DurationVar(&flVerifyTimeout, "verify-timeout", time.Minute, "maximum time to wait for a traffic change to be served after updating the traffic of a service (set 0 to disable)")
+	flag.StringVar(&flPubSubTopic, "pubsub-topic", "", "Pub/Sub topic to publish rollout events to, in the form projects/{project}/topics/{topic}")
+	flag.StringVar(&flSlackWebhook, "slack-webhook", "", "Slack incoming webhook URL to post rollout events to")
+	flag.StringVar(&flService, "service", "", "only roll out this service in CLI mode, as long as a strategy targets it (requires -service-region)")
+	flag.StringVar(&flServiceRegion, "service-region", "", "the region of the service given by -service")
+	flag.StringVar(&flExportHistory, "export-history", "", "export the history of decisions as newline-delimited JSON for BigQuery to this file (- for stdout) and exit")
 	flag.StringVar(&flRegionsString, "regions", "", "the Cloud Run regions where the services should be looked at")
 	flag.Var(&flSteps, "step", "a percentage in traffic the candidate should go through")
 	flag.StringVar(&flStepsString, "steps", "5,20,50,80", "define steps in one flag separated by commas (e.g. 5,30,60)")
@@ -104,19 +147,37 @@ func init() {
 	flag.Float64Var(&flLatencyP95, "latency-p95", 0, "expected max latency for 95th percentile of requests in milliseconds (set 0 to ignore)")
 	flag.Float64Var(&flLatencyP50, "latency-p50", 0, "expected max latency for 50th percentile of requests in milliseconds (set 0 to ignore)")
 	flag.StringVar(&flGoogleSheetsID, "google-sheets", "", "ID of public Google sheets document to use as metrics provider")
-	flag.Parse()
-
-	args := flag.Args()
-	if len(args) != 0 {
-		logrus.Fatalf("positional arguments not accepted: %v", args)
-	}
+	flag.Usage = usage
+}
 
+func main() {
+	flag.Parse()
 	if flRegionsString != "" {
 		flRegions = strings.Split(flRegionsString, ",")
 	}
-}
 
-func main() {
+	// The first positional argument selects a command, which parses the
+	// arguments after it.
+	var (
+		cmd     *command
+		cmdArgs []string
+	)
+	if args := flag.Args(); len(args) != 0 {
+		cmd = findCommand(args[0])
+		if cmd == nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n\n", args[0])
+			flag.Usage()
+			os.Exit(2)
+		}
+		cmdArgs = args[1:]
+	}
+	var exitCode int
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	logger := logrus.New()
 	loggingLevel, err := logrus.ParseLevel(flLoggingLevel)
 	if err != nil {
@@ -137,7 +198,11 @@ func main() {
 	if flProject == "" {
 		logger.Info("-project not specified, trying to autodetect one")
 		flProject, err = determineProjectID(logger)
-		if err != nil {
+		if err != nil && (cmd == validateConfigCommand || cmd == simulateCommand) {
+			// The targets of the config file may all have a project, and a
+			// simulation may not need one.
+			logger.Warnf("failed to detect project: %v", err)
+		} else if err != nil {
 			logger.Fatalf("failed to detect project, must specify one with -project: %v", err)
 		} else {
 			logger.Infof("project detected: %s", flProject)
@@ -149,36 +214,255 @@ func main() {
 	}
 	logger.Debug(flagsToString())
 
-	// Configuration.
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		logger.Fatalf("failed to load configuration: %v", err)
+	}
+	if cmd == validateConfigCommand {
+		exitCode = runCommand(context.Background(), cmd, commandEnv{logger: logger, cfg: cfg}, cmdArgs)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Fatalf("invalid rollout configuration: %v", err)
+	}
+	if cmd == simulateCommand {
+		// A simulation does not update services, so it needs neither the
+		// history nor the notifiers.
+		exitCode = runCommand(context.Background(), cmd, commandEnv{logger: logger, cfg: cfg}, cmdArgs)
+		return
+	}
+
+	if cfg.History != nil {
+		historyStore, err = history.New(*cfg.History)
+		if err != nil {
+			logger.Fatalf("failed to initialize history store: %v", err)
+		}
+		logger.WithField("backend", cfg.History.Backend).Debug("recording rollout decisions")
+	}
+	if flExportHistory != "" {
+		if err := exportHistory(flExportHistory); err != nil {
+			logger.Fatalf("failed to export history: %v", err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		logger.WithField("signal", sig).Info("shutting down")
+		cancel()
+	}()
+
+	if cfg.Tracing != nil {
+		exporter, err := tracing.NewExporter(ctx, *cfg.Tracing)
+		if err != nil {
+			logger.Fatalf("failed to initialize trace exporter: %v", err)
+		}
+		provider := tracing.Setup(exporter, cfg.Tracing.ServiceName)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := provider.Shutdown(ctx); err != nil {
+				logger.WithError(err).Warn("failed to export spans")
+			}
+		}()
+		logger.WithField("exporter", cfg.Tracing.Exporter).Debug("tracing rollout passes")
+	}
+
+	var notifiers notification.Multi
+	if cfg.PubSubTopic != "" {
+		ps, err := pubsub.New(util.ContextWithLogger(ctx, logrus.NewEntry(logger)), flProject, cfg.PubSubTopic)
+		if err != nil {
+			logger.Fatalf("failed to initialize Pub/Sub client: %v", err)
+		}
+		defer ps.Stop()
+		notifiers = append(notifiers, ps)
+		logger.WithField("topic", cfg.PubSubTopic).Debug("publishing rollout events to Pub/Sub")
+	}
+	if cfg.Slack != nil {
+		notifiers = append(notifiers, slack.New(*cfg.Slack))
+		logger.WithField("routes", len(cfg.Slack.Routes)).Debug("posting rollout events to Slack")
+	}
+	if cfg.GitHub != nil {
+		token := os.Getenv(cfg.GitHub.TokenEnv)
+		if token == "" {
+			logger.Fatalf("GitHub token environment variable %s is not set", cfg.GitHub.TokenEnv)
+		}
+		notifiers = append(notifiers, github.New(*cfg.GitHub, token))
+		logger.Debug("reporting rollouts as GitHub deployments")
+	}
+	if cfg.Incidents != nil {
+		var routingKey string
+		if cfg.Incidents.RoutingKeyEnv != "" {
+			routingKey = os.Getenv(cfg.Incidents.RoutingKeyEnv)
+			if routingKey == "" {
+				logger.Fatalf("incident routing key environment variable %s is not set", cfg.Incidents.RoutingKeyEnv)
+			}
+		}
+		notifiers = append(notifiers, incident.New(*cfg.Incidents, routingKey))
+		logger.WithField("provider", cfg.Incidents.Provider).Debug("opening incidents on rollbacks")
+	}
+	for _, sink := range cfg.CloudEvents {
+		notifiers = append(notifiers, cloudevents.New(sink))
+		logger.WithField("url", sink.URL).Debug("sending rollout events as CloudEvents")
+	}
+	for _, wh := range cfg.Webhooks {
+		secret := os.Getenv(wh.SecretEnv)
+		if secret == "" {
+			logger.Fatalf("webhook secret environment variable %s is not set", wh.SecretEnv)
+		}
+		notifiers = append(notifiers, webhook.New(wh, []byte(secret)))
+		logger.WithField("url", wh.URL).Debug("posting rollout events to webhook")
+	}
+	var notifier notification.Notifier
+	if len(notifiers) != 0 {
+		notifier = notifiers
+	}
+
+	if cmd != nil {
+		exitCode = runCommand(ctx, cmd, commandEnv{logger: logger, cfg: cfg, notifier: notifier}, cmdArgs)
+		return
+	}
+
+	if flCLI {
+		runDaemon(ctx, logger, cfg, notifier)
+		return
+	}
+
+	var (
+		rolloutHandler = tracing.Middleware(makeRolloutHandler(logger, cfg, notifier))
+		eventsHandler  = tracing.Middleware(makeEventsHandler(logger, cfg, notifier))
+		statusHandler  = tracing.Middleware(makeStatusHandler(logger, cfg))
+	)
+	if cfg.Authentication != nil {
+		verifier, err := auth.New(ctx, *cfg.Authentication)
+		if err != nil {
+			logger.Fatalf("failed to initialize authentication: %v", err)
+		}
+		rolloutHandler = verifier.Middleware(logger, rolloutHandler)
+		eventsHandler = verifier.Middleware(logger, eventsHandler)
+		statusHandler = verifier.Middleware(logger, statusHandler)
+		logger.WithField("audience", cfg.Authentication.Audience).Debug("verifying ID tokens of rollout requests")
+	}
+	http.Handle("/rollout", rolloutHandler)
+	http.Handle("/events", eventsHandler)
+	http.Handle("/metrics", selfmetrics.Handler())
+	http.Handle("/status", statusHandler)
+	http.Handle("/status/", statusHandler)
+	if cfg.Control != nil {
+		token := os.Getenv(cfg.Control.TokenEnv)
+		if token == "" {
+			logger.Fatalf("control token environment variable %s is not set", cfg.Control.TokenEnv)
+		}
+		http.HandleFunc("/control/", makeControlHandler(logger, cfg, token, notifier))
+	}
+	server := &http.Server{Addr: flHTTPAddr}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	logger.WithField("addr", flHTTPAddr).Infof("starting server")
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatal(err)
+	}
+}
+
+// loadConfig builds the configuration either from the config file or from the
+// strategy-related flags.
+func loadConfig(logger *logrus.Logger) (*config.Config, error) {
+	if flConfigFile != "" {
+		logger.WithField("path", flConfigFile).Debug("loading configuration from file")
+		cfg, err := config.LoadFile(flConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// Targets without a project default to the -project flag.
+		for i := range cfg.Strategies {
+			if cfg.Strategies[i].Target.Project == "" {
+				cfg.Strategies[i].Target.Project = flProject
+			}
+			printHealthCriteria(logger, cfg.Strategies[i].HealthCriteria)
+		}
+		if flMaxConcurrentRollouts != 0 {
+			cfg.MaxConcurrentRollouts = flMaxConcurrentRollouts
+		}
+		if flPubSubTopic != "" {
+			cfg.PubSubTopic = flPubSubTopic
+		}
+		setSlackWebhook(cfg)
+		return cfg, nil
+	}
+
 	target := config.NewTarget(flProject, flRegions, flLabelSelector)
 	healthCriteria := healthCriteriaFromFlags(flMinRequestCount, flErrorRate, flLatencyP99, flLatencyP95, flLatencyP50)
 	printHealthCriteria(logger, healthCriteria)
 	strategy := config.NewStrategy(target, flSteps, flHealthOffset, flTimeBeweenRollouts, healthCriteria)
-	cfg := &config.Config{Strategies: []config.Strategy{strategy}}
-	if err := cfg.Validate(); err != nil {
-		logger.Fatalf("invalid rollout configuration: %v", err)
+	cfg := &config.Config{
+		Strategies:            []config.Strategy{strategy},
+		MaxConcurrentRollouts: flMaxConcurrentRollouts,
+		PubSubTopic:           flPubSubTopic,
 	}
+	setSlackWebhook(cfg)
+	return cfg, nil
+}
 
-	ctx := context.Background()
-	if flCLI {
-		runDaemon(ctx, logger, cfg)
-	} else {
-		http.HandleFunc("/rollout", makeRolloutHandler(logger, cfg))
-		logger.WithField("addr", flHTTPAddr).Infof("starting server")
-		logger.Fatal(http.ListenAndServe(flHTTPAddr, nil))
+// exportHistory writes all the recorded decisions to the file as rows for
+// BigQuery, or to the standard output if path is "-".
+func exportHistory(path string) error {
+	if historyStore == nil {
+		return errors.New("history is not configured")
+	}
+	records, err := historyStore.List(context.Background(), history.Filter{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list decisions")
+	}
+	if path == "-" {
+		return history.ExportBigQuery(os.Stdout, records)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create export file")
+	}
+	if err := history.ExportBigQuery(f, records); err != nil {
+		f.Close()
+		return err
+	}
+	return errors.Wrap(f.Close(), "failed to close export file")
+}
+
+// setSlackWebhook sets the default Slack webhook from the -slack-webhook flag.
+func setSlackWebhook(cfg *config.Config) {
+	if flSlackWebhook == "" {
+		return
+	}
+	if cfg.Slack == nil {
+		cfg.Slack = &config.Slack{}
 	}
+	cfg.Slack.WebhookURL = flSlackWebhook
 }
 
-func runDaemon(ctx context.Context, logger *logrus.Logger, cfg *config.Config) {
+func runDaemon(ctx context.Context, logger *logrus.Logger, cfg *config.Config, notifier notification.Notifier) {
 	for {
-		// TODO(gvso): Handle all the strategies.
-		errs := runRollouts(ctx, logger, cfg.Strategies[0])
+		var errs []error
+		if flService != "" {
+			_, errs = runTargetedRollout(ctx, logger, cfg, "", flServiceRegion, flService, notifier)
+		} else {
+			_, errs = runRollouts(ctx, logger, cfg, notifier)
+		}
 		errsStr := rolloutErrsToString(errs)
 		if len(errs) != 0 {
 			logger.Warnf("there were %d errors: \n%s", len(errs), errsStr)
 		}
 
-		time.Sleep(flCLILoopInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(flCLILoopInterval):
+		}
 	}
 }
 
@@ -203,6 +487,21 @@ func validateFlags() error {
 		}
 	}
 
+	if flMaxConcurrentRollouts < 0 {
+		return errors.Errorf("max concurrent rollouts cannot be negative, got %d", flMaxConcurrentRollouts)
+	}
+
+	if flVerifyTimeout < 0 {
+		return errors.Errorf("verify timeout cannot be negative, got %s", flVerifyTimeout)
+	}
+
+	if (flService == "") != (flServiceRegion == "") {
+		return errors.New("-service and -service-region must be given together")
+	}
+	if flService != "" && !flCLI {
+		return errors.New("-service requires -cli, use the service and region parameters of /rollout instead")
+	}
+
 	if flCLILoopInterval < 0 {
 		return errors.Errorf("cli run interval cannot be negative, got %s", flCLILoopInterval)
 	}
@@ -222,7 +521,17 @@ func flagsToString() string {
 		regionsStr = fmt.Sprintf("%v", flRegions)
 	}
 
+	if flConfigFile != "" {
+		str += fmt.Sprintf("-config=%s\n", flConfigFile)
+	}
+	if flService != "" {
+		str += fmt.Sprintf("-service=%s\n-service-region=%s\n", flService, flServiceRegion)
+	}
+
 	str += fmt.Sprintf("-project=%s\n"+
+		"-max-concurrent-rollouts=%d\n"+
+		"-verify-timeout=%s\n"+
+		"-pubsub-topic=%s\n"+
 		"-label=%s\n"+
 		"-regions=%s\n"+
 		"-steps=%s\n"+
@@ -234,6 +543,9 @@ func flagsToString() string {
 		"-latency-p95=%.2f\n"+
 		"-latency-p50=%.2f\n",
 		flProject,
+		flMaxConcurrentRollouts,
+		flVerifyTimeout,
+		flPubSubTopic,
 		flLabelSelector,
 		regionsStr,
 		flSteps,
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the commands.
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+	yamlOutput  = "yaml"
+)
+
+// outputFormats are all the output formats.
+var outputFormats = []string{tableOutput, jsonOutput, yamlOutput}
+
+// isOutputFormat determines if the format is a known output format.
+func isOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutput writes the value in the format. The table format is written by
+// the table function, while the others encode the value with its JSON field
+// names.
+func writeOutput(w io.Writer, format string, v interface{}, table func(w io.Writer)) error {
+	switch format {
+	case tableOutput:
+		tw := newTableWriter(w)
+		table(tw)
+		return errors.Wrap(tw.Flush(), "failed to write table")
+	case jsonOutput:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(v), "failed to write JSON")
+	case yamlOutput:
+		return writeYAML(w, v)
+	default:
+		return errors.Errorf("unknown output format %q, must be one of %v", format, outputFormats)
+	}
+}
+
+// newTableWriter returns a writer that aligns tab-separated columns.
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// writeYAML writes the value as YAML, with the same field names and order as
+// its JSON encoding.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal value")
+	}
+
+	// JSON is valid YAML, so it is decoded as a node that keeps the order of
+	// the fields. Its flow style and quotes are dropped for block style.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return errors.Wrap(err, "failed to convert value to YAML")
+	}
+	resetStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return errors.Wrap(err, "failed to write YAML")
+	}
+	if err := enc.Close(); err != nil {
+		return errors.Wrap(err, "failed to write YAML")
+	}
+	_, err = w.Write(buf.Bytes())
+	return errors.Wrap(err, "failed to write YAML")
+}
+
+// resetStyle clears the style of the node and its children.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// orDash returns the value, or a dash if it is empty.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// writeIndented writes each line of the text with the indentation.
+func writeIndented(w io.Writer, indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, line)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOutput(t *testing.T) {
+	type service struct {
+		Service  string   `json:"service"`
+		Revision string   `json:"revision"`
+		Percent  int64    `json:"percent"`
+		Tags     []string `json:"tags,omitempty"`
+	}
+	value := service{Service: "hello", Revision: "001", Percent: 40, Tags: []string{"stable"}}
+	table := func(w io.Writer) {
+		fmt.Fprintln(w, "SERVICE\tREVISION\tPERCENT")
+		fmt.Fprintf(w, "%s\t%s\t%d%%\n", value.Service, value.Revision, value.Percent)
+	}
+
+	var tests = []struct {
+		name      string
+		format    string
+		outOutput string
+		shouldErr bool
+	}{
+		{
+			name:   "table",
+			format: tableOutput,
+			outOutput: "SERVICE  REVISION  PERCENT\n" +
+				"hello    001       40%\n",
+		},
+		{
+			name:   "json",
+			format: jsonOutput,
+			outOutput: `{
+  "service": "hello",
+  "revision": "001",
+  "percent": 40,
+  "tags": [
+    "stable"
+  ]
+}
+`,
+		},
+		{
+			name:   "yaml keeps the field order and quotes strings only if needed",
+			format: yamlOutput,
+			outOutput: `service: hello
+revision: "001"
+percent: 40
+tags:
+- stable
+`,
+		},
+		{
+			name:      "unknown format",
+			format:    "xml",
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			err := writeOutput(&buf, test.format, value, table)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outOutput, buf.String())
+		})
+	}
+}
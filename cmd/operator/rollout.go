@@ -3,53 +3,379 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/sheets"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/stackdriver"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
 	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// runRollouts concurrently handles the rollout of the targeted services.
-func runRollouts(ctx context.Context, logger *logrus.Logger, strategy config.Strategy) []error {
-	svcs, err := getTargetedServices(ctx, logger, strategy.Target)
-	if err != nil {
-		return []error{errors.Wrap(err, "failed to get targeted services")}
+// verifyInterval is the time between checks of whether an update took effect.
+const verifyInterval = 2 * time.Second
+
+// historyStore records the decisions made on the services. Nil if the history
+// is not configured.
+var historyStore history.Store
+
+// rolloutTask is a service to roll out along with the strategy it matched.
+type rolloutTask struct {
+	service  *rollout.ServiceRecord
+	strategy *config.Strategy
+	queued   bool
+
+	// trafficLimit is the maximum traffic the candidate can get due to the
+	// services or regions it must wait for, and limitReason explains why.
+	trafficLimit int64
+	limitReason  string
+
+	// rollbackReason is set if the candidate must be rolled back regardless
+	// of its health.
+	rollbackReason string
+
+	// result is the outcome of the last rollout of the service during this
+	// pass, and err the error it failed with.
+	result rollout.Result
+	err    error
+}
+
+// rolloutResponse is the response of a rollout pass.
+type rolloutResponse struct {
+	Services []serviceResult `json:"services"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+// serviceResult is the outcome of the rollout of a service.
+type serviceResult struct {
+	Project  string `json:"project"`
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+	Strategy string `json:"strategy"`
+	rollout.Result
+	Error string `json:"error,omitempty"`
+}
+
+// newRolloutResponse returns the results of the tasks and the errors that are
+// not specific to one of them.
+func newRolloutResponse(tasks []*rolloutTask, errs []error) rolloutResponse {
+	resp := rolloutResponse{Services: []serviceResult{}}
+	taskErrs := make(map[error]bool)
+	for _, task := range tasks {
+		svc := task.service
+		result := serviceResult{
+			Project:  svc.Project,
+			Region:   svc.Region,
+			Service:  svc.Metadata.Name,
+			Strategy: task.strategy.DisplayName(),
+			Result:   task.result,
+		}
+		if task.err != nil {
+			taskErrs[task.err] = true
+			result.Error = task.err.Error()
+		}
+		resp.Services = append(resp.Services, result)
+	}
+	for _, err := range errs {
+		if !taskErrs[err] {
+			resp.Errors = append(resp.Errors, err.Error())
+		}
+	}
+	return resp
+}
+
+// statusCode returns 200 if the pass had no errors, 207 if only some services
+// or constraints failed, and 500 if no service could be rolled out.
+func (resp rolloutResponse) statusCode() int {
+	var failed int
+	for _, result := range resp.Services {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0 && len(resp.Errors) == 0:
+		return http.StatusOK
+	case failed < len(resp.Services):
+		return http.StatusMultiStatus
+	default:
+		return http.StatusInternalServerError
 	}
-	if len(svcs) == 0 {
+}
+
+// runRollouts concurrently handles the rollout of the services targeted by all
+// the strategies. It returns the handled tasks along with all the errors,
+// including the ones recorded in the tasks.
+//
+// If a notifier is given, it is sent the events of each rollout.
+func runRollouts(ctx context.Context, logger *logrus.Logger, cfg *config.Config, notifier notification.Notifier) (tasks []*rolloutTask, errs []error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "runRollouts")
+	defer func() {
+		recordPass(start, tasks, errs)
+		span.SetAttributes(attribute.Int64("services", int64(len(tasks))), attribute.Int64("errors", int64(len(errs))))
+		if len(errs) != 0 {
+			tracing.RecordError(span, errors.Errorf("there were %d errors", len(errs)))
+		}
+		span.End()
+	}()
+
+	for i := range cfg.Strategies {
+		strategy := &cfg.Strategies[i]
+		svcs, err := getTargetedServices(ctx, logger, strategy.Target)
+		if err != nil {
+			return nil, []error{errors.Wrap(err, "failed to get targeted services")}
+		}
+		for _, svc := range svcs {
+			tasks = append(tasks, &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100})
+		}
+	}
+	tasks = dedupeTasks(logger, tasks)
+	if len(tasks) == 0 {
 		logger.Warn("no service matches the targets")
 	}
 
+	// Services are handled after the services they depend on and after the
+	// regions of earlier waves, so that the constraints are checked against
+	// the state resulting from this pass. The concurrency limits are checked
+	// once the constraints are applied, since held candidates need no slot.
+	byKey := tasksByService(tasks)
+	for _, level := range orderTasks(logger, tasks) {
+		for _, task := range level {
+			if err := applyDependencies(ctx, logger, task, byKey); err != nil {
+				errs = append(errs, err)
+			}
+			applyWaves(logger, task, tasks)
+		}
+		queueRollouts(logger, cfg, tasks, level)
+		errs = append(errs, runTasks(ctx, logger, level, notifier)...)
+	}
+	return tasks, append(errs, rollbackReleaseGroups(ctx, logger, cfg, tasks, notifier)...)
+}
+
+// dedupeTasks returns the tasks without the duplicates of services targeted
+// by more than one strategy. Such services are handled by the first strategy
+// that targets them, so they are not updated twice in a pass.
+func dedupeTasks(logger *logrus.Logger, tasks []*rolloutTask) []*rolloutTask {
+	var (
+		ret  []*rolloutTask
+		seen = make(map[string]*config.Strategy)
+	)
+	for _, task := range tasks {
+		svc := task.service
+		key := serviceKey(svc.Project, svc.Region, svc.Metadata.Name)
+		if strategy, ok := seen[key]; ok {
+			logger.WithFields(logrus.Fields{
+				"service":  svc.Metadata.Name,
+				"region":   svc.Region,
+				"strategy": task.strategy.DisplayName(),
+			}).Debugf("service is already targeted by strategy %q, skipping", strategy.DisplayName())
+			continue
+		}
+		seen[key] = task.strategy
+		ret = append(ret, task)
+	}
+	return ret
+}
+
+// errNotTargeted is the cause of the error returned when a targeted rollout
+// is requested for a service that no strategy targets.
+var errNotTargeted = errors.New("service is not targeted by any strategy")
+
+// runTargetedRollout handles the rollout of the service with the given name in
+// the region, as long as a strategy targets it. If project is empty, the
+// projects of all the strategies are searched.
+func runTargetedRollout(ctx context.Context, logger *logrus.Logger, cfg *config.Config, project, region, name string, notifier notification.Notifier) ([]*rolloutTask, []error) {
+	svc, strategy, err := findTargetedService(ctx, logger, cfg, project, region, name)
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "failed to find service %q in region %q", name, region)}
+	}
+	if svc == nil {
+		return nil, []error{errors.Wrapf(errNotTargeted, "service %q in region %q", name, region)}
+	}
+	return runServiceRollout(ctx, logger, cfg, svc, strategy, notifier)
+}
+
+// runServiceRollout handles the rollout of a single service targeted by the
+// strategy, without listing the other targeted services.
+//
+// The concurrency limits, region waves and release groups depend on the state
+// of other services, so a full pass is run instead if any of them applies.
+func runServiceRollout(ctx context.Context, logger *logrus.Logger, cfg *config.Config, svc *rollout.ServiceRecord, strategy *config.Strategy, notifier notification.Notifier) ([]*rolloutTask, []error) {
+	task := &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100}
+	if cfg.MaxConcurrentRollouts > 0 || strategy.MaxConcurrentRollouts > 0 ||
+		strategy.RegionWaves != nil || len(releaseGroupsOf(cfg, task)) != 0 {
+
+		logger.WithFields(logrus.Fields{
+			"service": svc.Metadata.Name,
+			"region":  svc.Region,
+		}).Debug("rollout depends on other services, running a full pass")
+		return runRollouts(ctx, logger, cfg, notifier)
+	}
+
+	var errs []error
+	if err := applyDependencies(ctx, logger, task, map[string]*rolloutTask{}); err != nil {
+		errs = append(errs, err)
+	}
+	tasks := []*rolloutTask{task}
+	errs = append(errs, runTasks(ctx, logger, tasks, notifier)...)
+	recordRollout(task)
+	return tasks, errs
+}
+
+// runTasks concurrently handles the rollout of the given tasks.
+func runTasks(ctx context.Context, logger *logrus.Logger, tasks []*rolloutTask, notifier notification.Notifier) []error {
 	var (
 		errs []error
 		mu   sync.Mutex
 		wg   sync.WaitGroup
 	)
-	for _, svc := range svcs {
+	for _, task := range tasks {
 		wg.Add(1)
-		go func(ctx context.Context, lg *logrus.Logger, svc *rollout.ServiceRecord, strategy config.Strategy) {
+		go func(ctx context.Context, lg *logrus.Logger, task *rolloutTask) {
 			defer wg.Done()
-			err := handleRollout(ctx, lg, svc, strategy)
+			err := handleRollout(ctx, lg, task, notifier)
+			task.err = err
+			rolloutErrors.record(task.service, err)
 			if err != nil {
-				lg.Debugf("rollout error for service %q: %+v", svc.Service.Metadata.Name, err)
+				lg.Debugf("rollout error for service %q: %+v", task.service.Metadata.Name, err)
 				mu.Lock()
 				errs = append(errs, err)
 				mu.Unlock()
 			}
-		}(ctx, logger, svc, strategy)
+		}(ctx, logger, task)
 	}
 	wg.Wait()
 
 	return errs
 }
 
+// recordPass records the metrics of a pass over all the targeted services,
+// including the rollout of each of them.
+func recordPass(start time.Time, tasks []*rolloutTask, errs []error) {
+	for _, task := range tasks {
+		recordRollout(task)
+	}
+	result := "success"
+	switch newRolloutResponse(tasks, errs).statusCode() {
+	case http.StatusMultiStatus:
+		result = "partial"
+	case http.StatusInternalServerError:
+		result = "failure"
+	}
+	selfmetrics.PassDuration.Observe(time.Since(start).Seconds())
+	selfmetrics.Passes.WithLabelValues(result).Inc()
+	selfmetrics.LastPass.Set(float64(time.Now().Unix()))
+}
+
+// recordRollout records the metrics of the rollout of the task's service.
+//
+// A task can be handled twice in a pass, when its candidate is rolled back
+// because of its release group, so it must be called once the pass is over.
+func recordRollout(task *rolloutTask) {
+	strategy := task.strategy.DisplayName()
+	selfmetrics.ServicesEvaluated.WithLabelValues(strategy).Inc()
+	if task.err != nil {
+		selfmetrics.RolloutErrors.WithLabelValues(strategy).Inc()
+		return
+	}
+	selfmetrics.Decisions.WithLabelValues(strategy, string(task.result.Outcome)).Inc()
+	if task.result.Outcome == rollout.RolledBackOutcome {
+		selfmetrics.Rollbacks.WithLabelValues(strategy).Inc()
+	}
+	svc := task.service
+	selfmetrics.CandidatePercent.WithLabelValues(svc.Project, svc.Region, svc.Metadata.Name).Set(float64(task.result.NewCandidatePercent))
+}
+
+// queueRollouts marks the tasks of the level with a new candidate that must
+// not receive traffic yet because the maximum number of concurrent rollouts,
+// either for their strategy or globally, has been reached.
+//
+// Services of all the tasks whose candidate already receives traffic count
+// towards the limits, including the candidates admitted in earlier levels.
+// Candidates that are paused, held at 0% by a dependency or a region wave, or
+// rolled back need no slot. New candidates are admitted in order of project,
+// region and service name.
+func queueRollouts(logger *logrus.Logger, cfg *config.Config, tasks, level []*rolloutTask) {
+	var (
+		active         int
+		activeStrategy = make(map[*config.Strategy]int)
+		newCandidates  []*rolloutTask
+	)
+	for _, task := range tasks {
+		if rollout.DetectState(task.service.Service) == rollout.InProgressState {
+			active++
+			activeStrategy[task.strategy]++
+		}
+	}
+	for _, task := range level {
+		svc := task.service.Service
+		// A held candidate does not get traffic, so it needs no slot.
+		if rollout.DetectState(svc) == rollout.NewCandidateState && !rollout.IsPaused(svc) &&
+			task.trafficLimit > 0 && task.rollbackReason == "" {
+			newCandidates = append(newCandidates, task)
+		}
+	}
+
+	sort.Slice(newCandidates, func(i, j int) bool {
+		a, b := newCandidates[i].service, newCandidates[j].service
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Metadata.Name < b.Metadata.Name
+	})
+
+	for _, task := range newCandidates {
+		strategyLimit := task.strategy.MaxConcurrentRollouts
+		if (cfg.MaxConcurrentRollouts > 0 && active >= cfg.MaxConcurrentRollouts) ||
+			(strategyLimit > 0 && activeStrategy[task.strategy] >= strategyLimit) {
+
+			logger.WithFields(logrus.Fields{
+				"service": task.service.Metadata.Name,
+				"region":  task.service.Region,
+			}).Debug("max concurrent rollouts reached, queueing new candidate")
+			task.queued = true
+			continue
+		}
+		active++
+		activeStrategy[task.strategy]++
+	}
+}
+
 // handleRollout manages the rollout process for a single service.
-func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.ServiceRecord, strategy config.Strategy) error {
+func handleRollout(ctx context.Context, logger *logrus.Logger, task *rolloutTask, notifier notification.Notifier) (err error) {
+	service := task.service
+	ctx, span := tracing.Start(ctx, "handleRollout",
+		attribute.String("project", service.Project),
+		attribute.String("service", service.Metadata.Name),
+		attribute.String("region", service.Region),
+		attribute.String("strategy", task.strategy.DisplayName()))
+	defer func() {
+		result := task.result
+		span.SetAttributes(
+			attribute.String("stableRevision", result.StableRevision),
+			attribute.String("candidateRevision", result.CandidateRevision),
+			attribute.String("decision", string(result.Outcome)),
+			attribute.String("reason", reasonCode(result.Reason)),
+			attribute.Int64("oldCandidatePercent", result.OldCandidatePercent),
+			attribute.Int64("newCandidatePercent", result.NewCandidatePercent))
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 	lg := logger.WithFields(logrus.Fields{
 		"project": service.Project,
 		"service": service.Metadata.Name,
@@ -64,9 +390,24 @@ func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize metrics provider")
 	}
-	roll := rollout.New(ctx, metricsProvider, service, strategy).WithClient(client).WithLogger(lg.Logger)
+	roll := rollout.New(ctx, metrics.Traced(metricsProvider), service, *task.strategy).
+		WithClient(client).
+		WithLogger(lg.Logger).
+		WithQueued(task.queued).
+		WithTrafficLimit(task.trafficLimit, task.limitReason).
+		WithUpdateVerification(flVerifyTimeout, verifyInterval)
+	if task.rollbackReason != "" {
+		roll = roll.WithForcedRollback(task.rollbackReason)
+	}
+	if notifier != nil {
+		roll = roll.WithNotifier(notifier)
+	}
+	if historyStore != nil {
+		roll = roll.WithHistory(historyStore)
+	}
 
 	changed, err := roll.Rollout()
+	task.result = roll.Result()
 	if err != nil {
 		lg.Errorf("rollout failed, error=%v", err)
 		return errors.Wrap(err, "rollout failed")
@@ -75,7 +416,7 @@ func handleRollout(ctx context.Context, logger *logrus.Logger, service *rollout.
 	if changed {
 		lg.Info("service was successfully updated")
 	} else {
-		lg.Debug("service kept unchanged")
+		lg.WithField("reason", reasonCode(task.result.Reason)).Debug("service kept unchanged")
 	}
 	return nil
 }
@@ -102,3 +443,12 @@ func chooseMetricsProvider(ctx context.Context, logger *logrus.Entry, project, r
 	logger.Debug("using Cloud Monitoring (Stackdriver) as metrics provider")
 	return stackdriver.NewProvider(ctx, project, region, svcName)
 }
+
+// reasonCode returns the code of the reason, or an empty string if there is no
+// reason.
+func reasonCode(reason *rollout.Reason) string {
+	if reason == nil {
+		return ""
+	}
+	return string(reason.Code)
+}
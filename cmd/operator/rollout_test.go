@@ -0,0 +1,254 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+// newTestLogger returns a logger that discards its output.
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+// newTestService returns a service in the given rollout state, whose stable
+// revision is name-001 and whose candidate, if any, is name-002.
+func newTestService(project, region, name string, state rollout.State) *rollout.ServiceRecord {
+	stable, candidate := name+"-001", name+"-002"
+	traffic := []*run.TrafficTarget{
+		{RevisionName: stable, Percent: 100, Tag: rollout.StableTag},
+	}
+	latest := candidate
+	annotations := map[string]string{}
+	switch state {
+	case rollout.StableState:
+		latest = stable
+	case rollout.InProgressState:
+		traffic = []*run.TrafficTarget{
+			{RevisionName: stable, Percent: 80, Tag: rollout.StableTag},
+			{RevisionName: candidate, Percent: 20, Tag: rollout.CandidateTag},
+		}
+	case rollout.FailedState:
+		annotations[rollout.LastFailedCandidateRevisionAnnotation] = candidate
+	}
+
+	return &rollout.ServiceRecord{
+		Project: project,
+		Region:  region,
+		Service: &run.Service{
+			Metadata: &run.ObjectMeta{Name: name, Annotations: annotations, Labels: map[string]string{}},
+			Spec: &run.ServiceSpec{
+				Traffic: traffic,
+				Template: &run.RevisionTemplate{
+					Spec: &run.RevisionSpec{
+						Containers: []*run.Container{{Image: "gcr.io/test/" + name + ":v2"}},
+					},
+				},
+			},
+			Status: &run.ServiceStatus{
+				Traffic:                 traffic,
+				LatestReadyRevisionName: latest,
+			},
+		},
+	}
+}
+
+func TestQueueRollouts(t *testing.T) {
+	limited := &config.Strategy{MaxConcurrentRollouts: 1}
+	unlimited := &config.Strategy{}
+
+	type service struct {
+		name     string
+		strategy *config.Strategy
+		state    rollout.State
+		// hold is "paused", "limit" or "rollback" if the candidate is held
+		// by a manual pause, a dependency or region wave, or a rollback.
+		hold string
+	}
+	var tests = []struct {
+		name        string
+		maxRollouts int
+		services    []service
+		outQueued   []string
+	}{
+		{
+			name: "no limit",
+			services: []service{
+				{"a", unlimited, rollout.InProgressState, ""},
+				{"b", unlimited, rollout.NewCandidateState, ""},
+				{"c", unlimited, rollout.NewCandidateState, ""},
+			},
+		},
+		{
+			name:        "candidates receiving traffic count as active",
+			maxRollouts: 2,
+			services: []service{
+				{"c", unlimited, rollout.NewCandidateState, ""},
+				{"a", unlimited, rollout.InProgressState, ""},
+				{"b", unlimited, rollout.NewCandidateState, ""},
+				{"d", unlimited, rollout.NewCandidateState, ""},
+			},
+			outQueued: []string{"c", "d"},
+		},
+		{
+			name:        "stable and failed services are not active",
+			maxRollouts: 1,
+			services: []service{
+				{"a", unlimited, rollout.StableState, ""},
+				{"b", unlimited, rollout.FailedState, ""},
+				{"c", unlimited, rollout.NewCandidateState, ""},
+				{"d", unlimited, rollout.NewCandidateState, ""},
+			},
+			outQueued: []string{"d"},
+		},
+		{
+			name:        "paused candidates need no slot",
+			maxRollouts: 1,
+			services: []service{
+				{"a", unlimited, rollout.NewCandidateState, "paused"},
+				{"b", unlimited, rollout.NewCandidateState, ""},
+			},
+		},
+		{
+			name:        "held candidates need no slot",
+			maxRollouts: 1,
+			services: []service{
+				{"a", unlimited, rollout.NewCandidateState, "limit"},
+				{"b", unlimited, rollout.NewCandidateState, "rollback"},
+				{"c", unlimited, rollout.NewCandidateState, ""},
+			},
+		},
+		{
+			name: "strategy limit without global limit",
+			services: []service{
+				{"a", limited, rollout.InProgressState, ""},
+				{"b", limited, rollout.NewCandidateState, ""},
+				{"c", unlimited, rollout.NewCandidateState, ""},
+			},
+			outQueued: []string{"b"},
+		},
+		{
+			name:        "global limit across strategies",
+			maxRollouts: 2,
+			services: []service{
+				{"a", limited, rollout.NewCandidateState, ""},
+				{"b", limited, rollout.NewCandidateState, ""},
+				{"c", unlimited, rollout.NewCandidateState, ""},
+				{"d", unlimited, rollout.NewCandidateState, ""},
+			},
+			outQueued: []string{"b", "d"},
+		},
+		{
+			name:        "global limit reached before strategy limit",
+			maxRollouts: 1,
+			services: []service{
+				{"a", unlimited, rollout.InProgressState, ""},
+				{"b", limited, rollout.NewCandidateState, ""},
+			},
+			outQueued: []string{"b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			cfg := &config.Config{MaxConcurrentRollouts: test.maxRollouts}
+			var tasks []*rolloutTask
+			for _, s := range test.services {
+				svc := newTestService("project", "us-east1", s.name, s.state)
+				task := &rolloutTask{service: svc, strategy: s.strategy, trafficLimit: 100}
+				switch s.hold {
+				case "paused":
+					svc.Metadata.Annotations[rollout.PausedAnnotation] = "paused"
+				case "limit":
+					task.trafficLimit = 0
+				case "rollback":
+					task.rollbackReason = "candidate failed in region us-central1"
+				}
+				tasks = append(tasks, task)
+			}
+
+			queueRollouts(newTestLogger(), cfg, tasks, tasks)
+			var queued []string
+			for _, task := range tasks {
+				if task.queued {
+					queued = append(queued, task.service.Metadata.Name)
+				}
+			}
+			assert.ElementsMatch(tt, test.outQueued, queued)
+		})
+	}
+}
+
+func TestQueueRolloutsByLevel(t *testing.T) {
+	strategy := &config.Strategy{}
+	cfg := &config.Config{MaxConcurrentRollouts: 2}
+	task := func(name string, state rollout.State) *rolloutTask {
+		svc := newTestService("project", "us-east1", name, state)
+		return &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100}
+	}
+	inProgress := task("a", rollout.InProgressState)
+	admitted := task("b", rollout.NewCandidateState)
+	backend := task("c", rollout.NewCandidateState)
+	frontend := task("d", rollout.NewCandidateState)
+	tasks := []*rolloutTask{inProgress, admitted, backend, frontend}
+
+	// The candidate admitted in the first level got traffic when the second
+	// level is queued, and the candidate of a later level takes no slot yet.
+	queueRollouts(newTestLogger(), cfg, tasks, []*rolloutTask{admitted})
+	assert.False(t, admitted.queued)
+	admitted.service.Service = newTestService("project", "us-east1", "b", rollout.InProgressState).Service
+
+	queueRollouts(newTestLogger(), cfg, tasks, []*rolloutTask{backend})
+	assert.True(t, backend.queued)
+	assert.False(t, frontend.queued)
+}
+
+func TestDedupeTasks(t *testing.T) {
+	first, second := &config.Strategy{Name: "first"}, &config.Strategy{Name: "second"}
+	task := func(region, name string, strategy *config.Strategy) *rolloutTask {
+		svc := newTestService("project", region, name, rollout.NewCandidateState)
+		return &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100}
+	}
+	tasks := []*rolloutTask{
+		task("us-east1", "a", first),
+		task("us-east1", "b", first),
+		task("us-east1", "a", second),
+		task("us-central1", "a", second),
+	}
+
+	deduped := dedupeTasks(newTestLogger(), tasks)
+	assert.Equal(t, []*rolloutTask{tasks[0], tasks[1], tasks[3]}, deduped)
+}
+
+func TestRecordPass(t *testing.T) {
+	strategy := &config.Strategy{Name: "record-pass"}
+	rolledBack := &rolloutTask{
+		service:  newTestService("project", "us-east1", "cart", rollout.InProgressState),
+		strategy: strategy,
+		// The candidate was rolled back after a member of its release group
+		// failed, so the task was handled twice during the pass.
+		result: rollout.Result{Outcome: rollout.RolledBackOutcome},
+	}
+	failed := &rolloutTask{
+		service:  newTestService("project", "us-east1", "payments", rollout.InProgressState),
+		strategy: strategy,
+		err:      errors.New("failed to update service"),
+	}
+
+	recordPass(time.Now(), []*rolloutTask{rolledBack, failed}, []error{failed.err})
+	assert.Equal(t, float64(2), testutil.ToFloat64(selfmetrics.ServicesEvaluated.WithLabelValues("record-pass")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(selfmetrics.Decisions.WithLabelValues("record-pass", string(rollout.RolledBackOutcome))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(selfmetrics.Rollbacks.WithLabelValues("record-pass")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(selfmetrics.RolloutErrors.WithLabelValues("record-pass")))
+}
@@ -1,25 +1,198 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // makeRolloutHandler creates a request handler to perform a rollout process.
-func makeRolloutHandler(logger *logrus.Logger, cfg *config.Config) http.HandlerFunc {
+//
+// If the service and region query parameters are given, only that service is
+// rolled out. The project parameter narrows the search if the strategies
+// target more than one project.
+func makeRolloutHandler(logger *logrus.Logger, cfg *config.Config, notifier notification.Notifier) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
-		// TODO(gvso): Handle all the strategies.
-		errs := runRollouts(ctx, logger, cfg.Strategies[0])
-		errsStr := rolloutErrsToString(errs)
+		query := req.URL.Query()
+		service, region := query.Get("service"), query.Get("region")
+		if (service == "") != (region == "") {
+			writeJSONError(w, http.StatusBadRequest, "service and region must be given together")
+			return
+		}
+
+		var (
+			tasks []*rolloutTask
+			errs  []error
+		)
+		if service != "" {
+			tasks, errs = runTargetedRollout(ctx, logger, cfg, query.Get("project"), region, service, notifier)
+			if len(errs) == 1 {
+				switch errors.Cause(errs[0]) {
+				case errInvalidRegion:
+					writeJSONError(w, http.StatusBadRequest, errs[0].Error())
+					return
+				case errNotTargeted:
+					writeJSONError(w, http.StatusNotFound, errs[0].Error())
+					return
+				}
+			}
+		} else {
+			tasks, errs = runRollouts(ctx, logger, cfg, notifier)
+		}
 		if len(errs) != 0 {
-			msg := fmt.Sprintf("there were %d errors: \n%s", len(errs), errsStr)
-			logger.Warn(msg)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, msg)
+			logger.Warnf("there were %d errors: \n%s", len(errs), rolloutErrsToString(errs))
+		}
+		resp := newRolloutResponse(tasks, errs)
+		writeJSON(w, resp.statusCode(), resp)
+	}
+}
+
+// makeStatusHandler creates a request handler that describes the rollout of
+// the targeted services.
+//
+// GET /status lists all the services, and GET /status/{region}/{service}
+// describes a single one. The latter accepts a project query parameter if the
+// strategies target more than one project.
+func makeStatusHandler(logger *logrus.Logger, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var region, service string
+		if path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/status"), "/"); path != "" {
+			parts := strings.Split(path, "/")
+			if len(parts) != 2 {
+				writeJSONError(w, http.StatusNotFound, "expected /status/{region}/{service}")
+				return
+			}
+			region, service = parts[0], parts[1]
+		}
+
+		if service == "" {
+			statuses, errs := getStatuses(req.Context(), logger, cfg)
+			writeJSON(w, http.StatusOK, statusResponse{Services: statuses, Errors: errs})
+			return
+		}
+
+		svc, strategy, err := findTargetedService(req.Context(), logger, cfg, req.URL.Query().Get("project"), region, service)
+		if errors.Cause(err) == errInvalidRegion {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if svc == nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("service %q is not targeted in region %q", service, region))
+			return
+		}
+		writeJSON(w, http.StatusOK, serviceStatus(svc, *strategy, time.Now()))
+	}
+}
+
+// writeJSON writes the value as the JSON response.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeJSONError writes the error message as the JSON response.
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// makeControlHandler creates a request handler to act on the rollout of a
+// service manually, with POST /control/{region}/{service}/{action}.
+//
+// Requests must be authenticated with the token as a bearer token. The
+// project query parameter selects the project if the strategies target more
+// than one.
+func makeControlHandler(logger *logrus.Logger, cfg *config.Config, token string, notifier notification.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !hasBearerToken(req, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/control"), "/"), "/")
+		if len(parts) != 3 {
+			writeJSONError(w, http.StatusNotFound, "expected /control/{region}/{service}/{action}")
+			return
+		}
+		region, service, action := parts[0], parts[1], rollout.Action(parts[2])
+		if !isAction(action) {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown action %q, must be one of %v", action, rollout.Actions))
+			return
+		}
+
+		ctx := req.Context()
+		svc, strategy, err := findTargetedService(ctx, logger, cfg, req.URL.Query().Get("project"), region, service)
+		if errors.Cause(err) == errInvalidRegion {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if svc == nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("service %q is not targeted in region %q", service, region))
+			return
+		}
+
+		resp, err := applyAction(ctx, logger, svc, strategy, action, notifier)
+		switch {
+		case rollout.IsNotApplicable(err), runapi.IsConflict(err):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		case err != nil:
+			logger.WithError(err).Warn("manual action failed")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		default:
+			writeJSON(w, http.StatusOK, resp)
+		}
+	}
+}
+
+// hasBearerToken determines if the request is authenticated with the token.
+func hasBearerToken(req *http.Request, token string) bool {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(token)) == 1
+}
+
+// isAction determines if the action is a known manual action.
+func isAction(action rollout.Action) bool {
+	for _, a := range rollout.Actions {
+		if a == action {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHandlerConfig is the configuration of the handlers under test, with a
+// strategy that targets all the regions of the project.
+var testHandlerConfig = &config.Config{
+	Strategies: []config.Strategy{{Target: config.Target{Project: "project"}}},
+}
+
+func TestRolloutHandlerRegion(t *testing.T) {
+	var tests = []struct {
+		name    string
+		url     string
+		outCode int
+	}{
+		{
+			name:    "host in region",
+			url:     "/rollout?service=hello&region=attacker.example%23",
+			outCode: http.StatusBadRequest,
+		},
+		{
+			name:    "path in region",
+			url:     "/rollout?service=hello&region=us-east1%2F..%2Fv1",
+			outCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var retrieved []string
+			defer stubGetService(nil, &retrieved)()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, test.url, nil)
+			makeRolloutHandler(newTestLogger(), testHandlerConfig, nil)(w, req)
+			assert.Equal(tt, test.outCode, w.Code)
+			assert.Contains(tt, w.Body.String(), "invalid region")
+			assert.Empty(tt, retrieved)
+		})
+	}
+}
+
+func TestStatusHandlerRegion(t *testing.T) {
+	var tests = []struct {
+		name    string
+		url     string
+		outCode int
+	}{
+		{
+			name:    "host in region",
+			url:     "/status/attacker.example%23/hello",
+			outCode: http.StatusBadRequest,
+		},
+		{
+			name:    "port in region",
+			url:     "/status/attacker.example:8080/hello",
+			outCode: http.StatusBadRequest,
+		},
+		{
+			name:    "region not targeted",
+			url:     "/status/us-east1/hello?project=other",
+			outCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var retrieved []string
+			defer stubGetService(nil, &retrieved)()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			makeStatusHandler(newTestLogger(), testHandlerConfig)(w, req)
+			assert.Equal(tt, test.outCode, w.Code)
+			assert.Empty(tt, retrieved)
+		})
+	}
+}
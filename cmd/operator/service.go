@@ -7,24 +7,32 @@ import (
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
 	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/run/v1"
 )
 
 // getTargetedServices returned a list of service records that match the target
 // configuration.
-func getTargetedServices(ctx context.Context, logger *logrus.Logger, target config.Target) ([]*rollout.ServiceRecord, error) {
+func getTargetedServices(ctx context.Context, logger *logrus.Logger, target config.Target) (retServices []*rollout.ServiceRecord, retError error) {
 	logger.Debug("querying Cloud Run API to get all targeted services")
+	ctx, span := tracing.Start(ctx, "getTargetedServices",
+		attribute.String("project", target.Project),
+		attribute.String("labelSelector", target.LabelSelector))
+	defer func() {
+		span.SetAttributes(attribute.Int64("services", int64(len(retServices))))
+		tracing.RecordError(span, retError)
+		span.End()
+	}()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	var (
-		retServices []*rollout.ServiceRecord
-		retError    error
-		mu          sync.Mutex
-		wg          sync.WaitGroup
+		mu sync.Mutex
+		wg sync.WaitGroup
 	)
 
 	regions, err := determineRegions(ctx, logger, target)
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/stackdriver"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/simulation"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// simulateResponse is the result of a simulation.
+type simulateResponse struct {
+	Strategy  string                `json:"strategy"`
+	Start     time.Time             `json:"start"`
+	End       time.Time             `json:"end"`
+	Decisions []simulation.Decision `json:"decisions"`
+}
+
+// runSimulate replays a strategy against the samples of a metrics file, or
+// against the metrics of a service in Cloud Monitoring for a past window, and
+// writes the timeline of the decisions.
+func runSimulate(ctx context.Context, env commandEnv, opts commandOptions, args []string) error {
+	if len(args) > 1 {
+		return errors.Errorf("expected at most a metrics file, got %d arguments", len(args))
+	}
+	strategy, err := findStrategy(env.cfg, opts.strategy)
+	if err != nil {
+		return err
+	}
+	start, err := parseOptionalTime("-start", opts.start)
+	if err != nil {
+		return err
+	}
+	end, err := parseOptionalTime("-end", opts.end)
+	if err != nil {
+		return err
+	}
+
+	var provider metrics.Provider
+	var clock clockwork.FakeClock
+	if len(args) == 1 {
+		series, err := readSeries(args[0])
+		if err != nil {
+			return err
+		}
+		if start.IsZero() {
+			start = series.Start()
+		}
+		if end.IsZero() {
+			end = series.End()
+		}
+		clock = clockwork.NewFakeClockAt(start)
+		provider = series.WithClock(clock)
+	} else {
+		if opts.service == "" || opts.region == "" || start.IsZero() || end.IsZero() {
+			return errors.New("without a metrics file, -service, -region, -start and -end must be specified to query Cloud Monitoring")
+		}
+		project := opts.project
+		if project == "" {
+			project = strategy.Target.Project
+		}
+		if project == "" {
+			project = flProject
+		}
+		clock = clockwork.NewFakeClockAt(start)
+		sd, err := stackdriver.NewProvider(ctx, project, opts.region, opts.service)
+		if err != nil {
+			return errors.Wrap(err, "failed to initialize metrics provider")
+		}
+		provider = sd.WithClock(clock)
+		ctx = util.ContextWithLogger(ctx, logrus.NewEntry(env.logger))
+	}
+	if end.Before(start) {
+		return errors.Errorf("end %s is before start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+
+	sim := simulation.New(strategy, provider, clock).WithInterval(opts.interval)
+	if env.logger.IsLevelEnabled(logrus.DebugLevel) {
+		sim = sim.WithLogger(env.logger)
+	}
+	decisions, err := sim.Run(ctx, end)
+	if err != nil {
+		return err
+	}
+
+	resp := simulateResponse{
+		Strategy:  strategy.DisplayName(),
+		Start:     start,
+		End:       end,
+		Decisions: simulation.Timeline(decisions),
+	}
+	return writeOutput(os.Stdout, opts.output, resp, func(w io.Writer) {
+		writeTimeline(w, resp)
+	})
+}
+
+// findStrategy returns the strategy with the name, which can be omitted if
+// the configuration has a single strategy.
+func findStrategy(cfg *config.Config, name string) (config.Strategy, error) {
+	var names []string
+	for _, strategy := range cfg.Strategies {
+		if strategy.DisplayName() == name || (name == "" && len(cfg.Strategies) == 1) {
+			return strategy, nil
+		}
+		names = append(names, strategy.DisplayName())
+	}
+	if name == "" {
+		return config.Strategy{}, errors.Errorf("-strategy must be one of %v", names)
+	}
+	return config.Strategy{}, errors.Errorf("unknown strategy %q, must be one of %v", name, names)
+}
+
+// parseOptionalTime parses the RFC3339 time of the flag, if set.
+func parseOptionalTime(flagName, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, errors.Wrapf(err, "invalid %s", flagName)
+}
+
+// readSeries reads the samples of the metrics file, whose format is given by
+// its extension.
+func readSeries(path string) (*simulation.Series, error) {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if format != simulation.CSVFormat && format != simulation.JSONFormat {
+		return nil, errors.Errorf("metrics file %q must have a .%s or .%s extension", path, simulation.CSVFormat, simulation.JSONFormat)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open metrics file")
+	}
+	defer f.Close()
+	samples, err := simulation.ReadSamples(f, format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read metrics file %q", path)
+	}
+	if len(samples) == 0 {
+		return nil, errors.Errorf("metrics file %q has no samples", path)
+	}
+	return simulation.NewSeries(samples), nil
+}
+
+// writeTimeline writes a line for each decision of the simulation, followed by
+// its outcome.
+func writeTimeline(w io.Writer, resp simulateResponse) {
+	fmt.Fprintln(w, "TIME\tELAPSED\tACTION\tCANDIDATE\tDIAGNOSIS\tREASON")
+	for _, d := range resp.Decisions {
+		var diagnosis, reason string
+		if d.Diagnosis != nil {
+			diagnosis = d.Diagnosis.Result
+		}
+		if d.Reason != nil {
+			reason = d.Reason.Message
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d%%\t%s\t%s\n", d.Time.Format(time.RFC3339), d.Time.Sub(resp.Start), d.Outcome,
+			d.CandidatePercent, orDash(diagnosis), orDash(reason))
+	}
+
+	if len(resp.Decisions) == 0 {
+		fmt.Fprintln(w, "\nNo rollout pass was simulated.")
+		return
+	}
+	last := resp.Decisions[len(resp.Decisions)-1]
+	switch last.Outcome {
+	case rollout.PromotedOutcome:
+		fmt.Fprintf(w, "\nThe candidate would have been promoted after %s.\n", last.Time.Sub(resp.Start))
+	case rollout.RolledBackOutcome:
+		fmt.Fprintf(w, "\nThe candidate would have been rolled back after %s.\n", last.Time.Sub(resp.Start))
+	default:
+		fmt.Fprintf(w, "\nThe candidate would still be at %d%% of the traffic at the end, after %s.\n", last.CandidatePercent, resp.End.Sub(resp.Start))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/sirupsen/logrus"
+)
+
+// rolloutErrors holds the error of the last rollout of each service handled
+// by this instance.
+var rolloutErrors = &errorLog{errs: make(map[string]string)}
+
+// errorLog records the last rollout error of each service.
+type errorLog struct {
+	mu   sync.Mutex
+	errs map[string]string
+}
+
+// record sets or, if err is nil, clears the error of the service.
+func (l *errorLog) record(svc *rollout.ServiceRecord, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := serviceKey(svc.Project, svc.Region, svc.Metadata.Name)
+	if err == nil {
+		delete(l.errs, key)
+		return
+	}
+	l.errs[key] = err.Error()
+}
+
+// get returns the last error of the service, if any.
+func (l *errorLog) get(svc *rollout.ServiceRecord) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.errs[serviceKey(svc.Project, svc.Region, svc.Metadata.Name)]
+}
+
+// statusResponse is the response of the status endpoint listing all services.
+type statusResponse struct {
+	Services []rollout.Status `json:"services"`
+	Errors   []string         `json:"errors,omitempty"`
+}
+
+// getStatuses returns the rollout status of the services targeted by all the
+// strategies, sorted by project, region and service name, and the errors that
+// prevented listing some of them.
+func getStatuses(ctx context.Context, logger *logrus.Logger, cfg *config.Config) ([]rollout.Status, []string) {
+	var (
+		statuses []rollout.Status
+		errs     []string
+		seen     = make(map[string]bool)
+		now      = time.Now()
+	)
+	for i := range cfg.Strategies {
+		strategy := cfg.Strategies[i]
+		svcs, err := getTargetedServices(ctx, logger, strategy.Target)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to get services targeted by strategy %q: %v", strategy.DisplayName(), err))
+			continue
+		}
+		for _, svc := range svcs {
+			key := serviceKey(svc.Project, svc.Region, svc.Metadata.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			statuses = append(statuses, serviceStatus(svc, strategy, now))
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Service < b.Service
+	})
+	return statuses, errs
+}
+
+// serviceStatus returns the rollout status of the service, along with the
+// error of its last rollout by this instance.
+func serviceStatus(svc *rollout.ServiceRecord, strategy config.Strategy, now time.Time) rollout.Status {
+	status := rollout.NewStatus(svc, strategy, now)
+	if err := rolloutErrors.get(svc); err != "" {
+		status.Errors = append(status.Errors, err)
+	}
+	return status
+}
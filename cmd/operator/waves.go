@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// waveOf returns the position of the region in the rollout waves. The canary
+// region is at position 0 and regions not listed are placed after all waves.
+func waveOf(waves *config.RegionWaves, region string) int {
+	if region == waves.Canary {
+		return 0
+	}
+	for i, wave := range waves.Waves {
+		for _, r := range wave {
+			if r == region {
+				return i + 1
+			}
+		}
+	}
+	return len(waves.Waves) + 1
+}
+
+// releaseTasks returns the tasks for the same service as the given task in
+// other regions, handled by the same strategy.
+func releaseTasks(task *rolloutTask, tasks []*rolloutTask) []*rolloutTask {
+	var ret []*rolloutTask
+	for _, t := range tasks {
+		if t == task || t.strategy != task.strategy ||
+			t.service.Project != task.service.Project ||
+			t.service.Metadata.Name != task.service.Metadata.Name {
+			continue
+		}
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+// earlierWaveTasks returns the tasks for the same service in regions that are
+// rolled out in earlier waves than the task's region.
+func earlierWaveTasks(task *rolloutTask, tasks []*rolloutTask) []*rolloutTask {
+	waves := task.strategy.RegionWaves
+	if waves == nil {
+		return nil
+	}
+
+	var ret []*rolloutTask
+	wave := waveOf(waves, task.service.Region)
+	for _, t := range releaseTasks(task, tasks) {
+		if waveOf(waves, t.service.Region) < wave {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// releaseID identifies the release deployed to the service based on the
+// container images of its latest revision template.
+func releaseID(svc *run.Service) string {
+	if svc.Spec == nil || svc.Spec.Template == nil || svc.Spec.Template.Spec == nil {
+		return ""
+	}
+
+	var images []string
+	for _, container := range svc.Spec.Template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// applyWaves keeps the task's candidate from receiving traffic until the same
+// release is fully promoted in all the regions of earlier waves.
+//
+// If the strategy rolls back all regions and the release failed in any other
+// region, the task's candidate is rolled back too. Regions where the release
+// was already promoted are not rolled back.
+func applyWaves(logger *logrus.Logger, task *rolloutTask, tasks []*rolloutTask) {
+	waves := task.strategy.RegionWaves
+	state := rollout.DetectState(task.service.Service)
+	if waves == nil || (state != rollout.NewCandidateState && state != rollout.InProgressState) {
+		return
+	}
+	release := releaseID(task.service.Service)
+	lg := logger.WithFields(logrus.Fields{
+		"service": task.service.Metadata.Name,
+		"region":  task.service.Region,
+	})
+
+	if waves.RollbackAll {
+		for _, t := range releaseTasks(task, tasks) {
+			if rollout.DetectState(t.service.Service) == rollout.FailedState && releaseID(t.service.Service) == release {
+				task.rollbackReason = fmt.Sprintf("candidate failed in region %s", t.service.Region)
+				lg.Info(task.rollbackReason)
+				return
+			}
+		}
+	}
+
+	var waitingFor []string
+	for _, t := range earlierWaveTasks(task, tasks) {
+		if rollout.DetectState(t.service.Service) != rollout.StableState || releaseID(t.service.Service) != release {
+			waitingFor = append(waitingFor, t.service.Region)
+		}
+	}
+	if len(waitingFor) != 0 {
+		task.trafficLimit = 0
+		task.limitReason = fmt.Sprintf("waiting for release to be fully promoted in %s", strings.Join(waitingFor, ", "))
+		lg.Debug(task.limitReason)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWaves rolls out to us-central1, then us-east1 and europe-west1, then
+// asia-east1. Other regions are rolled out last.
+var testWaves = &config.RegionWaves{
+	Canary: "us-central1",
+	Waves:  [][]string{{"us-east1", "europe-west1"}, {"asia-east1"}},
+}
+
+// newWaveTasks returns the tasks of the same service in the regions, with the
+// given rollout states.
+func newWaveTasks(strategy *config.Strategy, states map[string]rollout.State) map[string]*rolloutTask {
+	tasks := make(map[string]*rolloutTask)
+	for region, state := range states {
+		svc := newTestService("project", region, "test", state)
+		tasks[region] = &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100}
+	}
+	return tasks
+}
+
+func TestOrderTasksWithWaves(t *testing.T) {
+	strategy := &config.Strategy{RegionWaves: testWaves}
+	regions := []string{"us-west1", "asia-east1", "europe-west1", "us-east1", "us-central1"}
+	var tasks []*rolloutTask
+	for _, region := range regions {
+		svc := newTestService("project", region, "test", rollout.NewCandidateState)
+		tasks = append(tasks, &rolloutTask{service: svc, strategy: strategy, trafficLimit: 100})
+	}
+	// Another service of the strategy is not held by the waves of "test".
+	other := newTestService("project", "asia-east1", "other", rollout.NewCandidateState)
+	tasks = append(tasks, &rolloutTask{service: other, strategy: strategy, trafficLimit: 100})
+
+	var levels [][]string
+	for _, level := range orderTasks(newTestLogger(), tasks) {
+		var names []string
+		for _, task := range level {
+			names = append(names, task.service.Metadata.Name+"@"+task.service.Region)
+		}
+		levels = append(levels, names)
+	}
+	assert.Equal(t, [][]string{
+		{"test@us-central1", "other@asia-east1"},
+		{"test@europe-west1", "test@us-east1"},
+		{"test@asia-east1"},
+		{"test@us-west1"},
+	}, levels)
+}
+
+func TestApplyWaves(t *testing.T) {
+	var tests = []struct {
+		name              string
+		region            string
+		states            map[string]rollout.State
+		olderRelease      []string
+		rollbackAll       bool
+		outTrafficLimit   int64
+		outLimitReason    string
+		outRollbackReason string
+	}{
+		{
+			name:   "canary region is not held",
+			region: "us-central1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.NewCandidateState,
+				"us-east1":    rollout.NewCandidateState,
+			},
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "first wave waits for the canary region",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.InProgressState,
+				"us-east1":    rollout.NewCandidateState,
+			},
+			outTrafficLimit: 0,
+			outLimitReason:  "waiting for release to be fully promoted in us-central1",
+		},
+		{
+			name:   "first wave after the canary region is promoted",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.StableState,
+				"us-east1":    rollout.NewCandidateState,
+			},
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "canary region promoted an older release",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.StableState,
+				"us-east1":    rollout.InProgressState,
+			},
+			olderRelease:    []string{"us-central1"},
+			outTrafficLimit: 0,
+			outLimitReason:  "waiting for release to be fully promoted in us-central1",
+		},
+		{
+			name:   "second wave waits for all the regions of the first wave",
+			region: "asia-east1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.StableState,
+				"europe-west1": rollout.InProgressState,
+				"asia-east1":   rollout.NewCandidateState,
+			},
+			outTrafficLimit: 0,
+			outLimitReason:  "waiting for release to be fully promoted in europe-west1",
+		},
+		{
+			name:   "second wave after the first wave is promoted",
+			region: "asia-east1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.StableState,
+				"europe-west1": rollout.StableState,
+				"asia-east1":   rollout.NewCandidateState,
+			},
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "unlisted region waits for the last wave",
+			region: "us-west1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.StableState,
+				"europe-west1": rollout.StableState,
+				"asia-east1":   rollout.InProgressState,
+				"us-west1":     rollout.NewCandidateState,
+			},
+			outTrafficLimit: 0,
+			outLimitReason:  "waiting for release to be fully promoted in asia-east1",
+		},
+		{
+			name:   "unlisted region after all the waves are promoted",
+			region: "us-west1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.StableState,
+				"europe-west1": rollout.StableState,
+				"asia-east1":   rollout.StableState,
+				"us-west1":     rollout.NewCandidateState,
+			},
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "failure in another region without rollback of all regions",
+			region: "us-central1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.InProgressState,
+				"us-east1":    rollout.FailedState,
+			},
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "failure in another region with rollback of all regions",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.InProgressState,
+				"europe-west1": rollout.FailedState,
+			},
+			rollbackAll:       true,
+			outTrafficLimit:   100,
+			outRollbackReason: "candidate failed in region europe-west1",
+		},
+		{
+			name:   "failure of an older release with rollback of all regions",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1":  rollout.StableState,
+				"us-east1":     rollout.InProgressState,
+				"europe-west1": rollout.FailedState,
+			},
+			olderRelease:    []string{"europe-west1"},
+			rollbackAll:     true,
+			outTrafficLimit: 100,
+		},
+		{
+			name:   "stable service is not held",
+			region: "us-east1",
+			states: map[string]rollout.State{
+				"us-central1": rollout.InProgressState,
+				"us-east1":    rollout.StableState,
+			},
+			outTrafficLimit: 100,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			waves := *testWaves
+			waves.RollbackAll = test.rollbackAll
+			strategy := &config.Strategy{RegionWaves: &waves}
+			byRegion := newWaveTasks(strategy, test.states)
+			for _, region := range test.olderRelease {
+				byRegion[region].service.Spec.Template.Spec.Containers[0].Image = "gcr.io/test/test:v1"
+			}
+			var tasks []*rolloutTask
+			for _, task := range byRegion {
+				tasks = append(tasks, task)
+			}
+
+			task := byRegion[test.region]
+			applyWaves(newTestLogger(), task, tasks)
+			assert.Equal(tt, test.outTrafficLimit, task.trafficLimit)
+			assert.Equal(tt, test.outLimitReason, task.limitReason)
+			assert.Equal(tt, test.outRollbackReason, task.rollbackReason)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package auditlog decodes the Cloud Audit Logs of Cloud Run deployments, as
+// delivered by Eventarc.
+package auditlog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Methods whose audit logs indicate that a service might have a new revision.
+// They are matched regardless of the API version in the full method name,
+// e.g. google.cloud.run.v1.Services.ReplaceService.
+const (
+	ReplaceServiceMethod = "ReplaceService"
+	CreateRevisionMethod = "CreateRevision"
+)
+
+// structuredContentType is the content type of CloudEvents in structured mode.
+const structuredContentType = "application/cloudevents+json"
+
+// maxBodySize is the maximum size of an event.
+const maxBodySize = 1 << 20
+
+// Entry is the subset of an audit log entry that identifies the deployment.
+type Entry struct {
+	ProtoPayload Payload  `json:"protoPayload"`
+	Resource     Resource `json:"resource"`
+}
+
+// Payload is the audit log of the API call.
+type Payload struct {
+	MethodName         string             `json:"methodName"`
+	ResourceName       string             `json:"resourceName"`
+	AuthenticationInfo AuthenticationInfo `json:"authenticationInfo"`
+	RequestMetadata    RequestMetadata    `json:"requestMetadata"`
+	Status             *Status            `json:"status"`
+}
+
+// AuthenticationInfo identifies the caller.
+type AuthenticationInfo struct {
+	PrincipalEmail string `json:"principalEmail"`
+}
+
+// RequestMetadata describes the request made by the caller.
+type RequestMetadata struct {
+	CallerSuppliedUserAgent string `json:"callerSuppliedUserAgent"`
+}
+
+// Status is the status of the API call. A zero code means success.
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Resource is the monitored resource the entry is about.
+type Resource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Deployment identifies the service that was deployed.
+type Deployment struct {
+	Project   string
+	Region    string
+	Service   string
+	Method    string
+	Principal string
+}
+
+// Decode reads the audit log entry from an Eventarc request.
+//
+// Both the binary mode, where the body is the entry, and the structured mode,
+// where the entry is the data of the event, are supported.
+func Decode(req *http.Request) (*Entry, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, maxBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read event")
+	}
+
+	data := body
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == structuredContentType {
+		var event struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, errors.Wrap(err, "failed to decode structured event")
+		}
+		data = event.Data
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, errors.Wrap(err, "failed to decode audit log entry")
+	}
+	return &entry, nil
+}
+
+// Deployment returns the service deployed by the call the entry is about.
+//
+// If the call is not a successful deployment of a Cloud Run service, the
+// reason why it is not is returned instead.
+func (e *Entry) Deployment() (*Deployment, string) {
+	payload := e.ProtoPayload
+	method := payload.MethodName
+	if i := strings.LastIndex(method, "."); i >= 0 {
+		method = method[i+1:]
+	}
+	if method != ReplaceServiceMethod && method != CreateRevisionMethod {
+		return nil, "not a deployment: " + payload.MethodName
+	}
+	if payload.Status != nil && payload.Status.Code != 0 {
+		return nil, "deployment failed: " + payload.Status.Message
+	}
+
+	d := &Deployment{
+		Project:   e.Resource.Labels["project_id"],
+		Region:    e.Resource.Labels["location"],
+		Service:   e.Resource.Labels["service_name"],
+		Method:    method,
+		Principal: payload.AuthenticationInfo.PrincipalEmail,
+	}
+	// The resource name is namespaces/{project}/services/{service}.
+	parts := strings.Split(payload.ResourceName, "/")
+	if d.Service == "" && len(parts) == 4 && parts[2] == "services" {
+		d.Service = parts[3]
+	}
+	if d.Project == "" && len(parts) == 4 {
+		d.Project = parts[1]
+	}
+	if d.Project == "" || d.Region == "" || d.Service == "" {
+		return nil, "missing project, region or service"
+	}
+	return d, ""
+}
+
+// CalledBy determines if the call was made by a client with the user agent.
+func (e *Entry) CalledBy(userAgent string) bool {
+	return strings.Contains(e.ProtoPayload.RequestMetadata.CallerSuppliedUserAgent, userAgent)
+}
@@ -0,0 +1,140 @@
+package auditlog_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/auditlog"
+	"github.com/stretchr/testify/assert"
+)
+
+const replaceService = `{
+  "protoPayload": {
+    "methodName": "google.cloud.run.v1.Services.ReplaceService",
+    "resourceName": "namespaces/myproject/services/hello",
+    "authenticationInfo": {"principalEmail": "deployer@myproject.iam.gserviceaccount.com"},
+    "requestMetadata": {"callerSuppliedUserAgent": "google-cloud-sdk gcloud/305.0.0"}
+  },
+  "resource": {
+    "type": "cloud_run_revision",
+    "labels": {"project_id": "myproject", "location": "us-east1", "service_name": "hello"}
+  }
+}`
+
+func TestDecode(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		body        string
+		outMethod   string
+		shouldErr   bool
+	}{
+		{
+			name:        "binary mode",
+			contentType: "application/json; charset=utf-8",
+			body:        replaceService,
+			outMethod:   "google.cloud.run.v1.Services.ReplaceService",
+		},
+		{
+			name:        "structured mode",
+			contentType: "application/cloudevents+json",
+			body:        `{"specversion": "1.0", "type": "google.cloud.audit.log.v1.written", "data": ` + replaceService + `}`,
+			outMethod:   "google.cloud.run.v1.Services.ReplaceService",
+		},
+		{
+			name:      "invalid JSON",
+			body:      `{"protoPayload":`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			req := httptest.NewRequest("POST", "/events", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+
+			entry, err := auditlog.Decode(req)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outMethod, entry.ProtoPayload.MethodName)
+		})
+	}
+}
+
+func TestDeployment(t *testing.T) {
+	entry := func(method, resourceName string, labels map[string]string, status *auditlog.Status) *auditlog.Entry {
+		return &auditlog.Entry{
+			ProtoPayload: auditlog.Payload{
+				MethodName:         method,
+				ResourceName:       resourceName,
+				AuthenticationInfo: auditlog.AuthenticationInfo{PrincipalEmail: "deployer@example.com"},
+				Status:             status,
+			},
+			Resource: auditlog.Resource{Labels: labels},
+		}
+	}
+	labels := map[string]string{"project_id": "myproject", "location": "us-east1", "service_name": "hello"}
+
+	var tests = []struct {
+		name          string
+		entry         *auditlog.Entry
+		outDeployment *auditlog.Deployment
+	}{
+		{
+			name:  "replace service",
+			entry: entry("google.cloud.run.v1.Services.ReplaceService", "namespaces/myproject/services/hello", labels, nil),
+			outDeployment: &auditlog.Deployment{
+				Project: "myproject", Region: "us-east1", Service: "hello",
+				Method: auditlog.ReplaceServiceMethod, Principal: "deployer@example.com",
+			},
+		},
+		{
+			name:  "create revision",
+			entry: entry("google.cloud.run.v1.Revisions.CreateRevision", "namespaces/myproject/revisions/hello-002", labels, &auditlog.Status{}),
+			outDeployment: &auditlog.Deployment{
+				Project: "myproject", Region: "us-east1", Service: "hello",
+				Method: auditlog.CreateRevisionMethod, Principal: "deployer@example.com",
+			},
+		},
+		{
+			name:  "service from resource name",
+			entry: entry("google.cloud.run.v1.Services.ReplaceService", "namespaces/myproject/services/hello", map[string]string{"location": "us-east1"}, nil),
+			outDeployment: &auditlog.Deployment{
+				Project: "myproject", Region: "us-east1", Service: "hello",
+				Method: auditlog.ReplaceServiceMethod, Principal: "deployer@example.com",
+			},
+		},
+		{
+			name:  "not a deployment",
+			entry: entry("google.cloud.run.v1.Services.DeleteService", "namespaces/myproject/services/hello", labels, nil),
+		},
+		{
+			name:  "failed deployment",
+			entry: entry("google.cloud.run.v1.Services.ReplaceService", "namespaces/myproject/services/hello", labels, &auditlog.Status{Code: 7, Message: "permission denied"}),
+		},
+		{
+			name:  "missing region",
+			entry: entry("google.cloud.run.v1.Services.ReplaceService", "namespaces/myproject/services/hello", nil, nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			deployment, reason := test.entry.Deployment()
+			assert.Equal(tt, test.outDeployment, deployment)
+			assert.Equal(tt, test.outDeployment == nil, reason != "")
+		})
+	}
+}
+
+func TestCalledBy(t *testing.T) {
+	entry := &auditlog.Entry{ProtoPayload: auditlog.Payload{
+		RequestMetadata: auditlog.RequestMetadata{CallerSuppliedUserAgent: "cloud-run-release-manager google-api-go-client/0.5,gzip(gfe)"},
+	}}
+	assert.True(t, entry.CalledBy("cloud-run-release-manager"))
+	assert.False(t, entry.CalledBy("gcloud"))
+}
@@ -0,0 +1,98 @@
+// Package auth verifies the Google-signed OIDC ID tokens of requests.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+)
+
+// ErrNotAllowed is the cause of the error returned for valid tokens of
+// service accounts that are not in the allowlist.
+var ErrNotAllowed = errors.New("service account is not allowed")
+
+// Verifier verifies ID tokens for an audience, issued to an allowlist of
+// service accounts.
+type Verifier struct {
+	audience        string
+	serviceAccounts map[string]bool
+	validator       *idtoken.Validator
+}
+
+// New initializes a verifier of Google-signed ID tokens with the audience and
+// service accounts in the configuration.
+//
+// Google's signing keys are fetched with an HTTP client with a timeout, unless
+// the options specify another one.
+func New(ctx context.Context, cfg config.Authentication, opts ...option.ClientOption) (*Verifier, error) {
+	opts = append([]option.ClientOption{option.WithHTTPClient(&http.Client{Timeout: 10 * time.Second})}, opts...)
+	validator, err := idtoken.NewValidator(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize ID token validator")
+	}
+	accounts := make(map[string]bool, len(cfg.ServiceAccounts))
+	for _, email := range cfg.ServiceAccounts {
+		accounts[strings.ToLower(email)] = true
+	}
+	return &Verifier{
+		audience:        cfg.Audience,
+		serviceAccounts: accounts,
+		validator:       validator,
+	}, nil
+}
+
+// Verify checks the signature and claims of the ID token, and returns the
+// email of the service account it was issued to.
+//
+// The token must be signed by Google for the audience, not expired, and its
+// verified email must be one of the service accounts.
+func (v *Verifier) Verify(ctx context.Context, token string) (string, error) {
+	payload, err := v.validator.Validate(ctx, token, v.audience)
+	if err != nil {
+		return "", err
+	}
+	email, _ := payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); !verified {
+		return "", errors.New("token email is not verified")
+	}
+	if !v.serviceAccounts[strings.ToLower(email)] {
+		return "", errors.Wrap(ErrNotAllowed, email)
+	}
+	return email, nil
+}
+
+// Middleware returns a handler that only calls the next handler if the
+// request has a valid ID token as a bearer token.
+func (v *Verifier) Middleware(logger *logrus.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		const prefix = "Bearer "
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, prefix) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing ID token", http.StatusUnauthorized)
+			return
+		}
+
+		email, err := v.Verify(req.Context(), strings.TrimPrefix(auth, prefix))
+		if errors.Cause(err) == ErrNotAllowed {
+			logger.WithError(err).Warn("rejected request from service account not allowed")
+			http.Error(w, "service account not allowed", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Warn("rejected request with invalid ID token")
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "invalid ID token", http.StatusUnauthorized)
+			return
+		}
+		logger.WithField("email", email).Debug("authenticated request")
+		next.ServeHTTP(w, req)
+	})
+}
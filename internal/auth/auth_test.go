@@ -0,0 +1,240 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/auth"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+const (
+	testAudience = "https://release-manager-abc-uc.a.run.app"
+	testAccount  = "scheduler@myproject.iam.gserviceaccount.com"
+)
+
+// signToken returns a JWT with the header and claims signed with the key.
+func signToken(t *testing.T, key *rsa.PrivateKey, hdr, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(hdr) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// keysTransport serves the public keys as a JWKS for every request, in place
+// of Google's certificates endpoint.
+type keysTransport struct {
+	keys map[string]*rsa.PrivateKey
+}
+
+func (k keysTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var set []map[string]string
+	for id, key := range k.keys {
+		set = append(set, map[string]string{
+			"kid": id,
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(rec).Encode(map[string]interface{}{"keys": set})
+	return rec.Result(), nil
+}
+
+// newTestVerifier returns a verifier of tokens signed with the keys.
+func newTestVerifier(t *testing.T, keys map[string]*rsa.PrivateKey) *auth.Verifier {
+	client := &http.Client{Transport: keysTransport{keys: keys}}
+	cfg := config.Authentication{Audience: testAudience, ServiceAccounts: []string{testAccount}}
+	verifier, err := auth.New(context.Background(), cfg, option.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            testAudience,
+			"email":          testAccount,
+			"email_verified": true,
+			"iat":            now.Add(-time.Minute).Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+		}
+	}
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "key1"}
+
+	var tests = []struct {
+		name       string
+		header     map[string]interface{}
+		claims     map[string]interface{}
+		signingKey *rsa.PrivateKey
+		shouldErr  bool
+		notAllowed bool
+	}{
+		{
+			name:   "valid token",
+			header: rs256,
+			claims: validClaims(),
+		},
+		{
+			name:   "email in another case",
+			header: rs256,
+			claims: withClaim("email", "Scheduler@myproject.iam.gserviceaccount.com"),
+		},
+		{
+			name:       "wrong signing key",
+			header:     rs256,
+			claims:     validClaims(),
+			signingKey: otherKey,
+			shouldErr:  true,
+		},
+		{
+			name:      "unknown key ID",
+			header:    map[string]interface{}{"alg": "RS256", "kid": "key2"},
+			claims:    validClaims(),
+			shouldErr: true,
+		},
+		{
+			name:      "unsigned token",
+			header:    map[string]interface{}{"alg": "none", "kid": "key1"},
+			claims:    validClaims(),
+			shouldErr: true,
+		},
+		{
+			name:      "wrong audience",
+			header:    rs256,
+			claims:    withClaim("aud", "https://other.a.run.app"),
+			shouldErr: true,
+		},
+		{
+			name:      "expired",
+			header:    rs256,
+			claims:    withClaim("exp", now.Add(-2*time.Minute).Unix()),
+			shouldErr: true,
+		},
+		{
+			name:      "unverified email",
+			header:    rs256,
+			claims:    withClaim("email_verified", false),
+			shouldErr: true,
+		},
+		{
+			name:       "service account not allowed",
+			header:     rs256,
+			claims:     withClaim("email", "intruder@otherproject.iam.gserviceaccount.com"),
+			shouldErr:  true,
+			notAllowed: true,
+		},
+	}
+
+	verifier := newTestVerifier(t, map[string]*rsa.PrivateKey{"key1": key})
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			signingKey := key
+			if test.signingKey != nil {
+				signingKey = test.signingKey
+			}
+			token := signToken(tt, signingKey, test.header, test.claims)
+
+			email, err := verifier.Verify(context.Background(), token)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				assert.Equal(tt, test.notAllowed, errors.Cause(err) == auth.ErrNotAllowed)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.claims["email"], email)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, map[string]*rsa.PrivateKey{"key1": key})
+	token := func(email string) string {
+		return signToken(t, key, map[string]interface{}{"alg": "RS256", "kid": "key1"}, map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            testAudience,
+			"email":          email,
+			"email_verified": true,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		})
+	}
+
+	var tests = []struct {
+		name          string
+		authorization string
+		outCode       int
+	}{
+		{name: "no token", outCode: http.StatusUnauthorized},
+		{name: "invalid token", authorization: "Bearer abc", outCode: http.StatusUnauthorized},
+		{name: "not allowed", authorization: "Bearer " + token("intruder@example.com"), outCode: http.StatusForbidden},
+		{name: "allowed", authorization: "Bearer " + token(testAccount), outCode: http.StatusOK},
+	}
+
+	logger := logrus.New()
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var called bool
+			handler := verifier.Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/rollout", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(tt, test.outCode, rec.Code)
+			assert.Equal(tt, test.outCode == http.StatusOK, called)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -26,31 +28,248 @@ const (
 //   "labelSelector": "team=backend"
 // }
 type Target struct {
-	Project       string
-	Regions       []string
-	LabelSelector string
+	Project       string   `json:"project"`
+	Regions       []string `json:"regions"`
+	LabelSelector string   `json:"labelSelector"`
 }
 
 // HealthCriterion is a metrics threshold that should be met to consider a
 // candidate healthy.
 type HealthCriterion struct {
-	Metric     MetricsCheck
-	Percentile float64
-	Threshold  float64
+	Metric     MetricsCheck `json:"metric"`
+	Percentile float64      `json:"percentile"`
+	Threshold  float64      `json:"threshold"`
 }
 
 // Strategy is a rollout configuration for the targeted services.
 type Strategy struct {
-	Target              Target
-	Steps               []int64
-	HealthCriteria      []HealthCriterion
-	HealthCheckOffset   time.Duration
-	TimeBetweenRollouts time.Duration
+	// Name identifies the strategy in rollout events. It is optional.
+	Name string `json:"name"`
+
+	Target              Target            `json:"target"`
+	Steps               []int64           `json:"steps"`
+	HealthCriteria      []HealthCriterion `json:"healthCriteria"`
+	HealthCheckOffset   time.Duration     `json:"healthCheckOffset"`
+	TimeBetweenRollouts time.Duration     `json:"timeBetweenRollouts"`
+
+	// MaxConcurrentRollouts is the maximum number of targeted services whose
+	// candidate can receive traffic at the same time. Zero means no limit.
+	MaxConcurrentRollouts int `json:"maxConcurrentRollouts"`
+
+	// Dependencies are ordering constraints between the targeted services.
+	Dependencies []Dependency `json:"dependencies"`
+
+	// RegionWaves, if set, rolls out a service across regions as a single
+	// release.
+	RegionWaves *RegionWaves `json:"regionWaves"`
+}
+
+// RegionWaves configures the rollout of the same service across regions.
+//
+// The candidate is fully rolled out in the canary region first, then in each
+// wave of regions in order. Regions not listed are rolled out last.
+type RegionWaves struct {
+	Canary string     `json:"canary"`
+	Waves  [][]string `json:"waves"`
+
+	// RollbackAll makes the candidate be rolled back in every region if it is
+	// unhealthy in any of them.
+	RollbackAll bool `json:"rollbackAll"`
+}
+
+// Dependency is an ordering constraint between two services in the same
+// project and region.
+//
+// The candidate of Service cannot get more than MaxPercent of the traffic
+// until the candidate of DependsOn has been fully promoted.
+type Dependency struct {
+	Service    string `json:"service"`
+	DependsOn  string `json:"dependsOn"`
+	MaxPercent int64  `json:"maxPercent"`
+}
+
+// ReleaseGroup is a set of services, in the same project and region, whose
+// candidates are deployed together and must be rolled back together.
+type ReleaseGroup struct {
+	Name     string   `json:"name"`
+	Services []string `json:"services"`
 }
 
 // Config contains the configuration for the application.
 type Config struct {
-	Strategies []Strategy
+	Strategies    []Strategy     `json:"strategies"`
+	ReleaseGroups []ReleaseGroup `json:"releaseGroups"`
+
+	// MaxConcurrentRollouts is the maximum number of services across all
+	// strategies whose candidate can receive traffic at the same time. Zero
+	// means no limit.
+	MaxConcurrentRollouts int `json:"maxConcurrentRollouts"`
+
+	// PubSubTopic is the topic, in the form projects/{project}/topics/{topic},
+	// where rollout events are published. Empty disables publishing.
+	PubSubTopic string `json:"pubsubTopic"`
+
+	// Slack configures the messages posted to Slack-compatible incoming
+	// webhooks. Nil disables them.
+	Slack *Slack `json:"slack"`
+
+	// Webhooks are endpoints where rollout events are posted as signed JSON.
+	Webhooks []Webhook `json:"webhooks"`
+
+	// CloudEvents are endpoints where rollout events are sent as CloudEvents.
+	CloudEvents []CloudEventsSink `json:"cloudEvents"`
+
+	// GitHub configures the deployment statuses reported to GitHub. Nil
+	// disables them.
+	GitHub *GitHub `json:"github"`
+
+	// Incidents configures the alerts opened when a candidate is rolled back.
+	// Nil disables them.
+	Incidents *Incidents `json:"incidents"`
+
+	// Control configures the HTTP endpoints to act on rollouts manually. Nil
+	// disables them.
+	Control *Control `json:"control"`
+
+	// Authentication configures the verification of the ID tokens of the
+	// requests that trigger rollouts. Nil accepts all requests.
+	Authentication *Authentication `json:"authentication"`
+
+	// Tracing configures the export of the spans of rollout passes. Nil
+	// disables tracing.
+	Tracing *Tracing `json:"tracing"`
+
+	// History configures where the decisions made on each service are
+	// recorded. Nil disables the history.
+	History *History `json:"history"`
+}
+
+// History backends.
+const (
+	FileHistoryBackend = "file"
+)
+
+// History configures the store of the rollout decisions.
+//
+// With the file backend, decisions are appended to the file at Path as lines
+// of JSON.
+type History struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+// Tracing exporters.
+const (
+	OTLPTracingExporter   = "otlp"
+	StdoutTracingExporter = "stdout"
+)
+
+// Tracing configures the export of OpenTelemetry spans.
+//
+// With the otlp exporter, spans are sent to the OTLP/HTTP Endpoint of a
+// collector, e.g. http://localhost:4318. With the stdout exporter, they are
+// written to the standard output.
+type Tracing struct {
+	Exporter string `json:"exporter"`
+	Endpoint string `json:"endpoint"`
+
+	// ServiceName is the service.name of the spans, "cloud-run-release-manager"
+	// by default.
+	ServiceName string `json:"serviceName"`
+}
+
+// Authentication configures the verification of Google-signed OIDC ID tokens.
+//
+// Tokens must be issued for the Audience, usually the URL of the service, to
+// one of the ServiceAccounts, e.g. the one of a Cloud Scheduler job.
+type Authentication struct {
+	Audience        string   `json:"audience"`
+	ServiceAccounts []string `json:"serviceAccounts"`
+}
+
+// Control configures the HTTP endpoints to pause, resume, abort, promote, roll
+// back or retry rollouts.
+//
+// Requests must carry the token in the TokenEnv environment variable as a
+// bearer token.
+type Control struct {
+	TokenEnv string `json:"tokenEnv"`
+}
+
+// Incident providers.
+const (
+	PagerDutyIncidentProvider = "pagerduty"
+	WebhookIncidentProvider   = "webhook"
+)
+
+// Incidents configures the alerts opened when a candidate is rolled back.
+//
+// With the pagerduty provider, alerts are sent to a PagerDuty-compatible
+// Events API using the routing key in the RoutingKeyEnv environment variable.
+// URL defaults to the PagerDuty Events API v2. With the webhook provider,
+// alerts are posted as JSON to URL.
+type Incidents struct {
+	Provider      string `json:"provider"`
+	URL           string `json:"url"`
+	RoutingKeyEnv string `json:"routingKeyEnv"`
+
+	// Severity of the alerts, "error" by default.
+	Severity string `json:"severity"`
+}
+
+// GitHub configures the deployments created in GitHub for the candidates.
+//
+// The token, read from the TokenEnv environment variable, needs access to the
+// deployments of the repositories. APIURL defaults to https://api.github.com.
+type GitHub struct {
+	APIURL   string `json:"apiURL"`
+	TokenEnv string `json:"tokenEnv"`
+}
+
+// CloudEvents HTTP content modes.
+const (
+	CloudEventsBinaryMode     = "binary"
+	CloudEventsStructuredMode = "structured"
+)
+
+// CloudEventsSink is an HTTP endpoint where rollout events are sent in
+// CloudEvents 1.0 format, using the binary or structured content mode. The
+// binary mode is used by default.
+type CloudEventsSink struct {
+	URL  string `json:"url"`
+	Mode string `json:"mode"`
+}
+
+// Webhook is an HTTPS endpoint where rollout events are posted as JSON.
+//
+// The requests are signed with HMAC-SHA256 using the shared secret in the
+// SecretEnv environment variable. Failed requests are retried up to
+// MaxAttempts times in total, and then written to DeadLetterFile, if set.
+type Webhook struct {
+	URL            string `json:"url"`
+	SecretEnv      string `json:"secretEnv"`
+	MaxAttempts    int    `json:"maxAttempts"`
+	DeadLetterFile string `json:"deadLetterFile"`
+}
+
+// Slack configures the messages posted to Slack-compatible incoming webhooks.
+//
+// Each event is posted to every matching route, or to the default webhook if
+// no route matches.
+type Slack struct {
+	WebhookURL string       `json:"webhookURL"`
+	Routes     []SlackRoute `json:"routes"`
+}
+
+// SlackRoute sends the events of the services that match both the strategy
+// name and the label selector, if set, to a webhook.
+type SlackRoute struct {
+	Strategy      string `json:"strategy"`
+	LabelSelector string `json:"labelSelector"`
+	WebhookURL    string `json:"webhookURL"`
+
+	// Channel overrides the default channel of the webhook, if supported.
+	Channel string `json:"channel"`
 }
 
 // NewTarget initializes a target to filter services by label.
@@ -62,6 +281,49 @@ func NewTarget(project string, regions []string, labelSelector string) Target {
 	}
 }
 
+// MatchLabels determines if the labels match the selector.
+//
+// The selector is a comma-separated list of requirements of the form key=value,
+// key==value, key!=value or key, which requires the label to exist. Set-based
+// requirements, e.g. key in (a, b), are not supported.
+func MatchLabels(selector string, labels map[string]string) bool {
+	for _, requirement := range strings.Split(selector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		if requirement == "" {
+			continue
+		}
+
+		if i := strings.Index(requirement, "!="); i >= 0 {
+			key, value := strings.TrimSpace(requirement[:i]), strings.TrimSpace(requirement[i+2:])
+			if labels[key] == value {
+				return false
+			}
+			continue
+		}
+		if i := strings.Index(requirement, "="); i >= 0 {
+			key := strings.TrimSpace(requirement[:i])
+			value := strings.TrimSpace(strings.TrimPrefix(requirement[i+1:], "="))
+			if actual, ok := labels[key]; !ok || actual != value {
+				return false
+			}
+			continue
+		}
+		if _, ok := labels[requirement]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// DisplayName returns the name of the strategy, or its label selector if it
+// has no name.
+func (strategy Strategy) DisplayName() string {
+	if strategy.Name != "" {
+		return strategy.Name
+	}
+	return strategy.Target.LabelSelector
+}
+
 // NewStrategy initializes a strategy.
 func NewStrategy(target Target, steps []int64, healthOffset, timeBetweenRollouts time.Duration, healthCriteria []HealthCriterion) Strategy {
 	return Strategy{
@@ -75,12 +337,67 @@ func NewStrategy(target Target, steps []int64, healthOffset, timeBetweenRollouts
 
 // Validate checks if the configuration is valid.
 func (config Config) Validate() error {
+	if config.MaxConcurrentRollouts < 0 {
+		return errors.Errorf("max concurrent rollouts cannot be negative, got %d", config.MaxConcurrentRollouts)
+	}
 	for i, strategy := range config.Strategies {
 		err := strategy.Validate()
 		if err != nil {
 			return errors.Wrapf(err, "invalid strategy at index %d", i)
 		}
 	}
+	for i, group := range config.ReleaseGroups {
+		if group.Name == "" {
+			return errors.Errorf("release group at index %d must have a name", i)
+		}
+		if len(group.Services) == 0 {
+			return errors.Errorf("release group %q must have services", group.Name)
+		}
+	}
+	if config.Slack != nil {
+		if err := validateSlack(*config.Slack); err != nil {
+			return errors.Wrap(err, "invalid slack configuration")
+		}
+	}
+	for i, sink := range config.CloudEvents {
+		if err := validateCloudEventsSink(sink); err != nil {
+			return errors.Wrapf(err, "invalid CloudEvents sink at index %d", i)
+		}
+	}
+	if config.Incidents != nil {
+		if err := validateIncidents(*config.Incidents); err != nil {
+			return errors.Wrap(err, "invalid incidents configuration")
+		}
+	}
+	if config.Authentication != nil {
+		if config.Authentication.Audience == "" {
+			return errors.New("invalid authentication configuration: audience must be specified")
+		}
+		if len(config.Authentication.ServiceAccounts) == 0 {
+			return errors.New("invalid authentication configuration: service accounts must be specified")
+		}
+	}
+	if config.Tracing != nil {
+		if err := validateTracing(*config.Tracing); err != nil {
+			return errors.Wrap(err, "invalid tracing configuration")
+		}
+	}
+	if config.History != nil {
+		if err := validateHistory(*config.History); err != nil {
+			return errors.Wrap(err, "invalid history configuration")
+		}
+	}
+	if config.Control != nil && config.Control.TokenEnv == "" {
+		return errors.New("invalid control configuration: token environment variable must be specified")
+	}
+	if config.GitHub != nil && config.GitHub.TokenEnv == "" {
+		return errors.New("invalid github configuration: token environment variable must be specified")
+	}
+	for i, webhook := range config.Webhooks {
+		if err := validateWebhook(webhook); err != nil {
+			return errors.Wrapf(err, "invalid webhook at index %d", i)
+		}
+	}
 	return nil
 }
 
@@ -90,6 +407,10 @@ func (strategy Strategy) Validate() error {
 		return errors.Errorf("health check offset must be positive, got %d", strategy.HealthCheckOffset)
 	}
 
+	if strategy.MaxConcurrentRollouts < 0 {
+		return errors.Errorf("max concurrent rollouts cannot be negative, got %d", strategy.MaxConcurrentRollouts)
+	}
+
 	if len(strategy.Steps) == 0 {
 		return errors.New("steps cannot be empty")
 	}
@@ -108,6 +429,14 @@ func (strategy Strategy) Validate() error {
 			return errors.Wrapf(err, "invalid metrics criterion at index %d", i)
 		}
 	}
+	if err := validateDependencies(strategy.Dependencies); err != nil {
+		return errors.Wrap(err, "invalid dependencies")
+	}
+	if strategy.RegionWaves != nil {
+		if err := validateRegionWaves(*strategy.RegionWaves); err != nil {
+			return errors.Wrap(err, "invalid region waves")
+		}
+	}
 	return validateTarget(strategy.Target)
 }
 
@@ -136,6 +465,174 @@ func validateHealthCriterion(criterion HealthCriterion) error {
 	return nil
 }
 
+func validateDependencies(dependencies []Dependency) error {
+	graph := make(map[string][]string)
+	for i, dep := range dependencies {
+		if dep.Service == "" || dep.DependsOn == "" {
+			return errors.Errorf("service and dependency must be specified at index %d", i)
+		}
+		if dep.Service == dep.DependsOn {
+			return errors.Errorf("service %q cannot depend on itself", dep.Service)
+		}
+		if dep.MaxPercent < 0 || dep.MaxPercent > 100 {
+			return errors.Errorf("max percent must be between 0 and 100 for service %q, got %d", dep.Service, dep.MaxPercent)
+		}
+		graph[dep.Service] = append(graph[dep.Service], dep.DependsOn)
+	}
+
+	// Detect cycles with a depth-first search.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var visit func(service string) error
+	visit = func(service string) error {
+		switch state[service] {
+		case visiting:
+			return errors.Errorf("dependency cycle found at service %q", service)
+		case visited:
+			return nil
+		}
+		state[service] = visiting
+		for _, dependsOn := range graph[service] {
+			if err := visit(dependsOn); err != nil {
+				return err
+			}
+		}
+		state[service] = visited
+		return nil
+	}
+	for _, dep := range dependencies {
+		if err := visit(dep.Service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRegionWaves(waves RegionWaves) error {
+	if waves.Canary == "" {
+		return errors.New("canary region must be specified")
+	}
+
+	seen := map[string]bool{waves.Canary: true}
+	for i, wave := range waves.Waves {
+		if len(wave) == 0 {
+			return errors.Errorf("wave at index %d cannot be empty", i)
+		}
+		for _, region := range wave {
+			if region == "" {
+				return errors.Errorf("regions cannot be empty in wave at index %d", i)
+			}
+			if seen[region] {
+				return errors.Errorf("region %q is listed more than once", region)
+			}
+			seen[region] = true
+		}
+	}
+	return nil
+}
+
+func validateSlack(slack Slack) error {
+	for i, route := range slack.Routes {
+		if route.WebhookURL == "" {
+			return errors.Errorf("webhook URL must be specified for route at index %d", i)
+		}
+		if route.Strategy == "" && route.LabelSelector == "" {
+			return errors.Errorf("strategy or label selector must be specified for route at index %d", i)
+		}
+	}
+	if slack.WebhookURL == "" && len(slack.Routes) == 0 {
+		return errors.New("webhook URL or routes must be specified")
+	}
+	return nil
+}
+
+func validateWebhook(webhook Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid URL")
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("URL must be an https URL, got %q", webhook.URL)
+	}
+	if webhook.SecretEnv == "" {
+		return errors.New("secret environment variable must be specified")
+	}
+	if webhook.MaxAttempts < 0 {
+		return errors.Errorf("max attempts cannot be negative, got %d", webhook.MaxAttempts)
+	}
+	return nil
+}
+
+func validateCloudEventsSink(sink CloudEventsSink) error {
+	u, err := url.Parse(sink.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("URL must be an http or https URL, got %q", sink.URL)
+	}
+	switch sink.Mode {
+	case "", CloudEventsBinaryMode, CloudEventsStructuredMode:
+	default:
+		return errors.Errorf("invalid mode %q", sink.Mode)
+	}
+	return nil
+}
+
+func validateIncidents(incidents Incidents) error {
+	switch incidents.Provider {
+	case PagerDutyIncidentProvider:
+		if incidents.RoutingKeyEnv == "" {
+			return errors.New("routing key environment variable must be specified")
+		}
+	case WebhookIncidentProvider:
+		if incidents.URL == "" {
+			return errors.New("URL must be specified")
+		}
+	default:
+		return errors.Errorf("invalid provider %q", incidents.Provider)
+	}
+
+	switch incidents.Severity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return errors.Errorf("invalid severity %q", incidents.Severity)
+	}
+	return nil
+}
+
+func validateTracing(tracing Tracing) error {
+	switch tracing.Exporter {
+	case OTLPTracingExporter:
+		if tracing.Endpoint == "" {
+			return errors.New("endpoint must be specified")
+		}
+		if _, err := url.ParseRequestURI(tracing.Endpoint); err != nil {
+			return errors.Wrap(err, "invalid endpoint")
+		}
+	case StdoutTracingExporter:
+	default:
+		return errors.Errorf("invalid exporter %q", tracing.Exporter)
+	}
+	return nil
+}
+
+func validateHistory(history History) error {
+	switch history.Backend {
+	case FileHistoryBackend:
+		if history.Path == "" {
+			return errors.New("path must be specified")
+		}
+	default:
+		return errors.Errorf("invalid backend %q", history.Backend)
+	}
+	return nil
+}
+
 func validateTarget(target Target) error {
 	if target.Project == "" {
 		return errors.Errorf("project must be specified")
@@ -16,6 +16,8 @@ func TestStrategy_Validate(t *testing.T) {
 		healthOffset        time.Duration
 		timeBetweenRollouts time.Duration
 		healthCriteria      []config.HealthCriterion
+		dependencies        []config.Dependency
+		regionWaves         *config.RegionWaves
 		shouldErr           bool
 	}{
 		{
@@ -123,11 +125,96 @@ func TestStrategy_Validate(t *testing.T) {
 			},
 			shouldErr: true,
 		},
+		{
+			name:                "valid dependencies",
+			target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			dependencies: []config.Dependency{
+				{Service: "frontend", DependsOn: "api", MaxPercent: 5},
+				{Service: "api", DependsOn: "database"},
+				{Service: "frontend", DependsOn: "database"},
+			},
+			shouldErr: false,
+		},
+		{
+			name:                "dependency on itself",
+			target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			dependencies: []config.Dependency{
+				{Service: "frontend", DependsOn: "frontend"},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "dependency cycle",
+			target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			dependencies: []config.Dependency{
+				{Service: "frontend", DependsOn: "api"},
+				{Service: "api", DependsOn: "auth"},
+				{Service: "auth", DependsOn: "frontend"},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "invalid dependency max percent",
+			target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			dependencies: []config.Dependency{
+				{Service: "frontend", DependsOn: "api", MaxPercent: 101},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "valid region waves",
+			target:              config.NewTarget("myproject", nil, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			regionWaves: &config.RegionWaves{
+				Canary: "us-east1",
+				Waves:  [][]string{{"us-central1", "us-west1"}, {"europe-west1"}},
+			},
+			shouldErr: false,
+		},
+		{
+			name:                "region waves without canary",
+			target:              config.NewTarget("myproject", nil, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			regionWaves: &config.RegionWaves{
+				Waves: [][]string{{"us-central1"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name:                "region in several waves",
+			target:              config.NewTarget("myproject", nil, "team=backend"),
+			steps:               []int64{5, 30, 60},
+			healthOffset:        20,
+			timeBetweenRollouts: 10 * time.Minute,
+			regionWaves: &config.RegionWaves{
+				Canary: "us-east1",
+				Waves:  [][]string{{"us-central1"}, {"us-east1"}},
+			},
+			shouldErr: true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(tt *testing.T) {
 			strategy := config.NewStrategy(test.target, test.steps, test.healthOffset, test.timeBetweenRollouts, test.healthCriteria)
+			strategy.Dependencies = test.dependencies
+			strategy.RegionWaves = test.regionWaves
 			err := strategy.Validate()
 			if test.shouldErr {
 				assert.NotNil(tt, err)
@@ -137,3 +224,301 @@ func TestStrategy_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	strategy := config.NewStrategy(config.NewTarget("myproject", nil, "team=backend"), []int64{5, 30, 60}, 10*time.Minute, 10*time.Minute, nil)
+	tests := []struct {
+		name      string
+		config    config.Config
+		shouldErr bool
+	}{
+		{
+			name: "correct config with release groups",
+			config: config.Config{
+				Strategies:            []config.Strategy{strategy},
+				MaxConcurrentRollouts: 5,
+				ReleaseGroups: []config.ReleaseGroup{
+					{Name: "checkout", Services: []string{"cart", "payments"}},
+				},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "negative max concurrent rollouts",
+			config: config.Config{
+				Strategies:            []config.Strategy{strategy},
+				MaxConcurrentRollouts: -1,
+			},
+			shouldErr: true,
+		},
+		{
+			name: "release group without name",
+			config: config.Config{
+				Strategies:    []config.Strategy{strategy},
+				ReleaseGroups: []config.ReleaseGroup{{Services: []string{"cart"}}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "release group without services",
+			config: config.Config{
+				Strategies:    []config.Strategy{strategy},
+				ReleaseGroups: []config.ReleaseGroup{{Name: "checkout"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "correct slack routes",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Slack: &config.Slack{
+					WebhookURL: "https://hooks.slack.com/services/default",
+					Routes: []config.SlackRoute{
+						{LabelSelector: "team=payments", WebhookURL: "https://hooks.slack.com/services/payments", Channel: "#payments-deploys"},
+						{Strategy: "backend", WebhookURL: "https://hooks.slack.com/services/backend"},
+					},
+				},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "correct webhook",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Webhooks: []config.Webhook{
+					{URL: "https://tracker.example.com/events", SecretEnv: "TRACKER_SECRET", MaxAttempts: 3},
+				},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "webhook without https",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Webhooks:   []config.Webhook{{URL: "http://tracker.example.com/events", SecretEnv: "TRACKER_SECRET"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "webhook without secret",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Webhooks:   []config.Webhook{{URL: "https://tracker.example.com/events"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "correct CloudEvents sinks",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				CloudEvents: []config.CloudEventsSink{
+					{URL: "http://broker-ingress.knative-eventing.svc.cluster.local/default/default"},
+					{URL: "https://events.example.com", Mode: config.CloudEventsStructuredMode},
+				},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "CloudEvents sink with invalid mode",
+			config: config.Config{
+				Strategies:  []config.Strategy{strategy},
+				CloudEvents: []config.CloudEventsSink{{URL: "https://events.example.com", Mode: "batch"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "correct PagerDuty incidents",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Incidents:  &config.Incidents{Provider: config.PagerDutyIncidentProvider, RoutingKeyEnv: "PD_ROUTING_KEY", Severity: "critical"},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "PagerDuty incidents without routing key",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Incidents:  &config.Incidents{Provider: config.PagerDutyIncidentProvider},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "webhook incidents without URL",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Incidents:  &config.Incidents{Provider: config.WebhookIncidentProvider},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "unknown incident provider",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Incidents:  &config.Incidents{Provider: "opsgenie", URL: "https://alerts.example.com"},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "correct authentication",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Authentication: &config.Authentication{
+					Audience:        "https://release-manager-abc-uc.a.run.app",
+					ServiceAccounts: []string{"scheduler@myproject.iam.gserviceaccount.com"},
+				},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "authentication without audience",
+			config: config.Config{
+				Strategies:     []config.Strategy{strategy},
+				Authentication: &config.Authentication{ServiceAccounts: []string{"scheduler@myproject.iam.gserviceaccount.com"}},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "authentication without service accounts",
+			config: config.Config{
+				Strategies:     []config.Strategy{strategy},
+				Authentication: &config.Authentication{Audience: "https://release-manager-abc-uc.a.run.app"},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "correct control",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Control:    &config.Control{TokenEnv: "CONTROL_TOKEN"},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "control without token",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Control:    &config.Control{},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "otlp tracing",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Tracing:    &config.Tracing{Exporter: config.OTLPTracingExporter, Endpoint: "http://localhost:4318"},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "stdout tracing",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Tracing:    &config.Tracing{Exporter: config.StdoutTracingExporter},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "otlp tracing without endpoint",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Tracing:    &config.Tracing{Exporter: config.OTLPTracingExporter},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "unknown tracing exporter",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Tracing:    &config.Tracing{Exporter: "zipkin"},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "file history",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				History:    &config.History{Backend: config.FileHistoryBackend, Path: "/var/lib/release-manager/history.ndjson"},
+			},
+			shouldErr: false,
+		},
+		{
+			name: "file history without path",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				History:    &config.History{Backend: config.FileHistoryBackend},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "unknown history backend",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				History:    &config.History{Backend: "sqlite", Path: "history.db"},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "slack without webhooks",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Slack:      &config.Slack{},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "slack route without webhook",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Slack: &config.Slack{
+					Routes: []config.SlackRoute{{Strategy: "backend"}},
+				},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "slack route without matcher",
+			config: config.Config{
+				Strategies: []config.Strategy{strategy},
+				Slack: &config.Slack{
+					Routes: []config.SlackRoute{{WebhookURL: "https://hooks.slack.com/services/backend"}},
+				},
+			},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			err := test.config.Validate()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+		})
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"rollout-strategy": "gradual", "team": "backend"}
+	tests := []struct {
+		selector string
+		expected bool
+	}{
+		{selector: "", expected: true},
+		{selector: "rollout-strategy=gradual", expected: true},
+		{selector: "rollout-strategy==gradual", expected: true},
+		{selector: "rollout-strategy=gradual, team=backend", expected: true},
+		{selector: "rollout-strategy=gradual,team=frontend", expected: false},
+		{selector: "team!=frontend", expected: true},
+		{selector: "team!=backend", expected: false},
+		{selector: "team", expected: true},
+		{selector: "owner", expected: false},
+		{selector: "owner=", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			assert.Equal(t, test.expected, config.MatchLabels(test.selector, labels))
+		})
+	}
+}
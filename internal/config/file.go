@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Decode reads a JSON configuration document.
+//
+// Durations are expressed as strings in Go time.Duration syntax. A config file
+// might have the following form
+//
+//	{
+//	  "maxConcurrentRollouts": 10,
+//	  "strategies": [{
+//	    "target": {"project": "myproject", "labelSelector": "team=backend"},
+//	    "steps": [5, 30, 60],
+//	    "healthCheckOffset": "30m",
+//	    "timeBetweenRollouts": "30m",
+//	    "maxConcurrentRollouts": 3,
+//	    "healthCriteria": [{"metric": "error-rate-percent", "threshold": 1}]
+//	  }]
+//	}
+func Decode(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to decode configuration")
+	}
+	return &cfg, nil
+}
+
+// LoadFile reads the JSON configuration file at the given path.
+func LoadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open config file")
+	}
+	defer f.Close()
+
+	cfg, err := Decode(f)
+	return cfg, errors.Wrapf(err, "invalid config file %s", path)
+}
+
+// UnmarshalJSON decodes a strategy, parsing its durations from strings.
+func (strategy *Strategy) UnmarshalJSON(data []byte) error {
+	type alias Strategy
+	aux := struct {
+		*alias
+		HealthCheckOffset   string `json:"healthCheckOffset"`
+		TimeBetweenRollouts string `json:"timeBetweenRollouts"`
+	}{alias: (*alias)(strategy)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+
+	var err error
+	strategy.HealthCheckOffset, err = parseDuration(aux.HealthCheckOffset)
+	if err != nil {
+		return errors.Wrap(err, "invalid healthCheckOffset")
+	}
+	strategy.TimeBetweenRollouts, err = parseDuration(aux.TimeBetweenRollouts)
+	return errors.Wrap(err, "invalid timeBetweenRollouts")
+}
+
+// parseDuration parses a duration string, returning zero for an empty string.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
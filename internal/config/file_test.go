@@ -0,0 +1,87 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		expected  *config.Config
+		shouldErr bool
+	}{
+		{
+			name: "full configuration",
+			in: `{
+				"maxConcurrentRollouts": 10,
+				"strategies": [{
+					"target": {"project": "myproject", "regions": ["us-east1"], "labelSelector": "team=backend"},
+					"steps": [5, 30, 60],
+					"healthCheckOffset": "30m",
+					"timeBetweenRollouts": "1h",
+					"maxConcurrentRollouts": 3,
+					"healthCriteria": [
+						{"metric": "request-latency", "percentile": 99, "threshold": 750},
+						{"metric": "error-rate-percent", "threshold": 1}
+					]
+				}]
+			}`,
+			expected: &config.Config{
+				MaxConcurrentRollouts: 10,
+				Strategies: []config.Strategy{
+					{
+						Target:              config.NewTarget("myproject", []string{"us-east1"}, "team=backend"),
+						Steps:               []int64{5, 30, 60},
+						HealthCheckOffset:   30 * time.Minute,
+						TimeBetweenRollouts: time.Hour,
+						HealthCriteria: []config.HealthCriterion{
+							{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+							{Metric: config.ErrorRateMetricsCheck, Threshold: 1},
+						},
+						MaxConcurrentRollouts: 3,
+					},
+				},
+			},
+		},
+		{
+			name: "omitted durations",
+			in:   `{"strategies": [{"steps": [50]}]}`,
+			expected: &config.Config{
+				Strategies: []config.Strategy{{Steps: []int64{50}}},
+			},
+		},
+		{
+			name:      "invalid duration",
+			in:        `{"strategies": [{"healthCheckOffset": "30"}]}`,
+			shouldErr: true,
+		},
+		{
+			name:      "unknown field",
+			in:        `{"strategies": [{"step": [5]}]}`,
+			shouldErr: true,
+		},
+		{
+			name:      "malformed document",
+			in:        `{"strategies": [`,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			cfg, err := config.Decode(strings.NewReader(test.in))
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, cfg)
+		})
+	}
+}
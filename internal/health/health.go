@@ -6,9 +6,11 @@ import (
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // DiagnosisResult is a possible result after a diagnosis.
@@ -118,7 +120,15 @@ func Diagnose(ctx context.Context, healthCriteria []config.HealthCriterion, actu
 
 // CollectMetrics gets a metrics value for each of the given health criteria and
 // returns a result for each criterion.
-func CollectMetrics(ctx context.Context, provider metrics.Provider, offset time.Duration, healthCriteria []config.HealthCriterion) ([]float64, error) {
+func CollectMetrics(ctx context.Context, provider metrics.Provider, offset time.Duration, healthCriteria []config.HealthCriterion) (values []float64, err error) {
+	ctx, span := tracing.Start(ctx, "health.CollectMetrics",
+		attribute.Int64("criteria", int64(len(healthCriteria))),
+		attribute.String("offset", offset.String()))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	if len(healthCriteria) == 0 {
 		return nil, errors.New("health criteria must be specified")
 	}
@@ -35,3 +35,34 @@ func StringReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis,
 
 	return report
 }
+
+// DiagnosisReport is a structured report of the diagnosis.
+type DiagnosisReport struct {
+	Result string        `json:"result"`
+	Checks []CheckReport `json:"checks"`
+}
+
+// CheckReport is the result of a health criterion check.
+type CheckReport struct {
+	Metric      config.MetricsCheck `json:"metric"`
+	Percentile  float64             `json:"percentile,omitempty"`
+	Threshold   float64             `json:"threshold"`
+	ActualValue float64             `json:"actualValue"`
+	Met         bool                `json:"met"`
+}
+
+// NewDiagnosisReport returns a structured report of the diagnosis.
+func NewDiagnosisReport(healthCriteria []config.HealthCriterion, diagnosis Diagnosis) DiagnosisReport {
+	report := DiagnosisReport{Result: diagnosis.OverallResult.String()}
+	for i, result := range diagnosis.CheckResults {
+		criteria := healthCriteria[i]
+		report.Checks = append(report.Checks, CheckReport{
+			Metric:      criteria.Metric,
+			Percentile:  criteria.Percentile,
+			Threshold:   result.Threshold,
+			ActualValue: result.ActualValue,
+			Met:         result.IsCriteriaMet,
+		})
+	}
+	return report
+}
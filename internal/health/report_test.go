@@ -85,3 +85,30 @@ func TestStringReport(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDiagnosisReport(t *testing.T) {
+	healthCriteria := []config.HealthCriterion{
+		{Metric: config.RequestCountMetricsCheck, Threshold: 1000},
+		{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750},
+		{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+	}
+	diagnosis := health.Diagnosis{
+		OverallResult: health.Unhealthy,
+		CheckResults: []health.CheckResult{
+			{Threshold: 1000, ActualValue: 1500, IsCriteriaMet: true},
+			{Threshold: 750, ActualValue: 800, IsCriteriaMet: false},
+			{Threshold: 5, ActualValue: 2, IsCriteriaMet: true},
+		},
+	}
+	expected := health.DiagnosisReport{
+		Result: "unhealthy",
+		Checks: []health.CheckReport{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 1000, ActualValue: 1500, Met: true},
+			{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 750, ActualValue: 800, Met: false},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5, ActualValue: 2, Met: true},
+		},
+	}
+
+	report := health.NewDiagnosisReport(healthCriteria, diagnosis)
+	assert.Equal(t, expected, report)
+}
@@ -0,0 +1,135 @@
+package history
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// bigQueryTimeFormat is a timestamp format BigQuery loads, with the
+// microsecond precision of its TIMESTAMP type.
+const bigQueryTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// BigQuerySchema is the schema of the rows written by ExportBigQuery, in the
+// format of the bq command-line tool.
+const BigQuerySchema = `[
+  {"name": "time", "type": "TIMESTAMP", "mode": "REQUIRED"},
+  {"name": "project", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "region", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "service", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "strategy", "type": "STRING"},
+  {"name": "actor", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "action", "type": "STRING", "mode": "REQUIRED"},
+  {"name": "stable_revision", "type": "STRING"},
+  {"name": "candidate_revision", "type": "STRING"},
+  {"name": "traffic_before", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "revision_name", "type": "STRING"},
+    {"name": "latest_revision", "type": "BOOLEAN"},
+    {"name": "tag", "type": "STRING"},
+    {"name": "percent", "type": "INTEGER"}
+  ]},
+  {"name": "traffic_after", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "revision_name", "type": "STRING"},
+    {"name": "latest_revision", "type": "BOOLEAN"},
+    {"name": "tag", "type": "STRING"},
+    {"name": "percent", "type": "INTEGER"}
+  ]},
+  {"name": "diagnosis", "type": "STRING"},
+  {"name": "checks", "type": "RECORD", "mode": "REPEATED", "fields": [
+    {"name": "metric", "type": "STRING"},
+    {"name": "percentile", "type": "FLOAT"},
+    {"name": "threshold", "type": "FLOAT"},
+    {"name": "actual_value", "type": "FLOAT"},
+    {"name": "met", "type": "BOOLEAN"}
+  ]},
+  {"name": "health_report", "type": "STRING"},
+  {"name": "error", "type": "STRING"}
+]
+`
+
+// bigQueryRow is a record in the format of BigQuerySchema.
+type bigQueryRow struct {
+	Time              string            `json:"time"`
+	Project           string            `json:"project"`
+	Region            string            `json:"region"`
+	Service           string            `json:"service"`
+	Strategy          string            `json:"strategy,omitempty"`
+	Actor             Actor             `json:"actor"`
+	Action            string            `json:"action"`
+	StableRevision    string            `json:"stable_revision,omitempty"`
+	CandidateRevision string            `json:"candidate_revision,omitempty"`
+	TrafficBefore     []bigQueryTraffic `json:"traffic_before,omitempty"`
+	TrafficAfter      []bigQueryTraffic `json:"traffic_after,omitempty"`
+	Diagnosis         string            `json:"diagnosis,omitempty"`
+	Checks            []bigQueryCheck   `json:"checks,omitempty"`
+	HealthReport      string            `json:"health_report,omitempty"`
+	Error             string            `json:"error,omitempty"`
+}
+
+type bigQueryTraffic struct {
+	RevisionName   string `json:"revision_name,omitempty"`
+	LatestRevision bool   `json:"latest_revision"`
+	Tag            string `json:"tag,omitempty"`
+	Percent        int64  `json:"percent"`
+}
+
+type bigQueryCheck struct {
+	Metric      string  `json:"metric"`
+	Percentile  float64 `json:"percentile,omitempty"`
+	Threshold   float64 `json:"threshold"`
+	ActualValue float64 `json:"actual_value"`
+	Met         bool    `json:"met"`
+}
+
+// ExportBigQuery writes the records as newline-delimited JSON that can be
+// loaded into a BigQuery table with BigQuerySchema.
+func ExportBigQuery(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		row := bigQueryRow{
+			Time:              record.Time.UTC().Format(bigQueryTimeFormat),
+			Project:           record.Project,
+			Region:            record.Region,
+			Service:           record.Service,
+			Strategy:          record.Strategy,
+			Actor:             record.Actor,
+			Action:            record.Action,
+			StableRevision:    record.StableRevision,
+			CandidateRevision: record.CandidateRevision,
+			TrafficBefore:     bigQueryTrafficOf(record.TrafficBefore),
+			TrafficAfter:      bigQueryTrafficOf(record.TrafficAfter),
+			HealthReport:      record.HealthReport,
+			Error:             record.Error,
+		}
+		if record.Diagnosis != nil {
+			row.Diagnosis = record.Diagnosis.Result
+			for _, check := range record.Diagnosis.Checks {
+				row.Checks = append(row.Checks, bigQueryCheck{
+					Metric:      string(check.Metric),
+					Percentile:  check.Percentile,
+					Threshold:   check.Threshold,
+					ActualValue: check.ActualValue,
+					Met:         check.Met,
+				})
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return errors.Wrap(err, "failed to write row")
+		}
+	}
+	return nil
+}
+
+func bigQueryTrafficOf(traffic []Traffic) []bigQueryTraffic {
+	var rows []bigQueryTraffic
+	for _, t := range traffic {
+		rows = append(rows, bigQueryTraffic{
+			RevisionName:   t.RevisionName,
+			LatestRevision: t.LatestRevision,
+			Tag:            t.Tag,
+			Percent:        t.Percent,
+		})
+	}
+	return rows
+}
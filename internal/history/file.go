@@ -0,0 +1,90 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxLineSize is the maximum size of a record in a history file.
+const maxLineSize = 1 << 20
+
+// FileStore keeps the history in a local file, one record per line of JSON.
+//
+// Records are appended to the file, so it can be shared by the processes of
+// the same host.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore initializes a store that keeps the history in the file at
+// path. The file and its directory are created by the first record.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Record appends the record to the file.
+func (s *FileStore) Record(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal record")
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create history directory")
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open history file")
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write record")
+	}
+	return errors.Wrap(f.Close(), "failed to close history file")
+}
+
+// List reads the records selected by the filter. A missing file is an empty
+// history.
+func (s *FileStore) List(ctx context.Context, filter Filter) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open history file")
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse record at line %d", line)
+		}
+		if !filter.Match(record) {
+			continue
+		}
+		records = append(records, record)
+		if filter.Limit > 0 && len(records) > filter.Limit {
+			records = records[1:]
+		}
+	}
+	return records, errors.Wrap(scanner.Err(), "failed to read history file")
+}
@@ -0,0 +1,113 @@
+// Package history records the decisions made on the rollout of each service,
+// so how a candidate's metrics evolved can be reconstructed after the fact.
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// Actor is who made a decision.
+type Actor string
+
+// Possible actors.
+const (
+	// OperatorActor is the Release Manager during a rollout pass.
+	OperatorActor Actor = "operator"
+	// ManualActor is a user through a manual action.
+	ManualActor Actor = "manual"
+)
+
+// Record is a decision made on the rollout of a service.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Project  string    `json:"project"`
+	Region   string    `json:"region"`
+	Service  string    `json:"service"`
+	Strategy string    `json:"strategy"`
+	Actor    Actor     `json:"actor"`
+
+	// Action is the outcome of a rollout pass (e.g. "advanced") or the manual
+	// action (e.g. "rollback").
+	Action string `json:"action"`
+
+	StableRevision    string `json:"stableRevision,omitempty"`
+	CandidateRevision string `json:"candidateRevision,omitempty"`
+
+	// TrafficBefore and TrafficAfter are the traffic configurations before
+	// and after the update.
+	TrafficBefore []Traffic `json:"trafficBefore"`
+	TrafficAfter  []Traffic `json:"trafficAfter"`
+
+	// Diagnosis is the candidate's health, if it was diagnosed.
+	Diagnosis *health.DiagnosisReport `json:"diagnosis,omitempty"`
+
+	// HealthReport is the human-readable health report of the service.
+	HealthReport string `json:"healthReport,omitempty"`
+
+	// Error is set if the update of the service failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Traffic is the share of traffic of a revision.
+type Traffic struct {
+	RevisionName   string `json:"revisionName,omitempty"`
+	LatestRevision bool   `json:"latestRevision,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	Percent        int64  `json:"percent"`
+}
+
+// NewTraffic converts the traffic targets of a service.
+func NewTraffic(targets []*run.TrafficTarget) []Traffic {
+	traffic := []Traffic{}
+	for _, target := range targets {
+		traffic = append(traffic, Traffic{
+			RevisionName:   target.RevisionName,
+			LatestRevision: target.LatestRevision,
+			Tag:            target.Tag,
+			Percent:        target.Percent,
+		})
+	}
+	return traffic
+}
+
+// Filter selects records. Empty fields match all the records.
+type Filter struct {
+	Project string
+	Region  string
+	Service string
+
+	// Limit keeps the latest records only if it is greater than zero.
+	Limit int
+}
+
+// Match determines if the record is selected by the filter.
+func (f Filter) Match(record Record) bool {
+	return (f.Project == "" || f.Project == record.Project) &&
+		(f.Region == "" || f.Region == record.Region) &&
+		(f.Service == "" || f.Service == record.Service)
+}
+
+// Store keeps the history of decisions.
+type Store interface {
+	// Record adds a decision to the history.
+	Record(ctx context.Context, record Record) error
+
+	// List returns the decisions selected by the filter, oldest first.
+	List(ctx context.Context, filter Filter) ([]Record, error)
+}
+
+// New initializes the store of the configured backend.
+func New(cfg config.History) (Store, error) {
+	switch cfg.Backend {
+	case config.FileHistoryBackend:
+		return NewFileStore(cfg.Path), nil
+	default:
+		return nil, errors.Errorf("unsupported history backend %q", cfg.Backend)
+	}
+}
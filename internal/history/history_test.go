@@ -0,0 +1,176 @@
+package history_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store := history.NewFileStore(filepath.Join(dir, "data", "history.ndjson"))
+	ctx := context.Background()
+
+	records, err := store.List(ctx, history.Filter{})
+	assert.Nil(t, err, "a missing file is an empty history")
+	assert.Len(t, records, 0)
+
+	start := time.Date(2020, 8, 13, 10, 0, 0, 0, time.UTC)
+	for i, record := range []history.Record{
+		{Service: "hello", Region: "us-east1", Action: "initial"},
+		{Service: "hello", Region: "us-east1", Action: "advanced"},
+		{Service: "world", Region: "us-east1", Action: "initial"},
+		{Service: "hello", Region: "us-central1", Action: "initial"},
+		{Service: "hello", Region: "us-east1", Action: "rolled back"},
+	} {
+		record.Time = start.Add(time.Duration(i) * time.Minute)
+		record.Project = "myproject"
+		assert.Nil(t, store.Record(ctx, record))
+	}
+
+	var tests = []struct {
+		name       string
+		filter     history.Filter
+		outActions []string
+	}{
+		{
+			name:       "all records",
+			outActions: []string{"initial", "advanced", "initial", "initial", "rolled back"},
+		},
+		{
+			name:       "service in region",
+			filter:     history.Filter{Project: "myproject", Region: "us-east1", Service: "hello"},
+			outActions: []string{"initial", "advanced", "rolled back"},
+		},
+		{
+			name:       "latest records",
+			filter:     history.Filter{Region: "us-east1", Service: "hello", Limit: 2},
+			outActions: []string{"advanced", "rolled back"},
+		},
+		{
+			name:   "other project",
+			filter: history.Filter{Project: "otherproject"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			records, err := store.List(ctx, test.filter)
+			assert.Nil(tt, err)
+			var actions []string
+			for _, record := range records {
+				actions = append(actions, record.Action)
+			}
+			assert.Equal(tt, test.outActions, actions)
+		})
+	}
+}
+
+func TestFileStoreInvalidRecord(t *testing.T) {
+	f, err := ioutil.TempFile("", "history")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("{\"service\": \"hello\"}\nnot json\n")
+	f.Close()
+
+	_, err = history.NewFileStore(f.Name()).List(context.Background(), history.Filter{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestNew(t *testing.T) {
+	store, err := history.New(config.History{Backend: config.FileHistoryBackend, Path: "history.ndjson"})
+	assert.Nil(t, err)
+	assert.IsType(t, &history.FileStore{}, store)
+
+	_, err = history.New(config.History{Backend: "sqlite"})
+	assert.NotNil(t, err)
+}
+
+func TestExportBigQuery(t *testing.T) {
+	record := history.Record{
+		Time:              time.Date(2020, 8, 13, 12, 0, 0, 500000000, time.FixedZone("EDT", -4*3600)),
+		Project:           "myproject",
+		Region:            "us-east1",
+		Service:           "hello",
+		Strategy:          "backend",
+		Actor:             history.OperatorActor,
+		Action:            "advanced",
+		StableRevision:    "hello-001",
+		CandidateRevision: "hello-002",
+		TrafficBefore: history.NewTraffic([]*run.TrafficTarget{
+			{RevisionName: "hello-001", Percent: 90, Tag: "stable"},
+			{RevisionName: "hello-002", Percent: 10, Tag: "candidate"},
+		}),
+		TrafficAfter: history.NewTraffic([]*run.TrafficTarget{
+			{RevisionName: "hello-001", Percent: 60, Tag: "stable"},
+			{RevisionName: "hello-002", Percent: 40, Tag: "candidate"},
+			{LatestRevision: true, Tag: "latest"},
+		}),
+		Diagnosis: &health.DiagnosisReport{
+			Result: "healthy",
+			Checks: []health.CheckReport{
+				{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 500, ActualValue: 320.5, Met: true},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, history.ExportBigQuery(&buf, []history.Record{record, {Time: record.Time, Actor: history.ManualActor, Action: "pause"}}))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+
+	var row map[string]interface{}
+	assert.Nil(t, json.Unmarshal(lines[0], &row))
+	assert.Equal(t, map[string]interface{}{
+		"time":               "2020-08-13T16:00:00.500000Z",
+		"project":            "myproject",
+		"region":             "us-east1",
+		"service":            "hello",
+		"strategy":           "backend",
+		"actor":              "operator",
+		"action":             "advanced",
+		"stable_revision":    "hello-001",
+		"candidate_revision": "hello-002",
+		"traffic_before": []interface{}{
+			map[string]interface{}{"revision_name": "hello-001", "latest_revision": false, "tag": "stable", "percent": float64(90)},
+			map[string]interface{}{"revision_name": "hello-002", "latest_revision": false, "tag": "candidate", "percent": float64(10)},
+		},
+		"traffic_after": []interface{}{
+			map[string]interface{}{"revision_name": "hello-001", "latest_revision": false, "tag": "stable", "percent": float64(60)},
+			map[string]interface{}{"revision_name": "hello-002", "latest_revision": false, "tag": "candidate", "percent": float64(40)},
+			map[string]interface{}{"latest_revision": true, "tag": "latest", "percent": float64(0)},
+		},
+		"diagnosis": "healthy",
+		"checks": []interface{}{
+			map[string]interface{}{"metric": "request-latency", "percentile": float64(99), "threshold": float64(500), "actual_value": 320.5, "met": true},
+		},
+	}, row)
+
+	// Repeated fields are omitted rather than null.
+	assert.NotContains(t, string(lines[1]), "null")
+
+	// The schema is valid JSON with a field for each column.
+	var schema []map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(history.BigQuerySchema), &schema))
+	for key := range row {
+		var found bool
+		for _, field := range schema {
+			found = found || field["name"] == key
+		}
+		assert.True(t, found, "column %q not in schema", key)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/jonboulle/clockwork"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
@@ -23,6 +25,9 @@ type Provider struct {
 	metricsClient *monitoring.Service
 	project       string
 
+	// clock determines the end of the intervals the metrics are queried for.
+	clock clockwork.Clock
+
 	// query is used to filter the metrics for the wanted resource.
 	query
 }
@@ -43,10 +48,18 @@ func NewProvider(ctx context.Context, project string, region string, serviceName
 	return &Provider{
 		metricsClient: client,
 		project:       project,
+		clock:         clockwork.NewRealClock(),
 		query:         newQuery(project, region, serviceName),
 	}, nil
 }
 
+// WithClock updates the clock of the provider, so the metrics can be queried
+// for intervals in the past.
+func (p *Provider) WithClock(clock clockwork.Clock) *Provider {
+	p.clock = clock
+	return p
+}
+
 // SetCandidateRevision sets the candidate revision name for which the provider
 // should get metrics.
 func (p *Provider) SetCandidateRevision(revisionName string) {
@@ -56,7 +69,7 @@ func (p *Provider) SetCandidateRevision(revisionName string) {
 // RequestCount count returns the number of requests for the given offset.
 func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
 	query := p.addFilter("metric.type", requestCount)
-	endTime := time.Now()
+	endTime := p.clock.Now()
 	endTimeString := endTime.Format(time.RFC3339Nano)
 	startTime := endTime.Add(-1 * offset)
 	startTimeString := startTime.Format(time.RFC3339Nano)
@@ -99,7 +112,7 @@ func (p *Provider) RequestCount(ctx context.Context, offset time.Duration) (int6
 // It returns 0 if no request was made during the interval.
 func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
 	query := p.query.addFilter("metric.type", requestLatencies)
-	endTime := time.Now()
+	endTime := p.clock.Now()
 	endTimeString := endTime.Format(time.RFC3339Nano)
 	startTime := endTime.Add(-1 * offset)
 	startTimeString := startTime.Format(time.RFC3339Nano)
@@ -145,7 +158,7 @@ func (p *Provider) Latency(ctx context.Context, offset time.Duration, alignReduc
 // It returns 0 if no request was made during the interval.
 func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
 	query := p.query.addFilter("metric.type", requestCount)
-	endTime := time.Now()
+	endTime := p.clock.Now()
 	endTimeString := endTime.Format(time.RFC3339Nano)
 	startTime := endTime.Add(-1 * offset)
 	startTimeString := startTime.Format(time.RFC3339Nano)
@@ -179,7 +192,9 @@ func (p *Provider) ErrorRate(ctx context.Context, offset time.Duration) (float64
 }
 
 func makeRequestForTimeSeries(logger *logrus.Entry, req *monitoring.ProjectsTimeSeriesListCall) ([]*monitoring.TimeSeries, error) {
+	start := time.Now()
 	resp, err := req.Do()
+	selfmetrics.ObserveAPICall(selfmetrics.MonitoringAPI, "ListTimeSeries", start, err)
 	if err != nil {
 		return nil, errors.Wrap(err, "error when retrieving time series")
 	}
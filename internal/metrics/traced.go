@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedProvider records a span for each call to the metrics provider.
+type tracedProvider struct {
+	provider Provider
+	revision string
+}
+
+// Traced returns a provider that records a span for each call to the given
+// provider.
+func Traced(provider Provider) Provider {
+	return &tracedProvider{provider: provider}
+}
+
+func (p *tracedProvider) SetCandidateRevision(revisionName string) {
+	p.revision = revisionName
+	p.provider.SetCandidateRevision(revisionName)
+}
+
+func (p *tracedProvider) start(ctx context.Context, name string, offset time.Duration) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name,
+		attribute.String("revision", p.revision),
+		attribute.String("offset", offset.String()))
+}
+
+func (p *tracedProvider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	ctx, span := p.start(ctx, "metrics.RequestCount", offset)
+	defer span.End()
+	count, err := p.provider.RequestCount(ctx, offset)
+	span.SetAttributes(attribute.Int64("value", count))
+	tracing.RecordError(span, err)
+	return count, err
+}
+
+func (p *tracedProvider) Latency(ctx context.Context, offset time.Duration, alignReduceType AlignReduce) (float64, error) {
+	ctx, span := p.start(ctx, "metrics.Latency", offset)
+	defer span.End()
+	latency, err := p.provider.Latency(ctx, offset, alignReduceType)
+	span.SetAttributes(attribute.Int64("alignReduce", int64(alignReduceType)), attribute.Float64("value", latency))
+	tracing.RecordError(span, err)
+	return latency, err
+}
+
+func (p *tracedProvider) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	ctx, span := p.start(ctx, "metrics.ErrorRate", offset)
+	defer span.End()
+	rate, err := p.provider.ErrorRate(ctx, offset)
+	span.SetAttributes(attribute.Float64("value", rate))
+	tracing.RecordError(span, err)
+	return rate, err
+}
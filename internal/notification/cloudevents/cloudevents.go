@@ -0,0 +1,263 @@
+// Package cloudevents sends rollout events in CloudEvents 1.0 format over HTTP.
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// SpecVersion is the version of the CloudEvents specification.
+const SpecVersion = "1.0"
+
+// TypePrefix is the prefix of the type of all the rollout events.
+const TypePrefix = "dev.cloudrun.rollout."
+
+// DataSchemaV1 identifies the schema of the version 1 of the event data.
+const DataSchemaV1 = "https://github.com/GoogleCloudPlatform/cloud-run-release-manager/blob/main/schemas/rollout-event.v1.json"
+
+// Content types.
+const (
+	jsonContentType       = "application/json"
+	structuredContentType = "application/cloudevents+json"
+)
+
+// eventTypes maps the rollout events to the type of the CloudEvents.
+var eventTypes = map[notification.EventType]string{
+	notification.CandidateDetectedEvent: TypePrefix + "candidateDetected",
+	notification.InitialTrafficEvent:    TypePrefix + "initialTraffic",
+	notification.StepAdvancedEvent:      TypePrefix + "stepAdvanced",
+	notification.WaitingEvent:           TypePrefix + "waiting",
+	notification.InconclusiveEvent:      TypePrefix + "inconclusive",
+	notification.PromotedEvent:          TypePrefix + "promoted",
+	notification.RolledBackEvent:        TypePrefix + "rolledBack",
+	notification.PausedEvent:            TypePrefix + "paused",
+	notification.ErrorEvent:             TypePrefix + "error",
+}
+
+// Event is a CloudEvent with the rollout event data.
+//
+// The service, region and candidate revision are included as extension
+// attributes, so consumers can filter on them without parsing the data.
+type Event struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	DataSchema      string    `json:"dataschema"`
+
+	// Extension attributes.
+	Service  string `json:"service"`
+	Region   string `json:"region"`
+	Revision string `json:"revision,omitempty"`
+
+	Data DataV1 `json:"data"`
+}
+
+// DataV1 is the version 1 of the event data.
+type DataV1 struct {
+	Event             string                  `json:"event"`
+	Reason            string                  `json:"reason,omitempty"`
+	Project           string                  `json:"project"`
+	Region            string                  `json:"region"`
+	Service           string                  `json:"service"`
+	Strategy          string                  `json:"strategy"`
+	StableRevision    string                  `json:"stableRevision"`
+	CandidateRevision string                  `json:"candidateRevision"`
+	CandidatePercent  int                     `json:"candidatePercent"`
+	CandidateURL      string                  `json:"candidateURL,omitempty"`
+	PromotedToStable  bool                    `json:"promotedToStable"`
+	PreviousTraffic   []TrafficV1             `json:"previousTraffic"`
+	Traffic           []TrafficV1             `json:"traffic"`
+	Diagnosis         *health.DiagnosisReport `json:"diagnosis,omitempty"`
+	Error             string                  `json:"error,omitempty"`
+}
+
+// TrafficV1 is the share of traffic of a revision.
+type TrafficV1 struct {
+	Revision       string `json:"revision,omitempty"`
+	LatestRevision bool   `json:"latestRevision,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	Percent        int64  `json:"percent"`
+}
+
+// Sink sends rollout events to an HTTP endpoint as CloudEvents.
+type Sink struct {
+	url    string
+	mode   string
+	client *http.Client
+}
+
+// New initializes a notifier that sends CloudEvents to the sink in the
+// configuration.
+func New(cfg config.CloudEventsSink) *Sink {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = config.CloudEventsBinaryMode
+	}
+	return &Sink{
+		url:    cfg.URL,
+		mode:   mode,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithHTTPClient updates the HTTP client used to send events.
+func (s *Sink) WithHTTPClient(client *http.Client) *Sink {
+	s.client = client
+	return s
+}
+
+// NewEvent converts a rollout event to a CloudEvent.
+func NewEvent(event notification.RolloutEvent) (Event, error) {
+	eventType, ok := eventTypes[event.Event]
+	if !ok {
+		return Event{}, errors.Errorf("unknown event type %q", event.Event)
+	}
+	id, err := newID()
+	if err != nil {
+		return Event{}, errors.Wrap(err, "failed to generate event ID")
+	}
+
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          fmt.Sprintf("//run.googleapis.com/projects/%s/locations/%s/services/%s", event.Project, event.Region, event.ServiceName),
+		Type:            eventType,
+		Subject:         event.CandidateRevisionName,
+		Time:            event.Time,
+		DataContentType: jsonContentType,
+		DataSchema:      DataSchemaV1,
+		Service:         event.ServiceName,
+		Region:          event.Region,
+		Revision:        event.CandidateRevisionName,
+		Data: DataV1{
+			Event:             string(event.Event),
+			Reason:            event.Reason,
+			Project:           event.Project,
+			Region:            event.Region,
+			Service:           event.ServiceName,
+			Strategy:          event.Strategy,
+			StableRevision:    event.StableRevisionName,
+			CandidateRevision: event.CandidateRevisionName,
+			CandidatePercent:  event.CandidateRevisionPercent,
+			CandidateURL:      event.CandidateRevisionURL,
+			PromotedToStable:  event.CandidateWasPromotedToStable,
+			PreviousTraffic:   trafficV1(event.PreviousTraffic),
+			Traffic:           trafficV1(event.Traffic),
+			Diagnosis:         event.Diagnosis,
+			Error:             event.Error,
+		},
+	}, nil
+}
+
+// Notify sends the event to the sink.
+func (s *Sink) Notify(ctx context.Context, event notification.RolloutEvent) error {
+	ce, err := NewEvent(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to create CloudEvent")
+	}
+	req, err := s.newRequest(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to create CloudEvents request")
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send CloudEvent")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("failed to send CloudEvent, status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	util.LoggerFrom(ctx).WithFields(logrus.Fields{"id": ce.ID, "type": ce.Type, "mode": s.mode}).Debug("CloudEvent sent")
+	return nil
+}
+
+// newRequest creates the HTTP request for the event in the sink's mode.
+//
+// In binary mode, the attributes are sent as ce- headers and the body is the
+// event data. In structured mode, the body is the whole event.
+func (s *Sink) newRequest(ce Event) (*http.Request, error) {
+	if s.mode == config.CloudEventsStructuredMode {
+		body, err := json.Marshal(ce)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal event")
+		}
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", structuredContentType)
+		return req, nil
+	}
+
+	body, err := json.Marshal(ce.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal event data")
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ce.DataContentType)
+	req.Header.Set("ce-specversion", ce.SpecVersion)
+	req.Header.Set("ce-id", ce.ID)
+	req.Header.Set("ce-source", ce.Source)
+	req.Header.Set("ce-type", ce.Type)
+	req.Header.Set("ce-time", ce.Time.Format(time.RFC3339Nano))
+	req.Header.Set("ce-dataschema", ce.DataSchema)
+	req.Header.Set("ce-service", ce.Service)
+	req.Header.Set("ce-region", ce.Region)
+	if ce.Subject != "" {
+		req.Header.Set("ce-subject", ce.Subject)
+	}
+	if ce.Revision != "" {
+		req.Header.Set("ce-revision", ce.Revision)
+	}
+	return req, nil
+}
+
+// trafficV1 converts the traffic configuration to the version 1 of the data.
+func trafficV1(traffic []*run.TrafficTarget) []TrafficV1 {
+	var targets []TrafficV1
+	for _, target := range traffic {
+		targets = append(targets, TrafficV1{
+			Revision:       target.RevisionName,
+			LatestRevision: target.LatestRevision,
+			Tag:            target.Tag,
+			Percent:        target.Percent,
+		})
+	}
+	return targets
+}
+
+// newID returns a random event ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package cloudevents_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/cloudevents"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestNotify(t *testing.T) {
+	event := notification.RolloutEvent{
+		Event:                        notification.PromotedEvent,
+		Time:                         time.Date(2020, 8, 1, 15, 4, 5, 0, time.UTC),
+		Project:                      "myproject",
+		Region:                       "us-east1",
+		ServiceName:                  "mysvc",
+		Strategy:                     "backend",
+		StableRevisionName:           "mysvc-001",
+		CandidateRevisionName:        "mysvc-002",
+		CandidateRevisionPercent:     100,
+		CandidateWasPromotedToStable: true,
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "mysvc-002", Percent: 100, Tag: "stable"},
+		},
+		Service: &run.Service{Metadata: &run.ObjectMeta{Name: "mysvc"}},
+	}
+	expectedData := cloudevents.DataV1{
+		Event:             "promoted",
+		Project:           "myproject",
+		Region:            "us-east1",
+		Service:           "mysvc",
+		Strategy:          "backend",
+		StableRevision:    "mysvc-001",
+		CandidateRevision: "mysvc-002",
+		CandidatePercent:  100,
+		PromotedToStable:  true,
+		Traffic: []cloudevents.TrafficV1{
+			{Revision: "mysvc-002", Percent: 100, Tag: "stable"},
+		},
+	}
+	const source = "//run.googleapis.com/projects/myproject/locations/us-east1/services/mysvc"
+
+	t.Run("binary mode", func(tt *testing.T) {
+		var header http.Header
+		var data cloudevents.DataV1
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(tt, json.Unmarshal(body, &data))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		err := cloudevents.New(config.CloudEventsSink{URL: server.URL}).Notify(context.Background(), event)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "application/json", header.Get("Content-Type"))
+		assert.Equal(tt, "1.0", header.Get("ce-specversion"))
+		assert.Equal(tt, "dev.cloudrun.rollout.promoted", header.Get("ce-type"))
+		assert.Equal(tt, source, header.Get("ce-source"))
+		assert.Equal(tt, "2020-08-01T15:04:05Z", header.Get("ce-time"))
+		assert.Equal(tt, cloudevents.DataSchemaV1, header.Get("ce-dataschema"))
+		assert.Equal(tt, "mysvc", header.Get("ce-service"))
+		assert.Equal(tt, "us-east1", header.Get("ce-region"))
+		assert.Equal(tt, "mysvc-002", header.Get("ce-revision"))
+		assert.NotEmpty(tt, header.Get("ce-id"))
+		assert.Equal(tt, expectedData, data)
+	})
+
+	t.Run("structured mode", func(tt *testing.T) {
+		var contentType string
+		var ce cloudevents.Event
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Nil(tt, json.Unmarshal(body, &ce))
+		}))
+		defer server.Close()
+
+		cfg := config.CloudEventsSink{URL: server.URL, Mode: config.CloudEventsStructuredMode}
+		err := cloudevents.New(cfg).Notify(context.Background(), event)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "application/cloudevents+json", contentType)
+		assert.Equal(tt, "1.0", ce.SpecVersion)
+		assert.Equal(tt, "dev.cloudrun.rollout.promoted", ce.Type)
+		assert.Equal(tt, source, ce.Source)
+		assert.Equal(tt, "application/json", ce.DataContentType)
+		assert.Equal(tt, "mysvc", ce.Service)
+		assert.Equal(tt, "us-east1", ce.Region)
+		assert.Equal(tt, "mysvc-002", ce.Revision)
+		assert.Equal(tt, expectedData, ce.Data)
+	})
+
+	t.Run("sink error", func(tt *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		err := cloudevents.New(config.CloudEventsSink{URL: server.URL}).Notify(context.Background(), event)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestNewEvent(t *testing.T) {
+	types := map[notification.EventType]string{
+		notification.CandidateDetectedEvent: "dev.cloudrun.rollout.candidateDetected",
+		notification.InitialTrafficEvent:    "dev.cloudrun.rollout.initialTraffic",
+		notification.StepAdvancedEvent:      "dev.cloudrun.rollout.stepAdvanced",
+		notification.WaitingEvent:           "dev.cloudrun.rollout.waiting",
+		notification.InconclusiveEvent:      "dev.cloudrun.rollout.inconclusive",
+		notification.PromotedEvent:          "dev.cloudrun.rollout.promoted",
+		notification.RolledBackEvent:        "dev.cloudrun.rollout.rolledBack",
+		notification.PausedEvent:            "dev.cloudrun.rollout.paused",
+		notification.ErrorEvent:             "dev.cloudrun.rollout.error",
+	}
+	for eventType, expected := range types {
+		ce, err := cloudevents.NewEvent(notification.RolloutEvent{Event: eventType})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, ce.Type)
+	}
+
+	_, err := cloudevents.NewEvent(notification.RolloutEvent{Event: "unknown"})
+	assert.NotNil(t, err)
+}
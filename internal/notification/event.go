@@ -0,0 +1,141 @@
+package notification
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// EventType is the type of a rollout event.
+type EventType string
+
+// Rollout event types.
+const (
+	// CandidateDetectedEvent is sent when a new candidate is found.
+	CandidateDetectedEvent EventType = "candidate-detected"
+	// InitialTrafficEvent is sent when a new candidate gets its first traffic.
+	InitialTrafficEvent EventType = "initial-traffic"
+	// StepAdvancedEvent is sent when the candidate gets more traffic.
+	StepAdvancedEvent EventType = "step-advanced"
+	// WaitingEvent is sent when a healthy candidate waits for enough time to
+	// pass since the last rollout.
+	WaitingEvent EventType = "waiting"
+	// InconclusiveEvent is sent when the candidate did not get enough requests
+	// to be diagnosed.
+	InconclusiveEvent EventType = "inconclusive"
+	// PromotedEvent is sent when the candidate becomes the stable revision.
+	PromotedEvent EventType = "promoted"
+	// RolledBackEvent is sent when the traffic is redirected to the stable
+	// revision.
+	RolledBackEvent EventType = "rolled-back"
+	// PausedEvent is sent when the candidate is held by the maximum number of
+	// concurrent rollouts, a dependency or a region wave.
+	PausedEvent EventType = "paused"
+	// ErrorEvent is sent when the rollout of the service failed.
+	ErrorEvent EventType = "error"
+)
+
+// RolloutEvent is the format of an event sent to notifiers.
+type RolloutEvent struct {
+	Event  EventType `json:"event"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+
+	// Action is the manual action that caused the event, if any.
+	Action string `json:"action,omitempty"`
+
+	Project     string `json:"project"`
+	Region      string `json:"region"`
+	ServiceName string `json:"serviceName"`
+	Strategy    string `json:"strategy"`
+
+	StableRevisionName           string `json:"stableRevisionName"`
+	CandidateRevisionName        string `json:"candidateRevisionName"`
+	CandidateRevisionPercent     int    `json:"candidateRevisionPercent"`
+	CandidateRevisionURL         string `json:"candidateRevisionURL"`
+	CandidateWasPromotedToStable bool   `json:"candidateWasPromotedToStable"`
+
+	// PreviousTraffic and Traffic are the traffic configurations before and
+	// after the update.
+	PreviousTraffic []*run.TrafficTarget `json:"previousTraffic"`
+	Traffic         []*run.TrafficTarget `json:"traffic"`
+
+	// Diagnosis is the candidate's health, if it was diagnosed.
+	Diagnosis *health.DiagnosisReport `json:"diagnosis,omitempty"`
+
+	// HealthReport is the human-readable health report of the service.
+	HealthReport string `json:"healthReport,omitempty"`
+
+	// Error is the reason of the failure for an error event.
+	Error string `json:"error,omitempty"`
+
+	Service *run.Service `json:"service"`
+}
+
+// NewRolloutEvent initializes an event about the candidate revision.
+//
+// svc must be the updated Service instance as the result of the rollout. The
+// candidate's traffic and URL are taken from it, and the remaining details are
+// set by the caller.
+func NewRolloutEvent(event EventType, svc *run.Service, candidate string) (RolloutEvent, error) {
+	e := RolloutEvent{
+		Event:                        event,
+		CandidateRevisionName:        candidate,
+		CandidateWasPromotedToStable: event == PromotedEvent,
+		Traffic:                      svc.Spec.Traffic,
+		Service:                      svc,
+	}
+	if candidate == "" {
+		return e, nil
+	}
+
+	// The candidate is tagged as stable once it is promoted.
+	tag := "candidate"
+	if e.CandidateWasPromotedToStable {
+		tag = "stable"
+	}
+	var tagged bool
+	for _, target := range svc.Spec.Traffic {
+		if target.RevisionName != candidate {
+			continue
+		}
+		e.CandidateRevisionPercent += int(target.Percent)
+		tagged = tagged || target.Tag == tag
+	}
+	if !tagged {
+		return e, nil
+	}
+
+	url, err := tagURL(svc, tag)
+	if err != nil {
+		return e, errors.Wrap(err, "failed to determine the candidate's URL")
+	}
+	e.CandidateRevisionURL = url
+	return e, nil
+}
+
+// tagURL returns the URL to the revision with the given tag.
+//
+// Since the update of a service occurs asynchronously, the changes in the
+// traffic in the Service spec is not reflected in the Service's status at the
+// time of publishing.
+//
+// However, the traffic targets in the Service spec do not have a URL associated
+// to them since the URL field is read-only and available only in the status
+// traffic configuration.
+//
+// Thus, the URL to the revision is generated based on the service's URL and
+// the tag value.
+func tagURL(svc *run.Service, tag string) (string, error) {
+	url, err := url.Parse(svc.Status.Url)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse the service's url %s", svc.Status.Url)
+	}
+
+	// TODO: this only works for Cloud Run fully managed.
+	url.Host = tag + "---" + url.Host
+	return url.String(), nil
+}
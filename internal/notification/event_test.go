@@ -0,0 +1,90 @@
+package notification_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestNewRolloutEvent(t *testing.T) {
+	var tests = []struct {
+		name       string
+		event      notification.EventType
+		traffic    []*run.TrafficTarget
+		candidate  string
+		outPercent int
+		outURL     string
+	}{
+		{
+			name:  "step advanced",
+			event: notification.StepAdvancedEvent,
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 70, Tag: "stable"},
+				{RevisionName: "test-002", Percent: 30, Tag: "candidate"},
+			},
+			candidate:  "test-002",
+			outPercent: 30,
+			outURL:     "https://candidate---mysvc.a.run.app",
+		},
+		{
+			name:  "promotion",
+			event: notification.PromotedEvent,
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: "stable"},
+			},
+			candidate:  "test-002",
+			outPercent: 100,
+			outURL:     "https://stable---mysvc.a.run.app",
+		},
+		{
+			name:  "rollback",
+			event: notification.RolledBackEvent,
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: "stable"},
+				{RevisionName: "test-002", Percent: 0, Tag: "candidate"},
+			},
+			candidate:  "test-002",
+			outPercent: 0,
+			outURL:     "https://candidate---mysvc.a.run.app",
+		},
+		{
+			name:  "untagged candidate",
+			event: notification.CandidateDetectedEvent,
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: "stable"},
+			},
+			candidate: "test-002",
+		},
+		{
+			name:  "no candidate",
+			event: notification.ErrorEvent,
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: "stable"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := &run.Service{
+				Spec:   &run.ServiceSpec{Traffic: test.traffic},
+				Status: &run.ServiceStatus{Url: "https://mysvc.a.run.app"},
+			}
+			event, err := notification.NewRolloutEvent(test.event, svc, test.candidate)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.event, event.Event)
+			assert.Equal(tt, test.candidate, event.CandidateRevisionName)
+			assert.Equal(tt, test.outPercent, event.CandidateRevisionPercent)
+			assert.Equal(tt, test.outURL, event.CandidateRevisionURL)
+			assert.Equal(tt, test.event == notification.PromotedEvent, event.CandidateWasPromotedToStable)
+			assert.Equal(tt, test.traffic, event.Traffic)
+
+			// The service traffic configuration must not be modified.
+			for _, target := range svc.Spec.Traffic {
+				assert.Empty(tt, target.Url)
+			}
+		})
+	}
+}
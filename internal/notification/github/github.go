@@ -0,0 +1,231 @@
+// Package github reports the progress of rollouts as GitHub deployment
+// statuses.
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// Annotations of a revision that identify the commit it was built from.
+const (
+	// RepositoryAnnotation is the repository in the form owner/name.
+	RepositoryAnnotation = "rollout.cloud.run/githubRepository"
+	// CommitAnnotation is the SHA of the commit.
+	CommitAnnotation = "rollout.cloud.run/commitSHA"
+)
+
+// DefaultAPIURL is the URL of the GitHub API.
+const DefaultAPIURL = "https://api.github.com"
+
+// Deployment states.
+const (
+	queuedState     = "queued"
+	inProgressState = "in_progress"
+	successState    = "success"
+	failureState    = "failure"
+)
+
+// maxDescriptionLength is the maximum length of a deployment status
+// description.
+const maxDescriptionLength = 140
+
+// previewMediaTypes enable the in_progress and queued states, as well as the
+// environment URL of a deployment status.
+const previewMediaTypes = "application/vnd.github.flash-preview+json, application/vnd.github.ant-man-preview+json"
+
+// GitHub updates the deployment of the candidate's commit as the rollout
+// progresses.
+type GitHub struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// deployment is a GitHub deployment.
+type deployment struct {
+	ID int64 `json:"id"`
+}
+
+// New initializes a notifier that reports deployment statuses to the GitHub
+// API in the configuration, using the token.
+func New(cfg config.GitHub, token string) *GitHub {
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &GitHub{
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithHTTPClient updates the HTTP client used to call the API.
+func (g *GitHub) WithHTTPClient(client *http.Client) *GitHub {
+	g.client = client
+	return g
+}
+
+// Notify updates the status of the deployment of the candidate.
+//
+// The deployment is found, or created, for the commit in the annotations of
+// the candidate revision and an environment for the service and region. The
+// status is in_progress at each step, success once the candidate is promoted
+// and failure if it is rolled back. Other events, and candidates without the
+// annotations, are ignored.
+func (g *GitHub) Notify(ctx context.Context, event notification.RolloutEvent) error {
+	var state string
+	switch event.Event {
+	case notification.CandidateDetectedEvent:
+		state = queuedState
+	case notification.InitialTrafficEvent, notification.StepAdvancedEvent:
+		state = inProgressState
+	case notification.PromotedEvent:
+		state = successState
+	case notification.RolledBackEvent:
+		state = failureState
+	default:
+		return nil
+	}
+
+	logger := util.LoggerFrom(ctx)
+	repo, sha := commitOf(event.Service, event.CandidateRevisionName)
+	if repo == "" || sha == "" {
+		logger.Debug("candidate has no commit annotations, skipping GitHub deployment")
+		return nil
+	}
+	environment := fmt.Sprintf("%s/%s/%s", event.Project, event.Region, event.ServiceName)
+	logger = logger.WithFields(logrus.Fields{"repository": repo, "sha": sha, "environment": environment})
+
+	id, err := g.deployment(ctx, repo, sha, environment, event.CandidateRevisionName)
+	if err != nil {
+		return errors.Wrap(err, "failed to get GitHub deployment")
+	}
+
+	status := map[string]interface{}{
+		"state":           state,
+		"description":     truncate(description(event), maxDescriptionLength),
+		"environment_url": event.CandidateRevisionURL,
+		"auto_inactive":   state == successState,
+	}
+	path := fmt.Sprintf("/repos/%s/deployments/%d/statuses", repo, id)
+	if err := g.do(ctx, http.MethodPost, path, status, nil); err != nil {
+		return errors.Wrap(err, "failed to create GitHub deployment status")
+	}
+	logger.WithFields(logrus.Fields{"deployment": id, "state": state}).Debug("GitHub deployment status created")
+	return nil
+}
+
+// deployment returns the ID of the deployment of the commit to the
+// environment, creating it if it does not exist.
+func (g *GitHub) deployment(ctx context.Context, repo, sha, environment, revision string) (int64, error) {
+	query := url.Values{"sha": {sha}, "environment": {environment}}
+	var deployments []deployment
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/deployments?%s", repo, query.Encode()), nil, &deployments); err != nil {
+		return 0, errors.Wrap(err, "failed to list deployments")
+	}
+	if len(deployments) != 0 {
+		return deployments[0].ID, nil
+	}
+
+	var created deployment
+	err := g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/deployments", repo), map[string]interface{}{
+		"ref":               sha,
+		"environment":       environment,
+		"description":       fmt.Sprintf("Gradual rollout of revision %s", revision),
+		"auto_merge":        false,
+		"required_contexts": []string{},
+		"payload":           map[string]string{"revision": revision},
+	}, &created)
+	return created.ID, errors.Wrap(err, "failed to create deployment")
+}
+
+// do calls the API and decodes the response into out, if not nil.
+func (g *GitHub) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, g.apiURL+path, body)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", previewMediaTypes)
+	req.Header.Set("Authorization", "token "+g.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "failed to decode response")
+}
+
+// commitOf returns the repository and commit SHA in the annotations of the
+// candidate revision.
+//
+// The annotations are read from the revision template of the service, which
+// is ignored if it describes a revision other than the candidate.
+func commitOf(svc *run.Service, candidate string) (string, string) {
+	if svc == nil || svc.Spec == nil || svc.Spec.Template == nil || svc.Spec.Template.Metadata == nil {
+		return "", ""
+	}
+	meta := svc.Spec.Template.Metadata
+	if meta.Name != "" && meta.Name != candidate {
+		return "", ""
+	}
+	return meta.Annotations[RepositoryAnnotation], meta.Annotations[CommitAnnotation]
+}
+
+// description returns the description of the deployment status.
+func description(event notification.RolloutEvent) string {
+	switch event.Event {
+	case notification.CandidateDetectedEvent:
+		return fmt.Sprintf("Revision %s detected", event.CandidateRevisionName)
+	case notification.PromotedEvent:
+		return fmt.Sprintf("Revision %s promoted to stable", event.CandidateRevisionName)
+	case notification.RolledBackEvent:
+		return fmt.Sprintf("Revision %s rolled back, %s", event.CandidateRevisionName, event.Reason)
+	default:
+		return fmt.Sprintf("Revision %s serving %d%% of the traffic", event.CandidateRevisionName, event.CandidateRevisionPercent)
+	}
+}
+
+// truncate shortens the string to the maximum length.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
@@ -0,0 +1,162 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/github"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+// fakeGitHub is a stand-in for the deployments API of GitHub.
+type fakeGitHub struct {
+	mu          sync.Mutex
+	deployments map[string]int64
+	statuses    map[int64][]string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "token secret" {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/owner/repo/deployments":
+		key := r.URL.Query().Get("sha") + "@" + r.URL.Query().Get("environment")
+		var deployments []map[string]int64
+		if id, ok := f.deployments[key]; ok {
+			deployments = append(deployments, map[string]int64{"id": id})
+		}
+		json.NewEncoder(w).Encode(deployments)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/owner/repo/deployments":
+		var req struct {
+			Ref         string `json:"ref"`
+			Environment string `json:"environment"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		id := int64(len(f.deployments) + 1)
+		f.deployments[req.Ref+"@"+req.Environment] = id
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+	case r.Method == http.MethodPost:
+		var id int64
+		if _, err := fmt.Sscanf(r.URL.Path, "/repos/owner/repo/deployments/%d/statuses", &id); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			State string `json:"state"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.statuses[id] = append(f.statuses[id], req.State)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	newService := func(revision string, annotations map[string]string) *run.Service {
+		return &run.Service{
+			Spec: &run.ServiceSpec{
+				Template: &run.RevisionTemplate{
+					Metadata: &run.ObjectMeta{Name: revision, Annotations: annotations},
+				},
+			},
+		}
+	}
+	annotations := map[string]string{
+		github.RepositoryAnnotation: "owner/repo",
+		github.CommitAnnotation:     "abc123",
+	}
+
+	var tests = []struct {
+		name        string
+		events      []notification.EventType
+		service     *run.Service
+		outStatuses map[int64][]string
+		shouldErr   bool
+	}{
+		{
+			name: "promoted candidate",
+			events: []notification.EventType{
+				notification.CandidateDetectedEvent,
+				notification.InitialTrafficEvent,
+				notification.WaitingEvent,
+				notification.StepAdvancedEvent,
+				notification.PromotedEvent,
+			},
+			service:     newService("mysvc-002", annotations),
+			outStatuses: map[int64][]string{1: {"queued", "in_progress", "in_progress", "success"}},
+		},
+		{
+			name: "rolled back candidate",
+			events: []notification.EventType{
+				notification.InitialTrafficEvent,
+				notification.RolledBackEvent,
+			},
+			service:     newService("", annotations),
+			outStatuses: map[int64][]string{1: {"in_progress", "failure"}},
+		},
+		{
+			name:        "no annotations",
+			events:      []notification.EventType{notification.InitialTrafficEvent},
+			service:     newService("mysvc-002", nil),
+			outStatuses: map[int64][]string{},
+		},
+		{
+			name:        "template of another revision",
+			events:      []notification.EventType{notification.InitialTrafficEvent},
+			service:     newService("mysvc-003", annotations),
+			outStatuses: map[int64][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			fake := &fakeGitHub{deployments: make(map[string]int64), statuses: make(map[int64][]string)}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			gh := github.New(config.GitHub{APIURL: server.URL}, "secret")
+			for _, eventType := range test.events {
+				err := gh.Notify(context.Background(), notification.RolloutEvent{
+					Event:                 eventType,
+					Project:               "myproject",
+					Region:                "us-east1",
+					ServiceName:           "mysvc",
+					CandidateRevisionName: "mysvc-002",
+					Service:               test.service,
+				})
+				assert.Nil(tt, err)
+			}
+			assert.Equal(tt, test.outStatuses, fake.statuses)
+		})
+	}
+
+	t.Run("API error", func(tt *testing.T) {
+		fake := &fakeGitHub{deployments: make(map[string]int64), statuses: make(map[int64][]string)}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		gh := github.New(config.GitHub{APIURL: server.URL}, "wrong")
+		err := gh.Notify(context.Background(), notification.RolloutEvent{
+			Event:                 notification.PromotedEvent,
+			CandidateRevisionName: "mysvc-002",
+			Service:               newService("mysvc-002", annotations),
+		})
+		assert.NotNil(tt, err)
+	})
+}
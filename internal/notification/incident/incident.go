@@ -0,0 +1,253 @@
+// Package incident opens alerts when candidates are rolled back.
+package incident
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PagerDutyEventsURL is the URL of the PagerDuty Events API v2.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Alert actions.
+const (
+	triggerAction = "trigger"
+	resolveAction = "resolve"
+)
+
+// Client opens an alert when a candidate is rolled back, and resolves it when
+// a candidate of the service is promoted.
+type Client struct {
+	provider   string
+	url        string
+	routingKey string
+	severity   string
+	client     *http.Client
+
+	// open are the dedup keys of the alerts triggered for each service.
+	mu   sync.Mutex
+	open map[string][]string
+}
+
+// alert is an alert to trigger or resolve.
+type alert struct {
+	action          string
+	dedupKey        string
+	summary         string
+	event           notification.RolloutEvent
+	failingCriteria []health.CheckReport
+}
+
+// New initializes a client to the provider in the configuration. The routing
+// key is only used by the pagerduty provider.
+func New(cfg config.Incidents, routingKey string) *Client {
+	url := cfg.URL
+	if url == "" && cfg.Provider == config.PagerDutyIncidentProvider {
+		url = PagerDutyEventsURL
+	}
+	severity := cfg.Severity
+	if severity == "" {
+		severity = "error"
+	}
+	return &Client{
+		provider:   cfg.Provider,
+		url:        url,
+		routingKey: routingKey,
+		severity:   severity,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		open:       make(map[string][]string),
+	}
+}
+
+// WithHTTPClient updates the HTTP client used to send alerts.
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	c.client = client
+	return c
+}
+
+// Notify triggers an alert if the candidate was rolled back, or resolves the
+// alerts of the service if the candidate was promoted.
+//
+// The alerts are deduplicated per candidate. A promotion resolves the alerts
+// triggered for the service since the last promotion, and the alert of the
+// service's last failed candidate. Manual rollbacks do not trigger alerts.
+func (c *Client) Notify(ctx context.Context, event notification.RolloutEvent) error {
+	service := fmt.Sprintf("%s/%s/%s", event.Project, event.Region, event.ServiceName)
+	switch event.Event {
+	case notification.RolledBackEvent:
+		if event.Action != "" {
+			return nil
+		}
+		a := alert{
+			action:          triggerAction,
+			dedupKey:        DedupKey(event.Project, event.Region, event.ServiceName, event.CandidateRevisionName),
+			summary:         fmt.Sprintf("Candidate %s of service %s was rolled back in %s: %s", event.CandidateRevisionName, event.ServiceName, event.Region, event.Reason),
+			event:           event,
+			failingCriteria: failingCriteria(event.Diagnosis),
+		}
+		if err := c.sendAlert(ctx, a); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.open[service] = appendKey(c.open[service], a.dedupKey)
+		c.mu.Unlock()
+		return nil
+	case notification.PromotedEvent:
+		c.mu.Lock()
+		keys := c.open[service]
+		delete(c.open, service)
+		c.mu.Unlock()
+		if event.Service != nil {
+			if failed := event.Service.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation]; failed != "" {
+				keys = appendKey(keys, DedupKey(event.Project, event.Region, event.ServiceName, failed))
+			}
+		}
+
+		var unresolved, errs []string
+		for _, key := range keys {
+			a := alert{
+				action:   resolveAction,
+				dedupKey: key,
+				summary:  fmt.Sprintf("Candidate %s of service %s was promoted in %s", event.CandidateRevisionName, event.ServiceName, event.Region),
+				event:    event,
+			}
+			if err := c.sendAlert(ctx, a); err != nil {
+				unresolved = append(unresolved, key)
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) != 0 {
+			c.mu.Lock()
+			for _, key := range unresolved {
+				c.open[service] = appendKey(c.open[service], key)
+			}
+			c.mu.Unlock()
+			return errors.Errorf("failed to resolve %d of %d alerts: %s", len(errs), len(keys), strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// sendAlert sends a single alert to the provider.
+func (c *Client) sendAlert(ctx context.Context, a alert) error {
+	body, err := c.payload(a)
+	if err != nil {
+		return errors.Wrap(err, "failed to create alert")
+	}
+	if err := c.send(ctx, body); err != nil {
+		return errors.Wrapf(err, "failed to %s alert", a.action)
+	}
+	util.LoggerFrom(ctx).WithFields(logrus.Fields{"action": a.action, "dedupKey": a.dedupKey}).Info("incident alert sent")
+	return nil
+}
+
+// DedupKey returns the key that identifies the alert of a candidate.
+func DedupKey(project, region, service, candidate string) string {
+	return fmt.Sprintf("cloud-run-rollout/%s/%s/%s/%s", project, region, service, candidate)
+}
+
+// appendKey appends the key to the keys if it is not one of them.
+func appendKey(keys []string, key string) []string {
+	for _, k := range keys {
+		if k == key {
+			return keys
+		}
+	}
+	return append(keys, key)
+}
+
+// payload returns the request body of the alert for the provider.
+func (c *Client) payload(a alert) ([]byte, error) {
+	e := a.event
+	if c.provider == config.WebhookIncidentProvider {
+		return json.Marshal(map[string]interface{}{
+			"action":          a.action,
+			"dedupKey":        a.dedupKey,
+			"summary":         a.summary,
+			"severity":        c.severity,
+			"project":         e.Project,
+			"region":          e.Region,
+			"service":         e.ServiceName,
+			"candidate":       e.CandidateRevisionName,
+			"stable":          e.StableRevisionName,
+			"reason":          e.Reason,
+			"failingCriteria": a.failingCriteria,
+			"healthReport":    e.HealthReport,
+		})
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  c.routingKey,
+		"event_action": a.action,
+		"dedup_key":    a.dedupKey,
+	}
+	if a.action == triggerAction {
+		event["payload"] = map[string]interface{}{
+			"summary":   a.summary,
+			"source":    fmt.Sprintf("projects/%s/locations/%s/services/%s", e.Project, e.Region, e.ServiceName),
+			"severity":  c.severity,
+			"component": e.ServiceName,
+			"group":     e.Region,
+			"class":     "rollback",
+			"custom_details": map[string]interface{}{
+				"candidate":       e.CandidateRevisionName,
+				"stable":          e.StableRevisionName,
+				"strategy":        e.Strategy,
+				"reason":          e.Reason,
+				"failingCriteria": a.failingCriteria,
+				"healthReport":    e.HealthReport,
+			},
+		}
+	}
+	return json.Marshal(event)
+}
+
+// send posts the alert to the provider.
+func (c *Client) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// failingCriteria returns the health criteria the candidate did not meet.
+func failingCriteria(diagnosis *health.DiagnosisReport) []health.CheckReport {
+	if diagnosis == nil {
+		return nil
+	}
+	var failing []health.CheckReport
+	for _, check := range diagnosis.Checks {
+		if !check.Met {
+			failing = append(failing, check)
+		}
+	}
+	return failing
+}
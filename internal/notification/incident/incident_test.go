@@ -0,0 +1,197 @@
+package incident_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/incident"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestNotify(t *testing.T) {
+	diagnosis := &health.DiagnosisReport{
+		Result: "unhealthy",
+		Checks: []health.CheckReport{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 100, ActualValue: 500, Met: true},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 1, ActualValue: 5, Met: false},
+		},
+	}
+	newEvent := func(eventType notification.EventType, candidate string) notification.RolloutEvent {
+		return notification.RolloutEvent{
+			Event:                 eventType,
+			Reason:                "unhealthy candidate",
+			Project:               "myproject",
+			Region:                "us-east1",
+			ServiceName:           "mysvc",
+			StableRevisionName:    "mysvc-001",
+			CandidateRevisionName: candidate,
+			Diagnosis:             diagnosis,
+		}
+	}
+
+	withAction := func(event notification.RolloutEvent, action string) notification.RolloutEvent {
+		event.Action = action
+		return event
+	}
+	withService := func(event notification.RolloutEvent, failed string) notification.RolloutEvent {
+		event.Service = &run.Service{Metadata: &run.ObjectMeta{Annotations: map[string]string{}}}
+		if failed != "" {
+			event.Service.Metadata.Annotations[rollout.LastFailedCandidateRevisionAnnotation] = failed
+		}
+		return event
+	}
+
+	var tests = []struct {
+		name      string
+		provider  string
+		event     notification.RolloutEvent
+		outAlerts []map[string]interface{}
+	}{
+		{
+			name:     "PagerDuty trigger on rollback",
+			provider: config.PagerDutyIncidentProvider,
+			event:    newEvent(notification.RolledBackEvent, "mysvc-002"),
+			outAlerts: []map[string]interface{}{{
+				"routing_key":  "key",
+				"event_action": "trigger",
+				"dedup_key":    "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-002",
+				"payload": map[string]interface{}{
+					"summary":   "Candidate mysvc-002 of service mysvc was rolled back in us-east1: unhealthy candidate",
+					"source":    "projects/myproject/locations/us-east1/services/mysvc",
+					"severity":  "error",
+					"component": "mysvc",
+					"group":     "us-east1",
+					"class":     "rollback",
+					"custom_details": map[string]interface{}{
+						"candidate": "mysvc-002",
+						"stable":    "mysvc-001",
+						"strategy":  "",
+						"reason":    "unhealthy candidate",
+						"failingCriteria": []interface{}{
+							map[string]interface{}{"metric": "error-rate-percent", "threshold": 1.0, "actualValue": 5.0, "met": false},
+						},
+						"healthReport": "",
+					},
+				},
+			}},
+		},
+		{
+			name:     "PagerDuty resolve on promotion",
+			provider: config.PagerDutyIncidentProvider,
+			event:    withService(newEvent(notification.PromotedEvent, "mysvc-003"), "mysvc-002"),
+			outAlerts: []map[string]interface{}{{
+				"routing_key":  "key",
+				"event_action": "resolve",
+				"dedup_key":    "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-002",
+			}},
+		},
+		{
+			name:     "promotion without failed candidates",
+			provider: config.PagerDutyIncidentProvider,
+			event:    withService(newEvent(notification.PromotedEvent, "mysvc-003"), ""),
+		},
+		{
+			name:     "manual rollback",
+			provider: config.PagerDutyIncidentProvider,
+			event:    withAction(newEvent(notification.RolledBackEvent, "mysvc-002"), "rollback"),
+		},
+		{
+			name:     "manual abort",
+			provider: config.PagerDutyIncidentProvider,
+			event:    withAction(newEvent(notification.PausedEvent, "mysvc-002"), "abort"),
+		},
+		{
+			name:     "other events",
+			provider: config.PagerDutyIncidentProvider,
+			event:    newEvent(notification.StepAdvancedEvent, "mysvc-003"),
+		},
+		{
+			name:     "webhook trigger on rollback",
+			provider: config.WebhookIncidentProvider,
+			event:    newEvent(notification.RolledBackEvent, "mysvc-002"),
+			outAlerts: []map[string]interface{}{{
+				"action":    "trigger",
+				"dedupKey":  "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-002",
+				"summary":   "Candidate mysvc-002 of service mysvc was rolled back in us-east1: unhealthy candidate",
+				"severity":  "error",
+				"project":   "myproject",
+				"region":    "us-east1",
+				"service":   "mysvc",
+				"candidate": "mysvc-002",
+				"stable":    "mysvc-001",
+				"reason":    "unhealthy candidate",
+				"failingCriteria": []interface{}{
+					map[string]interface{}{"metric": "error-rate-percent", "threshold": 1.0, "actualValue": 5.0, "met": false},
+				},
+				"healthReport": "",
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var alerts []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var alert map[string]interface{}
+				assert.Nil(tt, json.NewDecoder(r.Body).Decode(&alert))
+				alerts = append(alerts, alert)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			cfg := config.Incidents{Provider: test.provider, URL: server.URL}
+			err := incident.New(cfg, "key").Notify(context.Background(), test.event)
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outAlerts, alerts)
+		})
+	}
+
+	t.Run("promotion resolves the rollbacks of earlier candidates", func(tt *testing.T) {
+		var alerts []map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var alert map[string]interface{}
+			assert.Nil(tt, json.NewDecoder(r.Body).Decode(&alert))
+			alerts = append(alerts, alert)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		client := incident.New(config.Incidents{Provider: config.WebhookIncidentProvider, URL: server.URL}, "")
+		for _, event := range []notification.RolloutEvent{
+			newEvent(notification.RolledBackEvent, "mysvc-002"),
+			newEvent(notification.RolledBackEvent, "mysvc-003"),
+			newEvent(notification.PromotedEvent, "mysvc-004"),
+		} {
+			assert.Nil(tt, client.Notify(context.Background(), event))
+		}
+		var actions []interface{}
+		for _, alert := range alerts {
+			actions = append(actions, []interface{}{alert["action"], alert["dedupKey"]})
+		}
+		assert.Equal(tt, []interface{}{
+			[]interface{}{"trigger", "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-002"},
+			[]interface{}{"trigger", "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-003"},
+			[]interface{}{"resolve", "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-002"},
+			[]interface{}{"resolve", "cloud-run-rollout/myproject/us-east1/mysvc/mysvc-003"},
+		}, actions)
+	})
+
+	t.Run("provider error", func(tt *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"status":"invalid event"}`, http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		cfg := config.Incidents{Provider: config.PagerDutyIncidentProvider, URL: server.URL}
+		err := incident.New(cfg, "key").Notify(context.Background(), newEvent(notification.RolledBackEvent, "mysvc-002"))
+		assert.NotNil(tt, err)
+	})
+}
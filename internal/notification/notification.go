@@ -0,0 +1,31 @@
+// Package notification sends events about the rollouts to external systems.
+package notification
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Notifier sends rollout events to an external system.
+type Notifier interface {
+	Notify(ctx context.Context, event RolloutEvent) error
+}
+
+// Multi sends each event to all of its notifiers.
+type Multi []Notifier
+
+// Notify sends the event to all the notifiers, even if some of them fail.
+func (m Multi) Notify(ctx context.Context, event RolloutEvent) error {
+	var errs []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("failed to notify %d of %d notifiers: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package notification_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulti(t *testing.T) {
+	var notified []string
+	newNotifier := func(name string, err error) *mock.Notifier {
+		return &mock.Notifier{
+			NotifyFn: func(ctx context.Context, event notification.RolloutEvent) error {
+				notified = append(notified, name)
+				return err
+			},
+		}
+	}
+
+	var tests = []struct {
+		name      string
+		notifiers notification.Multi
+		shouldErr bool
+	}{
+		{
+			name:      "all succeed",
+			notifiers: notification.Multi{newNotifier("first", nil), newNotifier("second", nil)},
+		},
+		{
+			name:      "one fails",
+			notifiers: notification.Multi{newNotifier("first", fmt.Errorf("unavailable")), newNotifier("second", nil)},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			notified = nil
+			err := test.notifiers.Notify(context.Background(), notification.RolloutEvent{Event: notification.PromotedEvent})
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+			// Every notifier is called even if one of them fails.
+			assert.Equal(tt, []string{"first", "second"}, notified)
+		})
+	}
+}
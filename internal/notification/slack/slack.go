@@ -0,0 +1,185 @@
+// Package slack posts rollout events to Slack-compatible incoming webhooks.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Slack posts rollout events to incoming webhooks.
+type Slack struct {
+	config config.Slack
+	client *http.Client
+}
+
+// message is the payload of an incoming webhook.
+type message struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// New initializes a notifier that posts to the webhooks in the configuration.
+func New(cfg config.Slack) *Slack {
+	return &Slack{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithHTTPClient updates the HTTP client used to post messages.
+func (s *Slack) WithHTTPClient(client *http.Client) *Slack {
+	s.client = client
+	return s
+}
+
+// Notify posts a message about the event to every matching route, or to the
+// default webhook if no route matches. The message is posted to all the
+// matching routes even if some of them fail.
+func (s *Slack) Notify(ctx context.Context, event notification.RolloutEvent) error {
+	logger := util.LoggerFrom(ctx)
+	text := formatEvent(event)
+
+	var labels map[string]string
+	if event.Service != nil && event.Service.Metadata != nil {
+		labels = event.Service.Metadata.Labels
+	}
+	var (
+		routes int
+		errs   []string
+	)
+	for _, route := range s.config.Routes {
+		if route.Strategy != "" && route.Strategy != event.Strategy {
+			continue
+		}
+		if route.LabelSelector != "" && !config.MatchLabels(route.LabelSelector, labels) {
+			continue
+		}
+		routes++
+		if err := s.post(ctx, route.WebhookURL, message{Channel: route.Channel, Text: text}); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if routes == 0 && s.config.WebhookURL != "" {
+		routes++
+		if err := s.post(ctx, s.config.WebhookURL, message{Text: text}); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if routes == 0 {
+		logger.Debug("no Slack webhook matches the event")
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("failed to post to %d of %d Slack webhooks: %s", len(errs), routes, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// post sends the message to the webhook.
+func (s *Slack) post(ctx context.Context, webhookURL string, msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal Slack message")
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create Slack request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post Slack message")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("failed to post Slack message, status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	util.LoggerFrom(ctx).WithFields(logrus.Fields{"channel": msg.Channel, "size": len(data)}).Debug("event posted to Slack")
+	return nil
+}
+
+// formatEvent returns the text of the message about the event.
+func formatEvent(event notification.RolloutEvent) string {
+	text := fmt.Sprintf("*%s* (%s, %s): %s", event.ServiceName, event.Project, event.Region, describeEvent(event))
+
+	candidate := fmt.Sprintf("`%s`", event.CandidateRevisionName)
+	if event.CandidateRevisionURL != "" {
+		candidate = fmt.Sprintf("<%s|%s>", event.CandidateRevisionURL, event.CandidateRevisionName)
+	}
+	if event.CandidateRevisionName != "" {
+		text += fmt.Sprintf("\ncandidate: %s, stable: `%s`", candidate, event.StableRevisionName)
+	}
+	if split := formatTraffic(event); split != "" {
+		text += "\ntraffic: " + split
+	}
+	if event.Strategy != "" {
+		text += fmt.Sprintf("\nstrategy: %s", event.Strategy)
+	}
+	if event.HealthReport != "" {
+		text += fmt.Sprintf("\n```%s```", event.HealthReport)
+	}
+	return text
+}
+
+// describeEvent returns a short description of what happened.
+func describeEvent(event notification.RolloutEvent) string {
+	var description string
+	switch event.Event {
+	case notification.CandidateDetectedEvent:
+		description = "new candidate detected"
+	case notification.InitialTrafficEvent:
+		description = fmt.Sprintf("candidate started receiving %d%% of the traffic", event.CandidateRevisionPercent)
+	case notification.StepAdvancedEvent:
+		description = fmt.Sprintf("candidate advanced to %d%% of the traffic", event.CandidateRevisionPercent)
+	case notification.WaitingEvent:
+		description = "rollout waiting"
+	case notification.InconclusiveEvent:
+		description = "candidate health inconclusive"
+	case notification.PromotedEvent:
+		description = "candidate promoted to stable"
+	case notification.RolledBackEvent:
+		description = "candidate rolled back"
+	case notification.PausedEvent:
+		description = "rollout paused"
+	case notification.ErrorEvent:
+		description = "rollout failed"
+	default:
+		description = string(event.Event)
+	}
+
+	if event.Reason != "" {
+		description += ", " + event.Reason
+	}
+	if event.Error != "" {
+		description += ": " + event.Error
+	}
+	return description
+}
+
+// formatTraffic returns the traffic split after the event.
+func formatTraffic(event notification.RolloutEvent) string {
+	var split []string
+	for _, target := range event.Traffic {
+		if target.RevisionName == "" || target.Percent == 0 {
+			continue
+		}
+		split = append(split, fmt.Sprintf("`%s` %d%%", target.RevisionName, target.Percent))
+	}
+	return strings.Join(split, ", ")
+}
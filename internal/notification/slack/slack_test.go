@@ -0,0 +1,161 @@
+package slack_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/slack"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+type received struct {
+	path    string
+	channel string
+	text    string
+}
+
+func TestNotify(t *testing.T) {
+	var messages []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+			return
+		}
+		var msg struct {
+			Channel string `json:"channel"`
+			Text    string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatalf("invalid message: %v", err)
+		}
+		messages = append(messages, received{path: r.URL.Path, channel: msg.Channel, text: msg.Text})
+	}))
+	defer server.Close()
+
+	routes := []config.SlackRoute{
+		{LabelSelector: "team=payments", WebhookURL: server.URL + "/payments", Channel: "#payments-deploys"},
+		{Strategy: "backend", LabelSelector: "tier", WebhookURL: server.URL + "/backend"},
+		{Strategy: "frontend", LabelSelector: "team!=payments", WebhookURL: server.URL + "/frontend"},
+	}
+
+	var tests = []struct {
+		name       string
+		cfg        config.Slack
+		strategy   string
+		labels     map[string]string
+		outPaths   []string
+		outChannel string
+		shouldErr  bool
+	}{
+		{
+			name:       "route by label",
+			cfg:        config.Slack{WebhookURL: server.URL + "/default", Routes: routes},
+			strategy:   "other",
+			labels:     map[string]string{"team": "payments"},
+			outPaths:   []string{"/payments"},
+			outChannel: "#payments-deploys",
+		},
+		{
+			name:     "route by strategy and label",
+			cfg:      config.Slack{WebhookURL: server.URL + "/default", Routes: routes},
+			strategy: "backend",
+			labels:   map[string]string{"team": "payments", "tier": "api"},
+			outPaths: []string{"/backend", "/payments"},
+		},
+		{
+			name:     "excluded by label",
+			cfg:      config.Slack{WebhookURL: server.URL + "/default", Routes: routes},
+			strategy: "frontend",
+			labels:   map[string]string{"team": "payments"},
+			outPaths: []string{"/payments"},
+		},
+		{
+			name:     "default webhook",
+			cfg:      config.Slack{WebhookURL: server.URL + "/default", Routes: routes},
+			strategy: "backend",
+			labels:   map[string]string{"team": "search"},
+			outPaths: []string{"/default"},
+		},
+		{
+			name:     "no matching webhook",
+			cfg:      config.Slack{Routes: routes},
+			strategy: "backend",
+		},
+		{
+			name:      "webhook error",
+			cfg:       config.Slack{WebhookURL: server.URL + "/broken"},
+			strategy:  "backend",
+			shouldErr: true,
+		},
+		{
+			name: "route error does not stop the other routes",
+			cfg: config.Slack{Routes: []config.SlackRoute{
+				{WebhookURL: server.URL + "/broken"},
+				{WebhookURL: server.URL + "/payments"},
+			}},
+			strategy:  "backend",
+			outPaths:  []string{"/payments"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			messages = nil
+			event := notification.RolloutEvent{
+				Event:                    notification.StepAdvancedEvent,
+				Project:                  "myproject",
+				Region:                   "us-east1",
+				ServiceName:              "mysvc",
+				Strategy:                 test.strategy,
+				StableRevisionName:       "mysvc-001",
+				CandidateRevisionName:    "mysvc-002",
+				CandidateRevisionPercent: 50,
+				CandidateRevisionURL:     "https://candidate---mysvc.a.run.app",
+				Traffic: []*run.TrafficTarget{
+					{RevisionName: "mysvc-001", Percent: 50, Tag: "stable"},
+					{RevisionName: "mysvc-002", Percent: 50, Tag: "candidate"},
+					{LatestRevision: true, Tag: "latest"},
+				},
+				HealthReport: "status: healthy\nmetrics:\n- error-rate-percent: 0.50 (needs 1.00)",
+				Service: &run.Service{
+					Metadata: &run.ObjectMeta{Labels: test.labels},
+				},
+			}
+
+			err := slack.New(test.cfg).Notify(context.Background(), event)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+
+			var paths []string
+			for _, msg := range messages {
+				paths = append(paths, msg.path)
+			}
+			sort.Strings(paths)
+			assert.Equal(tt, test.outPaths, paths)
+			if len(messages) == 0 {
+				return
+			}
+
+			if test.outChannel != "" {
+				assert.Equal(tt, test.outChannel, messages[0].channel)
+			}
+			expected := "*mysvc* (myproject, us-east1): candidate advanced to 50% of the traffic\n" +
+				"candidate: <https://candidate---mysvc.a.run.app|mysvc-002>, stable: `mysvc-001`\n" +
+				"traffic: `mysvc-001` 50%, `mysvc-002` 50%\n" +
+				"strategy: " + test.strategy + "\n" +
+				"```status: healthy\nmetrics:\n- error-rate-percent: 0.50 (needs 1.00)```"
+			assert.Equal(tt, expected, messages[0].text)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package webhook posts rollout events as signed JSON to HTTPS endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers of the requests.
+const (
+	// TimestampHeader is the Unix time, in seconds, when the request was sent.
+	TimestampHeader = "X-Rollout-Timestamp"
+
+	// SignatureHeader is the hex-encoded HMAC-SHA256 of the timestamp and the
+	// body, separated by a dot, prefixed by "sha256=".
+	SignatureHeader = "X-Rollout-Signature"
+)
+
+// Defaults for the retries.
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+)
+
+// Webhook posts rollout events to an HTTPS endpoint.
+type Webhook struct {
+	url            string
+	secret         []byte
+	maxAttempts    int
+	backoff        time.Duration
+	deadLetterFile string
+	client         *http.Client
+	time           clockwork.Clock
+
+	// Used to serialize writes to the dead letter file.
+	mu sync.Mutex
+}
+
+// deadLetter is a line of the dead letter file.
+type deadLetter struct {
+	Time  time.Time                 `json:"time"`
+	URL   string                    `json:"url"`
+	Error string                    `json:"error"`
+	Event notification.RolloutEvent `json:"event"`
+}
+
+// New initializes a notifier that posts to the webhook in the configuration
+// and signs the requests with the secret.
+func New(cfg config.Webhook, secret []byte) *Webhook {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return &Webhook{
+		url:            cfg.URL,
+		secret:         secret,
+		maxAttempts:    maxAttempts,
+		backoff:        defaultBackoff,
+		deadLetterFile: cfg.DeadLetterFile,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		time:           clockwork.NewRealClock(),
+	}
+}
+
+// WithHTTPClient updates the HTTP client used to post events.
+func (w *Webhook) WithHTTPClient(client *http.Client) *Webhook {
+	w.client = client
+	return w
+}
+
+// WithClock updates the clock used to sign requests and wait between
+// attempts.
+func (w *Webhook) WithClock(clock clockwork.Clock) *Webhook {
+	w.time = clock
+	return w
+}
+
+// WithBackoff updates the initial time to wait between attempts, which
+// doubles after each attempt.
+func (w *Webhook) WithBackoff(backoff time.Duration) *Webhook {
+	w.backoff = backoff
+	return w
+}
+
+// Notify posts the event to the webhook.
+//
+// Requests that fail with a network error, a 429 or a 5xx status are retried,
+// unless the context is done. If the event cannot be delivered, it is written
+// to the dead letter file, if any, and an error is returned.
+func (w *Webhook) Notify(ctx context.Context, event notification.RolloutEvent) error {
+	logger := util.LoggerFrom(ctx).WithField("url", w.url)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+	fail := func(err error) error {
+		if dlErr := w.writeDeadLetter(event, err); dlErr != nil {
+			logger.WithError(dlErr).Error("could not write event to dead letter file")
+		}
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := w.post(ctx, body)
+		if err == nil {
+			logger.WithField("attempt", attempt).Debug("event posted to webhook")
+			return nil
+		}
+		if !retryable || attempt >= w.maxAttempts {
+			return fail(errors.Wrapf(err, "failed to post event to webhook after %d attempts", attempt))
+		}
+
+		logger.WithFields(logrus.Fields{"attempt": attempt, "backoff": backoff}).WithError(err).Warn("failed to post event to webhook, retrying")
+		select {
+		case <-ctx.Done():
+			return fail(errors.Wrapf(err, "failed to post event to webhook after %d attempts, %v", attempt, ctx.Err()))
+		case <-w.time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a signed request with the body. It returns whether the request
+// can be retried if it failed.
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	timestamp := strconv.FormatInt(w.time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, errors.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
+
+// writeDeadLetter appends the undelivered event to the dead letter file.
+func (w *Webhook) writeDeadLetter(event notification.RolloutEvent, deliveryErr error) error {
+	if w.deadLetterFile == "" {
+		return nil
+	}
+	line, err := json.Marshal(deadLetter{
+		Time:  w.time.Now(),
+		URL:   w.url,
+		Error: deliveryErr.Error(),
+		Event: event,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dead letter")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.OpenFile(w.deadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open dead letter file")
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write dead letter")
+	}
+	return errors.Wrap(f.Close(), "failed to close dead letter file")
+}
+
+// Sign returns the signature of a request with the given timestamp and body.
+//
+// Receivers should compute the same signature and compare it to the one in the
+// SignatureHeader, and reject requests with an old timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package webhook_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/webhook"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	secret := []byte("s3cr3t")
+	clockMock := clockwork.NewFakeClock()
+
+	var tests = []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		backoff      time.Duration
+		cancel       bool
+		outAttempts  int
+		deadLettered bool
+		shouldErr    bool
+	}{
+		{
+			name:        "delivered",
+			statuses:    []int{http.StatusOK},
+			outAttempts: 1,
+		},
+		{
+			name:        "delivered after retries",
+			statuses:    []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusAccepted},
+			maxAttempts: 3,
+			outAttempts: 3,
+		},
+		{
+			name:         "retries exhausted",
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			maxAttempts:  2,
+			outAttempts:  2,
+			deadLettered: true,
+			shouldErr:    true,
+		},
+		{
+			name:         "not retryable",
+			statuses:     []int{http.StatusBadRequest},
+			maxAttempts:  3,
+			outAttempts:  1,
+			deadLettered: true,
+			shouldErr:    true,
+		},
+		{
+			name:         "cancelled while waiting to retry",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			maxAttempts:  3,
+			backoff:      time.Minute,
+			cancel:       true,
+			outAttempts:  1,
+			deadLettered: true,
+			shouldErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var attempts int
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				timestamp := r.Header.Get(webhook.TimestampHeader)
+				assert.Equal(tt, strconv.FormatInt(clockMock.Now().Unix(), 10), timestamp)
+				expected := webhook.Sign(secret, timestamp, body)
+				assert.True(tt, hmac.Equal([]byte(expected), []byte(r.Header.Get(webhook.SignatureHeader))))
+
+				var event notification.RolloutEvent
+				assert.Nil(tt, json.Unmarshal(body, &event))
+				assert.Equal(tt, notification.PromotedEvent, event.Event)
+
+				w.WriteHeader(test.statuses[attempts])
+				attempts++
+				if test.cancel {
+					cancel()
+				}
+			}))
+			defer server.Close()
+
+			dir, err := ioutil.TempDir("", "webhook")
+			if err != nil {
+				tt.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			deadLetterFile := filepath.Join(dir, "dead-letters.ndjson")
+
+			cfg := config.Webhook{URL: server.URL, MaxAttempts: test.maxAttempts, DeadLetterFile: deadLetterFile}
+			w := webhook.New(cfg, secret).
+				WithHTTPClient(server.Client()).
+				WithClock(clockMock).
+				WithBackoff(test.backoff)
+
+			event := notification.RolloutEvent{Event: notification.PromotedEvent, ServiceName: "mysvc"}
+			err = w.Notify(ctx, event)
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+			assert.Equal(tt, test.outAttempts, attempts)
+
+			f, err := os.Open(deadLetterFile)
+			if !test.deadLettered {
+				assert.True(tt, os.IsNotExist(err))
+				return
+			}
+			if err != nil {
+				tt.Fatal(err)
+			}
+			defer f.Close()
+			var lines []map[string]interface{}
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var line map[string]interface{}
+				assert.Nil(tt, json.Unmarshal(scanner.Bytes(), &line))
+				lines = append(lines, line)
+			}
+			assert.Len(tt, lines, 1)
+			assert.Equal(tt, server.URL, lines[0]["url"])
+			assert.Equal(tt, "mysvc", lines[0]["event"].(map[string]interface{})["serviceName"])
+		})
+	}
+}
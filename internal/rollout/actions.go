@@ -0,0 +1,164 @@
+package rollout
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// PausedAnnotation is the reason why the rollout of the service was paused.
+// The rollout is not paused if it is missing.
+const PausedAnnotation = "rollout.cloud.run/paused"
+
+// Action is a manual action on the rollout of a service.
+type Action string
+
+// Manual actions.
+const (
+	// PauseAction keeps the current traffic until the rollout is resumed.
+	PauseAction Action = "pause"
+	// ResumeAction resumes a paused rollout.
+	ResumeAction Action = "resume"
+	// AbortAction sends all the traffic back to the stable revision and pauses
+	// the rollout. The candidate is not marked as failed, so it starts over
+	// once the rollout is resumed.
+	AbortAction Action = "abort"
+	// PromoteAction makes the candidate stable right away.
+	PromoteAction Action = "promote"
+	// RollbackAction sends all the traffic back to the stable revision and
+	// marks the candidate as failed.
+	RollbackAction Action = "rollback"
+	// RetryAction clears the last failed candidate, so it is rolled out again
+	// if it is still the latest revision.
+	RetryAction Action = "retry"
+)
+
+// Actions are all the manual actions.
+var Actions = []Action{PauseAction, ResumeAction, AbortAction, PromoteAction, RollbackAction, RetryAction}
+
+// Reasons recorded for the manual actions.
+const (
+	pausedManuallyReason     = "paused manually"
+	abortedManuallyReason    = "aborted manually"
+	promotedManuallyReason   = "promoted manually"
+	rolledBackManuallyReason = "rolled back manually"
+)
+
+// notApplicableError is returned when an action does not apply to the
+// current state of the service.
+type notApplicableError struct {
+	action Action
+	reason string
+}
+
+func (e *notApplicableError) Error() string {
+	return fmt.Sprintf("cannot %s rollout: %s", e.action, e.reason)
+}
+
+// IsNotApplicable determines if the error is caused by an action that does
+// not apply to the current state of the service.
+func IsNotApplicable(err error) bool {
+	_, ok := errors.Cause(err).(*notApplicableError)
+	return ok
+}
+
+// IsPaused determines if the rollout of the service is paused.
+func IsPaused(svc *run.Service) bool {
+	return svc.Metadata.Annotations[PausedAnnotation] != ""
+}
+
+// Apply performs the manual action on the service.
+//
+// The traffic is configured with the same tags as an automatic rollout, and
+// the events of the action are sent to the notifier. If the service was
+// modified since it was retrieved, the action is retried with its latest
+// version. An error satisfying IsNotApplicable is returned if the action does
+// not apply to the state of the service.
+func (r *Rollout) Apply(action Action) (bool, error) {
+	trafficChanged, err := r.update(func(svc *run.Service) (*run.Service, bool, error) {
+		return r.applyAction(svc, action)
+	})
+	return trafficChanged, errors.Wrapf(err, "failed to %s rollout", action)
+}
+
+// applyAction changes the traffic configuration and annotations of the service
+// for the action and updates the service.
+func (r *Rollout) applyAction(svc *run.Service, action Action) (*run.Service, bool, error) {
+	r.recordPreviousState(svc)
+	r.action = action
+	r.stable = DetectStableRevisionName(svc)
+	if r.stable != "" {
+		r.candidate = DetectCandidateRevisionName(svc, r.stable)
+	}
+	stable, candidate := r.stable, r.candidate
+	notApplicable := func(reason string) (*run.Service, bool, error) {
+		return svc, false, &notApplicableError{action: action, reason: reason}
+	}
+
+	var trafficChanged bool
+	switch action {
+	case PauseAction:
+		if IsPaused(svc) {
+			return notApplicable("rollout is already paused")
+		}
+		setAnnotation(svc, PausedAnnotation, pausedManuallyReason)
+		if candidate != "" {
+			r.addEvent(svc, notification.PausedEvent, pausedManuallyReason)
+		}
+	case ResumeAction:
+		if !IsPaused(svc) {
+			return notApplicable("rollout is not paused")
+		}
+		delete(svc.Metadata.Annotations, PausedAnnotation)
+	case AbortAction:
+		if candidate == "" {
+			return notApplicable("no candidate to abort")
+		}
+		trafficChanged = !isNewCandidate(svc, candidate)
+		svc.Spec.Traffic = r.rollbackTraffic(svc.Spec.Traffic, stable, candidate)
+		svc = r.updateAnnotations(svc, stable, candidate)
+		setAnnotation(svc, PausedAnnotation, abortedManuallyReason)
+		r.setHealthReportAnnotation(svc, "status: paused, "+abortedManuallyReason)
+		r.addEvent(svc, notification.PausedEvent, abortedManuallyReason)
+	case PromoteAction:
+		if candidate == "" {
+			return notApplicable("no candidate to promote")
+		}
+		r.shouldRollout, r.promoteToStable = true, true
+		trafficChanged = true
+		svc.Spec.Traffic = append([]*run.TrafficTarget{newTrafficTarget(candidate, 100, StableTag)}, inheritRevisionTags(svc.Spec.Traffic)...)
+		svc = r.updateAnnotations(svc, stable, candidate)
+		delete(svc.Metadata.Annotations, PausedAnnotation)
+		r.setHealthReportAnnotation(svc, "status: promoted, "+promotedManuallyReason)
+		r.addEvent(svc, notification.PromotedEvent, promotedManuallyReason)
+	case RollbackAction:
+		if candidate == "" {
+			return notApplicable("no candidate to roll back")
+		}
+		r.shouldRollback = true
+		trafficChanged = !isNewCandidate(svc, candidate)
+		svc.Spec.Traffic = r.rollbackTraffic(svc.Spec.Traffic, stable, candidate)
+		svc = r.updateAnnotations(svc, stable, candidate)
+		delete(svc.Metadata.Annotations, PausedAnnotation)
+		r.setHealthReportAnnotation(svc, "status: rolled back, "+rolledBackManuallyReason)
+		r.addEvent(svc, notification.RolledBackEvent, rolledBackManuallyReason)
+	case RetryAction:
+		if svc.Metadata.Annotations[LastFailedCandidateRevisionAnnotation] == "" {
+			return notApplicable("no failed candidate to retry")
+		}
+		delete(svc.Metadata.Annotations, LastFailedCandidateRevisionAnnotation)
+		delete(svc.Metadata.Annotations, LastFailedCandidateTimeAnnotation)
+	default:
+		return notApplicable("unknown action")
+	}
+
+	// The reason of the last decision no longer applies, the next pass records
+	// a new one.
+	delete(svc.Metadata.Annotations, LastReasonAnnotation)
+
+	r.log.WithField("action", action).Info("applying manual action")
+	err := r.replaceService(svc)
+	return svc, trafficChanged, errors.Wrap(err, "failed to replace service")
+}
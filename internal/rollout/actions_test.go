@@ -0,0 +1,221 @@
+package rollout_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	metricsmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	notificationmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestApply(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	lastUpdate := fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339))
+	strategy := config.Strategy{
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	inProgress := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+		{LatestRevision: true, Tag: rollout.LatestTag},
+		{RevisionName: "test-001", Tag: "v1"},
+	}
+	rolledBack := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+		{LatestRevision: true, Tag: rollout.LatestTag},
+		{RevisionName: "test-001", Tag: "v1"},
+	}
+
+	var tests = []struct {
+		name           string
+		action         rollout.Action
+		traffic        []*run.TrafficTarget
+		lastReady      string
+		annotations    map[string]string
+		outAnnotations map[string]string
+		outTraffic     []*run.TrafficTarget
+		outEvents      []notification.EventType
+		changedTraffic bool
+		notApplicable  bool
+	}{
+		{
+			name:      "pause",
+			action:    rollout.PauseAction,
+			traffic:   inProgress,
+			lastReady: "test-002",
+			outAnnotations: map[string]string{
+				rollout.PausedAnnotation:    "paused manually",
+				rollout.LastEventAnnotation: "paused: paused manually",
+			},
+			outTraffic: inProgress,
+			outEvents:  []notification.EventType{notification.PausedEvent},
+		},
+		{
+			name:        "pause paused rollout",
+			action:      rollout.PauseAction,
+			traffic:     inProgress,
+			lastReady:   "test-002",
+			annotations: map[string]string{rollout.PausedAnnotation: "paused manually"},
+			outAnnotations: map[string]string{
+				rollout.PausedAnnotation: "paused manually",
+			},
+			notApplicable: true,
+		},
+		{
+			name:           "resume",
+			action:         rollout.ResumeAction,
+			traffic:        inProgress,
+			lastReady:      "test-002",
+			annotations:    map[string]string{rollout.PausedAnnotation: "paused manually"},
+			outAnnotations: map[string]string{},
+			outTraffic:     inProgress,
+		},
+		{
+			name:           "resume rollout not paused",
+			action:         rollout.ResumeAction,
+			traffic:        inProgress,
+			lastReady:      "test-002",
+			outAnnotations: map[string]string{},
+			notApplicable:  true,
+		},
+		{
+			name:      "abort",
+			action:    rollout.AbortAction,
+			traffic:   inProgress,
+			lastReady: "test-002",
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.PausedAnnotation:            "aborted manually",
+				rollout.LastHealthReportAnnotation:  "status: paused, aborted manually" + lastUpdate,
+				rollout.LastEventAnnotation:         "paused: aborted manually",
+			},
+			outTraffic:     rolledBack,
+			outEvents:      []notification.EventType{notification.PausedEvent},
+			changedTraffic: true,
+		},
+		{
+			name:      "promote",
+			action:    rollout.PromoteAction,
+			traffic:   inProgress,
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.PausedAnnotation: "paused manually",
+			},
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:   "test-002",
+				rollout.LastRolloutAnnotation:      clockMock.Now().Format(time.RFC3339),
+				rollout.LastHealthReportAnnotation: "status: promoted, promoted manually" + lastUpdate,
+				rollout.LastEventAnnotation:        "promoted: promoted manually",
+			},
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+				{RevisionName: "test-001", Tag: "v1"},
+			},
+			outEvents:      []notification.EventType{notification.PromotedEvent},
+			changedTraffic: true,
+		},
+		{
+			name:           "promote without candidate",
+			action:         rollout.PromoteAction,
+			traffic:        rolledBack[:1],
+			lastReady:      "test-001",
+			outAnnotations: map[string]string{},
+			notApplicable:  true,
+		},
+		{
+			name:      "rollback",
+			action:    rollout.RollbackAction,
+			traffic:   inProgress,
+			lastReady: "test-002",
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:              "test-001",
+				rollout.CandidateRevisionAnnotation:           "test-002",
+				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+				rollout.LastFailedCandidateTimeAnnotation:     clockMock.Now().Format(time.RFC3339),
+				rollout.LastHealthReportAnnotation:            "status: rolled back, rolled back manually" + lastUpdate,
+				rollout.LastEventAnnotation:                   "rolled-back: rolled back manually",
+			},
+			outTraffic:     rolledBack,
+			outEvents:      []notification.EventType{notification.RolledBackEvent},
+			changedTraffic: true,
+		},
+		{
+			name:      "retry",
+			action:    rollout.RetryAction,
+			traffic:   rolledBack,
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+				rollout.LastFailedCandidateTimeAnnotation:     clockMock.Now().Format(time.RFC3339),
+			},
+			outAnnotations: map[string]string{},
+			outTraffic:     rolledBack,
+		},
+		{
+			name:           "retry without failed candidate",
+			action:         rollout.RetryAction,
+			traffic:        inProgress,
+			lastReady:      "test-002",
+			outAnnotations: map[string]string{},
+			notApplicable:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			annotations := map[string]string{}
+			for key, value := range test.annotations {
+				annotations[key] = value
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations:         annotations,
+				LatestReadyRevision: test.lastReady,
+				Traffic:             append([]*run.TrafficTarget{}, test.traffic...),
+			})
+
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+			var events []notification.EventType
+			notifier := &notificationmock.Notifier{}
+			notifier.NotifyFn = func(ctx context.Context, event notification.RolloutEvent) error {
+				events = append(events, event.Event)
+				assert.Equal(tt, string(test.action), event.Action)
+				return nil
+			}
+
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), &metricsmock.Metrics{}, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithNotifier(notifier)
+
+			changed, err := r.Apply(test.action)
+			if test.notApplicable {
+				assert.True(tt, rollout.IsNotApplicable(err))
+				assert.False(tt, runclient.ReplaceServiceInvoked)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.changedTraffic, changed)
+			assert.Equal(tt, test.outAnnotations, svcRecord.Metadata.Annotations)
+			assert.Equal(tt, test.outTraffic, svcRecord.Spec.Traffic)
+			assert.Equal(tt, test.outEvents, events)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package rollout
+
+import (
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// LastEventAnnotation is the annotation with the type and reason of the last
+// rollout event.
+const LastEventAnnotation = "rollout.cloud.run/lastEvent"
+
+// plannedEvent is an event to send once the service is updated.
+type plannedEvent struct {
+	eventType notification.EventType
+	reason    string
+}
+
+// addEvent plans an event to send once the service is updated and records
+// it in the service's annotations.
+//
+// Events that do not change the traffic are only planned if they differ from
+// the last event, so they are not repeated at every rollout pass. Events are
+// not tracked if no notifier was provided.
+func (r *Rollout) addEvent(svc *run.Service, eventType notification.EventType, reason string) {
+	if r.notifier == nil {
+		return
+	}
+
+	value := string(eventType)
+	if reason != "" {
+		value += ": " + reason
+	}
+	setAnnotation(svc, LastEventAnnotation, value)
+
+	switch eventType {
+	case notification.WaitingEvent, notification.InconclusiveEvent, notification.PausedEvent:
+		if r.previousAnnotations[LastEventAnnotation] == value {
+			return
+		}
+	}
+	r.events = append(r.events, plannedEvent{eventType: eventType, reason: reason})
+}
+
+// addDiagnosisEvent plans the event that corresponds to the decision made
+// after diagnosing the candidate.
+func (r *Rollout) addDiagnosisEvent(svc *run.Service, diagnosis health.DiagnosisResult, trafficChanged bool) {
+	switch {
+	case diagnosis == health.Unhealthy:
+		r.addEvent(svc, notification.RolledBackEvent, "unhealthy candidate")
+	case diagnosis == health.Inconclusive:
+		r.addEvent(svc, notification.InconclusiveEvent, "not enough requests to diagnose the candidate")
+	case r.promoteToStable:
+		r.addEvent(svc, notification.PromotedEvent, "")
+	case trafficChanged:
+		r.addEvent(svc, notification.StepAdvancedEvent, "")
+	case r.heldByTrafficLimit:
+		r.addEvent(svc, notification.PausedEvent, r.trafficLimitReason)
+	default:
+		r.addEvent(svc, notification.WaitingEvent, "not enough time since last rollout")
+	}
+}
+
+// sendEvents sends the events planned during the update, even if some of
+// them fail.
+func (r *Rollout) sendEvents(svc *run.Service) error {
+	var errs []string
+	for _, planned := range r.events {
+		if err := r.sendEvent(svc, planned.eventType, planned.reason, nil); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("failed to send %d of %d events: %s", len(errs), len(r.events), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sendErrorEvent sends an event about a failed rollout.
+//
+// The traffic of the event is the one the update attempted to set.
+func (r *Rollout) sendErrorEvent(rolloutErr error) error {
+	return r.sendEvent(r.service, notification.ErrorEvent, "", rolloutErr)
+}
+
+// sendEvent sends a single event about the service.
+func (r *Rollout) sendEvent(svc *run.Service, eventType notification.EventType, reason string, rolloutErr error) error {
+	if r.notifier == nil {
+		return nil
+	}
+
+	event, err := notification.NewRolloutEvent(eventType, svc, r.candidate)
+	if err != nil {
+		return errors.Wrap(err, "failed to create rollout event")
+	}
+	event.Reason = reason
+	event.Action = string(r.action)
+	event.Time = r.time.Now()
+	event.Project = r.project
+	event.Region = r.region
+	event.ServiceName = r.serviceName
+	event.Strategy = r.strategy.DisplayName()
+	event.StableRevisionName = r.stable
+	event.PreviousTraffic = r.previousTraffic
+	event.HealthReport = r.healthReport
+	if r.diagnosis != nil {
+		report := health.NewDiagnosisReport(r.strategy.HealthCriteria, *r.diagnosis)
+		event.Diagnosis = &report
+	}
+	if rolloutErr != nil {
+		event.Error = rolloutErr.Error()
+	}
+
+	ctx := util.ContextWithLogger(r.ctx, r.log.WithField("event", eventType))
+	return errors.Wrapf(r.notifier.Notify(ctx, event), "failed to send %s event", eventType)
+}
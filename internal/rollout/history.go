@@ -0,0 +1,54 @@
+package rollout
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
+	"google.golang.org/api/run/v1"
+)
+
+// recordHistory adds the decision made during the update to the history.
+//
+// svc is the service as updated, or as the update attempted to set it if
+// updateErr is not nil. Nothing is recorded if no decision was made, e.g. if
+// the service has no candidate or its diagnosis failed. A failure to record is
+// logged, since it must not fail the rollout.
+func (r *Rollout) recordHistory(svc *run.Service, updateErr error) {
+	if r.history == nil {
+		return
+	}
+	record := history.Record{
+		Time:              r.time.Now(),
+		Project:           r.project,
+		Region:            r.region,
+		Service:           r.serviceName,
+		Strategy:          r.strategy.DisplayName(),
+		Actor:             history.OperatorActor,
+		Action:            string(r.outcome),
+		StableRevision:    r.stable,
+		CandidateRevision: r.candidate,
+		TrafficBefore:     history.NewTraffic(r.previousTraffic),
+		HealthReport:      r.healthReport,
+	}
+	if r.action != "" {
+		record.Actor = history.ManualActor
+		record.Action = string(r.action)
+	}
+	if record.Action == "" || IsNotApplicable(updateErr) {
+		return
+	}
+	if svc == nil {
+		svc = r.service
+	}
+	record.TrafficAfter = history.NewTraffic(svc.Spec.Traffic)
+	if r.diagnosis != nil {
+		report := health.NewDiagnosisReport(r.strategy.HealthCriteria, *r.diagnosis)
+		record.Diagnosis = &report
+	}
+	if updateErr != nil {
+		record.Error = updateErr.Error()
+	}
+
+	if err := r.history.Record(r.ctx, record); err != nil {
+		r.log.WithError(err).Error("could not record decision in history")
+	}
+}
@@ -0,0 +1,190 @@
+package rollout_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
+	metricsmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+// historyRecorder is a history store that keeps the records in memory.
+type historyRecorder struct {
+	records []history.Record
+}
+
+func (h *historyRecorder) Record(ctx context.Context, record history.Record) error {
+	h.records = append(h.records, record)
+	return nil
+}
+
+func (h *historyRecorder) List(ctx context.Context, filter history.Filter) ([]history.Record, error) {
+	return h.records, nil
+}
+
+func TestRolloutRecordsHistory(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsmock.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 500, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
+	strategy := config.Strategy{
+		Name:                "backend",
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 100},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+		},
+	}
+	stableOnly := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+	}
+	inProgress := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+
+	var tests = []struct {
+		name          string
+		traffic       []*run.TrafficTarget
+		annotations   map[string]string
+		lastReady     string
+		action        rollout.Action
+		replaceErr    error
+		outActor      history.Actor
+		outAction     string
+		outPercent    int64
+		outDiagnosis  string
+		outError      bool
+		notRecorded   bool
+		notApplicable bool
+	}{
+		{
+			name:       "new candidate",
+			traffic:    stableOnly,
+			lastReady:  "test-002",
+			outActor:   history.OperatorActor,
+			outAction:  "initial",
+			outPercent: 10,
+		},
+		{
+			name:    "step advanced",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			lastReady:    "test-002",
+			outActor:     history.OperatorActor,
+			outAction:    "advanced",
+			outPercent:   40,
+			outDiagnosis: "healthy",
+		},
+		{
+			name:       "failed update",
+			traffic:    stableOnly,
+			lastReady:  "test-002",
+			replaceErr: fmt.Errorf("permission denied"),
+			outActor:   history.OperatorActor,
+			outAction:  "initial",
+			outPercent: 10,
+			outError:   true,
+		},
+		{
+			name:        "no candidate",
+			traffic:     stableOnly,
+			lastReady:   "test-001",
+			notRecorded: true,
+		},
+		{
+			name:      "manual rollback",
+			traffic:   inProgress,
+			lastReady: "test-002",
+			action:    rollout.RollbackAction,
+			outActor:  history.ManualActor,
+			outAction: "rollback",
+		},
+		{
+			name:          "manual action not applicable",
+			traffic:       inProgress,
+			lastReady:     "test-002",
+			action:        rollout.RetryAction,
+			notRecorded:   true,
+			notApplicable: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{
+				Annotations:         test.annotations,
+				LatestReadyRevision: test.lastReady,
+				Traffic:             append([]*run.TrafficTarget{}, test.traffic...),
+			})
+			svc.Metadata.Name = "mysvc"
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, test.replaceErr
+			}
+
+			store := &historyRecorder{}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithHistory(store)
+
+			var err error
+			if test.action != "" {
+				_, err = r.Apply(test.action)
+			} else {
+				_, err = r.Rollout()
+			}
+			assert.Equal(tt, test.outError || test.notApplicable, err != nil)
+			if test.notRecorded {
+				assert.Len(tt, store.records, 0)
+				return
+			}
+
+			assert.Len(tt, store.records, 1)
+			record := store.records[0]
+			assert.Equal(tt, clockMock.Now(), record.Time)
+			assert.Equal(tt, "myproject", record.Project)
+			assert.Equal(tt, "us-east1", record.Region)
+			assert.Equal(tt, "mysvc", record.Service)
+			assert.Equal(tt, "backend", record.Strategy)
+			assert.Equal(tt, test.outActor, record.Actor)
+			assert.Equal(tt, test.outAction, record.Action)
+			assert.Equal(tt, "test-001", record.StableRevision)
+			assert.Equal(tt, "test-002", record.CandidateRevision)
+			assert.Equal(tt, history.NewTraffic(test.traffic), record.TrafficBefore)
+			var percent int64
+			for _, target := range record.TrafficAfter {
+				if target.RevisionName == "test-002" {
+					percent += target.Percent
+				}
+			}
+			assert.Equal(tt, test.outPercent, percent)
+			assert.Equal(tt, test.outError, record.Error != "")
+			if test.outDiagnosis == "" {
+				assert.Nil(tt, record.Diagnosis)
+				return
+			}
+			assert.Equal(tt, test.outDiagnosis, record.Diagnosis.Result)
+			assert.Len(tt, record.Diagnosis.Checks, 2)
+		})
+	}
+}
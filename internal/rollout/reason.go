@@ -0,0 +1,160 @@
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// LastReasonAnnotation is the annotation with the reason of the last decision
+// made on the service, in JSON.
+const LastReasonAnnotation = "rollout.cloud.run/lastReason"
+
+// ReasonCode identifies why a decision was made on a service.
+type ReasonCode string
+
+// Possible reason codes.
+const (
+	// NoStableRevisionReason means no revision serves all the traffic.
+	NoStableRevisionReason ReasonCode = "no-stable-revision"
+	// NoCandidateReason means the latest ready revision is the stable one.
+	NoCandidateReason ReasonCode = "no-candidate"
+	// FailedCandidateReason means the latest ready revision was rolled back.
+	FailedCandidateReason ReasonCode = "failed-candidate"
+	// ForcedRollbackReason means the candidate was rolled back regardless of
+	// its health, e.g. because another service in its release group failed.
+	ForcedRollbackReason ReasonCode = "forced-rollback"
+	// PausedReason means the rollout is paused.
+	PausedReason ReasonCode = "paused"
+	// QueuedReason means too many rollouts are in progress.
+	QueuedReason ReasonCode = "queued"
+	// TrafficLimitReason means the traffic limit of the candidate was reached.
+	TrafficLimitReason ReasonCode = "traffic-limit"
+	// NewCandidateReason means a new candidate got its first share of traffic.
+	NewCandidateReason ReasonCode = "new-candidate"
+	// UnhealthyReason means the candidate did not meet the health criteria.
+	UnhealthyReason ReasonCode = "unhealthy"
+	// InconclusiveReason means the candidate did not get enough requests.
+	InconclusiveReason ReasonCode = "inconclusive"
+	// NotEnoughTimeReason means the candidate is healthy, but not enough time
+	// has elapsed since the last rollout.
+	NotEnoughTimeReason ReasonCode = "not-enough-time"
+	// AdvancedReason means the healthy candidate got more traffic.
+	AdvancedReason ReasonCode = "advanced"
+	// PromotedReason means the healthy candidate became the stable revision.
+	PromotedReason ReasonCode = "promoted"
+)
+
+// Reason explains a decision made on a service, with a hint to change it if
+// the decision is not the expected one.
+type Reason struct {
+	Code    ReasonCode `json:"code"`
+	Message string     `json:"message"`
+	Hint    string     `json:"hint,omitempty"`
+}
+
+// String returns the message of the reason, followed by its hint.
+func (r Reason) String() string {
+	if r.Hint == "" {
+		return r.Message
+	}
+	return r.Message + " (hint: " + r.Hint + ")"
+}
+
+// noCandidateReason returns the reason why the service has no candidate to
+// roll out, given its stable revision.
+func noCandidateReason(svc *run.Service, stable string) Reason {
+	if stable == "" {
+		return Reason{
+			Code:    NoStableRevisionReason,
+			Message: "no revision serves 100% of the traffic",
+			Hint:    fmt.Sprintf("route all the traffic to one revision, e.g. with gcloud run services update-traffic %s --to-revisions=REVISION=100", svc.Metadata.Name),
+		}
+	}
+	latest := svc.Status.LatestReadyRevisionName
+	if latest != "" && latest != stable && isFailedCandidate(svc, latest) {
+		return Reason{
+			Code:    FailedCandidateReason,
+			Message: fmt.Sprintf("candidate %s previously failed", latest),
+			Hint:    fmt.Sprintf("deploy a new revision, or run the retry action (which clears the %s annotation) to roll out %s again", LastFailedCandidateRevisionAnnotation, latest),
+		}
+	}
+	return Reason{
+		Code:    NoCandidateReason,
+		Message: fmt.Sprintf("the latest ready revision %s is the stable revision", stable),
+		Hint:    "deploy new revisions with --no-traffic so they are rolled out gradually",
+	}
+}
+
+// diagnosisReason returns the reason of the decision made after diagnosing the
+// candidate.
+func (r *Rollout) diagnosisReason(diagnosis health.Diagnosis, candidate string, trafficChanged bool, lastRollout string) Reason {
+	switch {
+	case diagnosis.OverallResult == health.Unhealthy:
+		return Reason{
+			Code:    UnhealthyReason,
+			Message: fmt.Sprintf("candidate %s did not meet the health criteria", candidate),
+			Hint:    fmt.Sprintf("deploy a fixed revision, or run the retry action to roll out %s again", candidate),
+		}
+	case diagnosis.OverallResult == health.Inconclusive:
+		return inconclusiveReason(r.strategy.HealthCriteria, diagnosis)
+	case r.heldByTrafficLimit:
+		return Reason{
+			Code:    TrafficLimitReason,
+			Message: fmt.Sprintf("candidate reached its traffic limit of %d%%, %s", r.trafficLimit, r.trafficLimitReason),
+			Hint:    "the candidate rolls forward once the services it depends on or the previous regions are done",
+		}
+	case r.promoteToStable:
+		return Reason{Code: PromotedReason, Message: fmt.Sprintf("candidate %s is healthy and became the stable revision", candidate)}
+	case trafficChanged:
+		return Reason{Code: AdvancedReason, Message: fmt.Sprintf("candidate %s is healthy and got more traffic", candidate)}
+	default:
+		reason := Reason{Code: NotEnoughTimeReason, Message: "candidate is healthy, but not enough time has elapsed since the last rollout"}
+		if t, err := time.Parse(time.RFC3339, lastRollout); err == nil {
+			reason.Message += fmt.Sprintf(", next step at %s", t.Add(r.strategy.TimeBetweenRollouts).Format(time.RFC3339))
+		}
+		return reason
+	}
+}
+
+// inconclusiveReason returns the reason of an inconclusive diagnosis, with the
+// number of requests the candidate got if a request count criterion exists.
+func inconclusiveReason(healthCriteria []config.HealthCriterion, diagnosis health.Diagnosis) Reason {
+	reason := Reason{
+		Code:    InconclusiveReason,
+		Message: "candidate did not get enough requests to be diagnosed",
+		Hint:    "wait for more traffic, or lower the threshold of the request count criterion",
+	}
+	for i, result := range diagnosis.CheckResults {
+		if i < len(healthCriteria) && healthCriteria[i].Metric == config.RequestCountMetricsCheck {
+			reason.Message = fmt.Sprintf("candidate got %.0f requests, needs %.0f to be diagnosed", result.ActualValue, result.Threshold)
+		}
+	}
+	return reason
+}
+
+// setDecision records the reason of the decision in the service, and sets the
+// health report annotation to the report followed by the hint of the reason.
+func (r *Rollout) setDecision(svc *run.Service, report string, reason Reason) error {
+	r.reason = reason
+	data, err := json.Marshal(reason)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal reason")
+	}
+	setAnnotation(svc, LastReasonAnnotation, string(data))
+	r.setHealthReportAnnotation(svc, withHint(report, reason))
+	return nil
+}
+
+// withHint appends the hint of the reason, if any, to the health report.
+func withHint(report string, reason Reason) string {
+	if reason.Hint == "" {
+		return report
+	}
+	return report + "\nhint: " + reason.Hint
+}
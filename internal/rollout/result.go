@@ -0,0 +1,95 @@
+package rollout
+
+import (
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"google.golang.org/api/run/v1"
+)
+
+// Outcome is the action taken on a service during a rollout pass.
+type Outcome string
+
+// Possible outcomes.
+const (
+	// NoOutcome means there was no candidate to roll out.
+	NoOutcome Outcome = "none"
+	// InitialOutcome means a new candidate got its first share of traffic.
+	InitialOutcome Outcome = "initial"
+	// AdvancedOutcome means the candidate got more traffic.
+	AdvancedOutcome Outcome = "advanced"
+	// PromotedOutcome means the candidate became the stable revision.
+	PromotedOutcome Outcome = "promoted"
+	// RolledBackOutcome means the traffic was sent back to the stable revision.
+	RolledBackOutcome Outcome = "rolled back"
+	// WaitingOutcome means the candidate kept its traffic, because of the time
+	// between rollouts or because the rollout is queued, paused or limited.
+	WaitingOutcome Outcome = "waiting"
+	// InconclusiveOutcome means the candidate did not get enough requests to
+	// be diagnosed.
+	InconclusiveOutcome Outcome = "inconclusive"
+)
+
+// Result is the result of the rollout of a service.
+type Result struct {
+	Outcome             Outcome                 `json:"action"`
+	StableRevision      string                  `json:"stableRevision,omitempty"`
+	CandidateRevision   string                  `json:"candidateRevision,omitempty"`
+	OldCandidatePercent int64                   `json:"oldCandidatePercent"`
+	NewCandidatePercent int64                   `json:"newCandidatePercent"`
+	Diagnosis           *health.DiagnosisReport `json:"diagnosis,omitempty"`
+	Reason              *Reason                 `json:"reason,omitempty"`
+}
+
+// Result returns the result of the last update of the service.
+func (r *Rollout) Result() Result {
+	outcome := r.outcome
+	if outcome == "" {
+		outcome = NoOutcome
+	}
+	result := Result{
+		Outcome:             outcome,
+		StableRevision:      r.stable,
+		CandidateRevision:   r.candidate,
+		OldCandidatePercent: revisionPercent(r.previousTraffic, r.candidate),
+		NewCandidatePercent: revisionPercent(r.service.Spec.Traffic, r.candidate),
+	}
+	if r.diagnosis != nil {
+		report := health.NewDiagnosisReport(r.strategy.HealthCriteria, *r.diagnosis)
+		result.Diagnosis = &report
+	}
+	if r.reason.Code != "" {
+		reason := r.reason
+		result.Reason = &reason
+	}
+	return result
+}
+
+// diagnosisOutcome returns the outcome of the decision made after diagnosing
+// the candidate.
+func (r *Rollout) diagnosisOutcome(diagnosis health.DiagnosisResult, trafficChanged bool) Outcome {
+	switch {
+	case diagnosis == health.Unhealthy:
+		return RolledBackOutcome
+	case diagnosis == health.Inconclusive:
+		return InconclusiveOutcome
+	case r.promoteToStable:
+		return PromotedOutcome
+	case trafficChanged:
+		return AdvancedOutcome
+	default:
+		return WaitingOutcome
+	}
+}
+
+// revisionPercent returns the share of traffic of the revision.
+func revisionPercent(traffic []*run.TrafficTarget, revision string) int64 {
+	if revision == "" {
+		return 0
+	}
+	var percent int64
+	for _, target := range traffic {
+		if target.RevisionName == revision {
+			percent += target.Percent
+		}
+	}
+	return percent
+}
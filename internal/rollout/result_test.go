@@ -0,0 +1,191 @@
+package rollout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	metricsmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestResult(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsmock.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 500, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
+	strategy := config.Strategy{
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	stableOnly := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+	}
+	inProgress := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+
+	var tests = []struct {
+		name         string
+		traffic      []*run.TrafficTarget
+		lastReady    string
+		annotations  map[string]string
+		queued       bool
+		minRequests  float64
+		maxErrorRate float64
+		outOutcome   rollout.Outcome
+		outOld       int64
+		outNew       int64
+		outDiagnosis health.DiagnosisResult
+		outReason    rollout.ReasonCode
+		outMessage   string
+	}{
+		{
+			name:         "no candidate",
+			traffic:      stableOnly,
+			lastReady:    "test-001",
+			maxErrorRate: 5,
+			outOutcome:   rollout.NoOutcome,
+			outReason:    rollout.NoCandidateReason,
+		},
+		{
+			name:         "new candidate",
+			traffic:      stableOnly,
+			maxErrorRate: 5,
+			outOutcome:   rollout.InitialOutcome,
+			outNew:       10,
+			outReason:    rollout.NewCandidateReason,
+		},
+		{
+			name:         "new candidate queued",
+			traffic:      stableOnly,
+			queued:       true,
+			maxErrorRate: 5,
+			outOutcome:   rollout.WaitingOutcome,
+			outReason:    rollout.QueuedReason,
+		},
+		{
+			name:    "step advanced",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			maxErrorRate: 5,
+			outOutcome:   rollout.AdvancedOutcome,
+			outOld:       10,
+			outNew:       40,
+			outDiagnosis: health.Healthy,
+			outReason:    rollout.AdvancedReason,
+		},
+		{
+			name: "candidate promoted",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: rollout.CandidateTag},
+				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
+			},
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			maxErrorRate: 5,
+			outOutcome:   rollout.PromotedOutcome,
+			outOld:       100,
+			outNew:       100,
+			outDiagnosis: health.Healthy,
+			outReason:    rollout.PromotedReason,
+		},
+		{
+			name:         "candidate rolled back",
+			traffic:      inProgress,
+			maxErrorRate: 0.001,
+			outOutcome:   rollout.RolledBackOutcome,
+			outOld:       10,
+			outDiagnosis: health.Unhealthy,
+			outReason:    rollout.UnhealthyReason,
+		},
+		{
+			name:    "waiting for time between rollouts",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, 0),
+			},
+			maxErrorRate: 5,
+			outOutcome:   rollout.WaitingOutcome,
+			outOld:       10,
+			outNew:       10,
+			outDiagnosis: health.Healthy,
+			outReason:    rollout.NotEnoughTimeReason,
+			outMessage:   "candidate is healthy, but not enough time has elapsed since the last rollout, next step at " + clockMock.Now().Add(10*time.Minute).Format(time.RFC3339),
+		},
+		{
+			name:         "not enough requests",
+			traffic:      inProgress,
+			minRequests:  1000,
+			maxErrorRate: 5,
+			outOutcome:   rollout.InconclusiveOutcome,
+			outOld:       10,
+			outNew:       10,
+			outDiagnosis: health.Inconclusive,
+			outReason:    rollout.InconclusiveReason,
+			outMessage:   "candidate got 500 requests, needs 1000 to be diagnosed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			lastReady := test.lastReady
+			if lastReady == "" {
+				lastReady = "test-002"
+			}
+			svc := generateService(&ServiceOpts{
+				Annotations:         test.annotations,
+				LatestReadyRevision: lastReady,
+				Traffic:             test.traffic,
+			})
+			svc.Metadata.Name = "mysvc"
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, nil
+			}
+
+			strategy.HealthCriteria = []config.HealthCriterion{
+				{Metric: config.RequestCountMetricsCheck, Threshold: test.minRequests},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: test.maxErrorRate},
+			}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithQueued(test.queued)
+
+			_, err := r.Rollout()
+			assert.Nil(tt, err)
+
+			result := r.Result()
+			assert.Equal(tt, test.outOutcome, result.Outcome)
+			assert.Equal(tt, test.outOld, result.OldCandidatePercent)
+			assert.Equal(tt, test.outNew, result.NewCandidatePercent)
+			assert.Equal(tt, test.outReason, result.Reason.Code)
+			if test.outMessage != "" {
+				assert.Equal(tt, test.outMessage, result.Reason.Message)
+			}
+			if test.outDiagnosis == health.Unknown {
+				assert.Nil(tt, result.Diagnosis)
+				return
+			}
+			assert.Equal(tt, test.outDiagnosis.String(), result.Diagnosis.Result)
+		})
+	}
+}
@@ -42,12 +42,18 @@ func DetectCandidateRevisionName(svc *run.Service, stable string) string {
 
 	// If the latestRevision has previously been treated as a candidate and
 	// failed to meet health checks, no candidate exists.
-	if latestRevision == svc.Metadata.Annotations[LastFailedCandidateRevisionAnnotation] {
+	if isFailedCandidate(svc, latestRevision) {
 		return ""
 	}
 	return latestRevision
 }
 
+// isFailedCandidate determines if the revision previously failed to meet the
+// health criteria as a candidate.
+func isFailedCandidate(svc *run.Service, revision string) bool {
+	return revision == svc.Metadata.Annotations[LastFailedCandidateRevisionAnnotation]
+}
+
 // find100PercentServingRevisionName scans the service and retrieves a revision
 // with 100% traffic.
 func find100PercentServingRevisionName(svc *run.Service) string {
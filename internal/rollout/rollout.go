@@ -2,18 +2,24 @@ package rollout
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/history"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
 	runapi "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
 	"github.com/jonboulle/clockwork"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/run/v1"
 )
 
@@ -22,10 +28,17 @@ const (
 	StableRevisionAnnotation              = "rollout.cloud.run/stableRevision"
 	CandidateRevisionAnnotation           = "rollout.cloud.run/candidateRevision"
 	LastFailedCandidateRevisionAnnotation = "rollout.cloud.run/lastFailedCandidateRevision"
+	LastFailedCandidateTimeAnnotation     = "rollout.cloud.run/lastFailedCandidateTime"
 	LastRolloutAnnotation                 = "rollout.cloud.run/lastRollout"
 	LastHealthReportAnnotation            = "rollout.cloud.run/lastHealthReport"
+	LastFailedUpdateAnnotation            = "rollout.cloud.run/lastFailedUpdate"
+	LastDiagnosisAnnotation               = "rollout.cloud.run/lastDiagnosis"
 )
 
+// ReleaseGroupLabel is the label to group services whose candidates must be
+// rolled back together.
+const ReleaseGroupLabel = "rollout-release-group"
+
 // ServiceRecord holds a service object and information about it.
 type ServiceRecord struct {
 	*run.Service
@@ -54,6 +67,50 @@ type Rollout struct {
 
 	// Used to update annotations when rollback should occur.
 	shouldRollback bool
+
+	// Used to keep a new candidate from receiving traffic.
+	queued bool
+
+	// Used to cap the traffic the candidate can get, and the reason why.
+	trafficLimit       int64
+	trafficLimitReason string
+
+	// Used to update the health report when the traffic limit prevented a
+	// roll forward.
+	heldByTrafficLimit bool
+
+	// Used to roll back the candidate regardless of its health.
+	forcedRollbackReason string
+
+	// Used to retry the update when the service was concurrently modified.
+	conflictRetries int
+	conflictBackoff time.Duration
+
+	// Used to verify that an update took effect. Zero timeout disables the
+	// verification.
+	verifyTimeout  time.Duration
+	verifyInterval time.Duration
+
+	// Used to restore the rollout state if an update did not take effect.
+	previousAnnotations map[string]string
+
+	// Used to send events about the decisions made during the update.
+	notifier        notification.Notifier
+	events          []plannedEvent
+	stable          string
+	candidate       string
+	previousTraffic []*run.TrafficTarget
+	diagnosis       *health.Diagnosis
+	healthReport    string
+
+	// Used to report the action taken on the service and why.
+	outcome Outcome
+	reason  Reason
+
+	// Used to record the decisions made on the service, and the manual action
+	// being applied, if any.
+	history history.Store
+	action  Action
 }
 
 // Automatic tags.
@@ -78,6 +135,9 @@ func New(ctx context.Context, metricsProvider metrics.Provider, svcRecord *Servi
 		strategy:        strategy,
 		log:             logrus.NewEntry(logrus.New()),
 		time:            clockwork.NewRealClock(),
+		trafficLimit:    100,
+		conflictRetries: 3,
+		conflictBackoff: time.Second,
 	}
 }
 
@@ -99,21 +159,140 @@ func (r *Rollout) WithClock(clock clockwork.Clock) *Rollout {
 	return r
 }
 
+// WithQueued marks the rollout as queued. A queued rollout does not assign
+// traffic to a new candidate.
+func (r *Rollout) WithQueued(queued bool) *Rollout {
+	r.queued = queued
+	return r
+}
+
+// WithTrafficLimit caps the percentage of traffic the candidate can get. The
+// reason is included in the health report when the limit prevents the
+// candidate from rolling forward.
+func (r *Rollout) WithTrafficLimit(percent int64, reason string) *Rollout {
+	r.trafficLimit = percent
+	r.trafficLimitReason = reason
+	return r
+}
+
+// WithForcedRollback makes the rollout roll back the candidate without
+// diagnosing it. The reason is included in the health report.
+func (r *Rollout) WithForcedRollback(reason string) *Rollout {
+	r.forcedRollbackReason = reason
+	return r
+}
+
+// WithConflictRetries updates the number of times the update is retried if the
+// service was concurrently modified, and the initial time to wait between
+// attempts, which doubles after each attempt.
+func (r *Rollout) WithConflictRetries(retries int, backoff time.Duration) *Rollout {
+	r.conflictRetries = retries
+	r.conflictBackoff = backoff
+	return r
+}
+
+// WithUpdateVerification makes the rollout poll the service after each update,
+// at the given interval, until the new traffic configuration is served or the
+// timeout passes.
+func (r *Rollout) WithUpdateVerification(timeout, interval time.Duration) *Rollout {
+	r.verifyTimeout = timeout
+	r.verifyInterval = interval
+	return r
+}
+
+// WithNotifier updates the notifier used to send events about the rollout of
+// the service.
+func (r *Rollout) WithNotifier(notifier notification.Notifier) *Rollout {
+	r.notifier = notifier
+	return r
+}
+
+// WithHistory updates the store the decisions made on the service are
+// recorded to.
+func (r *Rollout) WithHistory(store history.Store) *Rollout {
+	r.history = store
+	return r
+}
+
 // Rollout handles the gradual rollout.
+//
+// If the service was modified since it was retrieved (e.g. a new deployment),
+// the latest version of the service is retrieved and the rollout is retried.
 func (r *Rollout) Rollout() (bool, error) {
+	trafficChanged, err := r.update(func(svc *run.Service) (*run.Service, bool, error) {
+		svc, _, trafficChanged, err := r.UpdateService(svc)
+		return svc, trafficChanged, err
+	})
+	return trafficChanged, errors.Wrap(err, "failed to perform rollout")
+}
+
+// update applies the update function to the service and sends the planned
+// events, retrying with the latest version of the service on conflicts.
+//
+// Errors sending the events are logged rather than returned, since the
+// service was updated regardless.
+func (r *Rollout) update(updateFn func(*run.Service) (*run.Service, bool, error)) (bool, error) {
 	r.log = r.log.WithFields(logrus.Fields{
 		"project": r.project,
 		"service": r.serviceName,
 		"region":  r.region,
 	})
 
-	_, trafficChanged, err := r.UpdateService(r.service)
-	if err != nil {
-		return false, errors.Wrapf(err, "failed to perform rollout")
+	backoff := r.conflictBackoff
+	for attempt := 1; ; attempt++ {
+		svc, trafficChanged, err := updateFn(r.service)
+		if err == nil {
+			r.recordHistory(svc, nil)
+			if notifyErr := r.sendEvents(svc); notifyErr != nil {
+				r.log.WithError(notifyErr).Error("could not send rollout events")
+			}
+			return trafficChanged, nil
+		}
+		if IsNotApplicable(err) {
+			return false, err
+		}
+		if runapi.IsConflict(err) {
+			selfmetrics.Conflicts.Inc()
+		}
+		if !runapi.IsConflict(err) || attempt > r.conflictRetries {
+			r.recordHistory(svc, err)
+			if notifyErr := r.sendErrorEvent(err); notifyErr != nil {
+				r.log.WithError(notifyErr).Error("could not send error event")
+			}
+			return false, err
+		}
+
+		r.log.WithFields(logrus.Fields{
+			"attempt":         attempt,
+			"resourceVersion": r.service.Metadata.ResourceVersion,
+			"backoff":         backoff,
+		}).Warn("conflict while updating service, it was modified since it was retrieved; retrying with latest version")
+		r.time.Sleep(backoff)
+		backoff *= 2
+
+		latest, err := r.runClient.Service(r.project, r.serviceName)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to retrieve latest version of service %q after conflict", r.serviceName)
+		}
+
+		// Update the service in place, so the caller's service record reflects
+		// the latest version.
+		*r.service = *latest
+		r.resetPlan()
 	}
+}
 
-	// Service is non-nil only when the replacement of the service succeded.
-	return trafficChanged, nil
+// resetPlan clears the decisions made during a previous update attempt.
+func (r *Rollout) resetPlan() {
+	r.events = nil
+	r.diagnosis = nil
+	r.healthReport = ""
+	r.promoteToStable = false
+	r.shouldRollout = false
+	r.shouldRollback = false
+	r.heldByTrafficLimit = false
+	r.outcome = ""
+	r.reason = Reason{}
 }
 
 // UpdateService changes the traffic configuration for the revisions and update
@@ -122,67 +301,210 @@ func (r *Rollout) Rollout() (bool, error) {
 // If successful, it always returns an updated service object (with changes in
 // the traffic and/or annotations) or an unchanged service object if no stable
 // or candidate revision was found.
-// If the traffic configuration changed, the second return value is set to true.
-func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, bool, error) {
+// The second return value is the reason of the decision made on the service,
+// including why it was left unchanged. If the traffic configuration changed,
+// the third return value is set to true.
+func (r *Rollout) UpdateService(svc *run.Service) (*run.Service, Reason, bool, error) {
+	r.recordPreviousState(svc)
+
 	stable := DetectStableRevisionName(svc)
 	if stable == "" {
+		r.reason = noCandidateReason(svc, stable)
 		r.log.Info("cannot find a stable revision (that gets 100% of the traffic)")
-		return svc, false, nil
+		return svc, r.reason, false, nil
 	}
 
 	candidate := DetectCandidateRevisionName(svc, stable)
 	if candidate == "" {
-		r.log.Debug("currently no candidate revision exists to rollout")
-		return svc, false, nil
+		r.reason = noCandidateReason(svc, stable)
+		r.log.WithField("reason", r.reason.Code).Debug("currently no candidate revision exists to rollout")
+		return svc, r.reason, false, nil
 	}
 	r.log = r.log.WithFields(logrus.Fields{"stable": stable, "candidate": candidate})
+	r.stable, r.candidate = stable, candidate
+
+	if r.forcedRollbackReason != "" {
+		r.log.Infof("rolling back candidate, %s", r.forcedRollbackReason)
+		r.shouldRollback = true
+		r.outcome = RolledBackOutcome
+		trafficChanged := !isNewCandidate(svc, candidate)
+		svc.Spec.Traffic = r.rollbackTraffic(svc.Spec.Traffic, stable, candidate)
+		svc = r.updateAnnotations(svc, stable, candidate)
+		reason := Reason{
+			Code:    ForcedRollbackReason,
+			Message: r.forcedRollbackReason,
+			Hint:    fmt.Sprintf("run the retry action to roll out %s again", candidate),
+		}
+		if err := r.setDecision(svc, "status: rolled back, "+r.forcedRollbackReason, reason); err != nil {
+			return svc, reason, false, err
+		}
+		r.addEvent(svc, notification.RolledBackEvent, r.forcedRollbackReason)
+
+		err := r.replaceService(svc)
+		return svc, reason, trafficChanged, errors.Wrap(err, "failed to replace service")
+	}
+
+	// A paused rollout keeps the current traffic until it is resumed.
+	if paused := svc.Metadata.Annotations[PausedAnnotation]; paused != "" {
+		r.log.Infof("rollout is paused, %s", paused)
+		r.outcome = WaitingOutcome
+		svc = r.updateAnnotations(svc, stable, candidate)
+		reason := Reason{
+			Code:    PausedReason,
+			Message: "rollout is paused, " + paused,
+			Hint:    "run the resume action to resume the rollout",
+		}
+		if err := r.setDecision(svc, "status: paused, "+paused, reason); err != nil {
+			return svc, reason, false, err
+		}
+		r.addEvent(svc, notification.PausedEvent, paused)
+
+		err := r.replaceService(svc)
+		return svc, reason, false, errors.Wrap(err, "failed to replace service")
+	}
 
 	// A new candidate does not have metrics yet, so it can't be diagnosed.
 	if isNewCandidate(svc, candidate) {
+		if r.previousAnnotations[CandidateRevisionAnnotation] != candidate {
+			r.addEvent(svc, notification.CandidateDetectedEvent, "")
+		}
+		// The last diagnosis is about a previous candidate.
+		delete(svc.Metadata.Annotations, LastDiagnosisAnnotation)
+		if r.queued || r.trafficLimit == 0 {
+			status, message := "queued", "too many rollouts in progress"
+			reason := Reason{
+				Code:    QueuedReason,
+				Message: message,
+				Hint:    "the candidate gets traffic once other rollouts are done, or raise maxConcurrentRollouts",
+			}
+			if !r.queued {
+				status, message = "waiting", r.trafficLimitReason
+				reason = Reason{
+					Code:    TrafficLimitReason,
+					Message: message,
+					Hint:    "the candidate gets traffic once the services it depends on or the previous regions are done",
+				}
+			}
+			r.log.Infof("new candidate %s, %s", status, message)
+			r.outcome = WaitingOutcome
+			svc = r.updateAnnotations(svc, stable, candidate)
+			if err := r.setDecision(svc, "status: "+status+", "+message, reason); err != nil {
+				return svc, reason, false, err
+			}
+			r.addEvent(svc, notification.PausedEvent, message)
+
+			err := r.replaceService(svc)
+			return svc, reason, false, errors.Wrap(err, "failed to replace service")
+		}
+
 		r.log.Debug("new candidate, assign some traffic")
 		r.shouldRollout = true
+		r.outcome = InitialOutcome
 		svc.Spec.Traffic = r.rollForwardTraffic(svc.Spec.Traffic, stable, candidate)
 		svc = r.updateAnnotations(svc, stable, candidate)
-		r.setHealthReportAnnotation(svc, "new candidate, no health report available yet")
+		reason := Reason{
+			Code:    NewCandidateReason,
+			Message: fmt.Sprintf("new candidate %s got %d%% of the traffic", candidate, revisionPercent(svc.Spec.Traffic, candidate)),
+		}
+		if err := r.setDecision(svc, "new candidate, no health report available yet", reason); err != nil {
+			return svc, reason, false, err
+		}
+		r.addEvent(svc, notification.InitialTrafficEvent, "")
 
 		err := r.replaceService(svc)
-		return svc, true, errors.Wrap(err, "failed to replace service")
+		return svc, reason, true, errors.Wrap(err, "failed to replace service")
 	}
 
 	diagnosis, err := r.diagnoseCandidate(candidate, r.strategy.HealthCriteria)
 	if err != nil {
 		r.log.Error("could not diagnose candidate's health")
-		return svc, false, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
+		return svc, Reason{}, false, errors.Wrapf(err, "failed to diagnose health for candidate %q", candidate)
 	}
 
+	r.diagnosis = &diagnosis
+	lastRollout := svc.Metadata.Annotations[LastRolloutAnnotation]
 	traffic, trafficChanged, err := r.determineTraffic(svc, diagnosis.OverallResult, stable, candidate)
 	if err != nil {
-		return svc, false, errors.Wrap(err, "failed to configure traffic after diagnosis")
+		return svc, Reason{}, false, errors.Wrap(err, "failed to configure traffic after diagnosis")
 	}
 
 	svc.Spec.Traffic = traffic
 	svc = r.updateAnnotations(svc, stable, candidate)
 
 	// If candidate is healthy, traffic only changes when enough time has
-	// elapsed. Thus, we can pass it as an argument representing if enough time
-	// has elapsed since last rollout.
-	report := health.StringReport(r.strategy.HealthCriteria, diagnosis, trafficChanged)
-	r.setHealthReportAnnotation(svc, report)
+	// elapsed and the traffic limit was not reached. Thus, we can pass it as an
+	// argument representing if enough time has elapsed since last rollout.
+	enoughTime := trafficChanged || r.heldByTrafficLimit
+	report := health.StringReport(r.strategy.HealthCriteria, diagnosis, enoughTime)
+	if r.heldByTrafficLimit {
+		report += fmt.Sprintf("\ntrafficLimit: %d%%, %s", r.trafficLimit, r.trafficLimitReason)
+	}
+	reason := r.diagnosisReason(diagnosis, candidate, trafficChanged, lastRollout)
+	if err := r.setDecision(svc, report, reason); err != nil {
+		return svc, reason, false, err
+	}
+	if err := r.setDiagnosisAnnotation(svc, diagnosis); err != nil {
+		return svc, reason, false, errors.Wrap(err, "failed to record diagnosis")
+	}
+	r.addDiagnosisEvent(svc, diagnosis.OverallResult, trafficChanged)
+	r.outcome = r.diagnosisOutcome(diagnosis.OverallResult, trafficChanged)
 
 	err = r.replaceService(svc)
-	return svc, trafficChanged, errors.Wrap(err, "failed to replace service")
+	return svc, reason, trafficChanged, errors.Wrap(err, "failed to replace service")
+}
+
+// recordPreviousState keeps the annotations and traffic of the service before
+// it is updated.
+func (r *Rollout) recordPreviousState(svc *run.Service) {
+	r.previousAnnotations = make(map[string]string)
+	for key, value := range svc.Metadata.Annotations {
+		r.previousAnnotations[key] = value
+	}
+	r.previousTraffic = svc.Spec.Traffic
 }
 
 // replaceService updates the service object in Cloud Run.
-func (r *Rollout) replaceService(svc *run.Service) error {
-	_, err := r.runClient.ReplaceService(r.project, r.serviceName, svc)
-	return errors.Wrapf(err, "could not update service %q", r.serviceName)
+//
+// The service object carries the resource version it was retrieved with, so
+// the update is rejected with a conflict if the service was modified since.
+//
+// If update verification is enabled and the update changed the traffic, it
+// waits for the update to take effect. If the update does not take effect, the
+// failure is recorded in the service and an error is returned.
+func (r *Rollout) replaceService(svc *run.Service) (err error) {
+	_, span := tracing.Start(r.ctx, "replaceService",
+		attribute.String("service", r.serviceName),
+		attribute.String("region", r.region),
+		attribute.String("resourceVersion", svc.Metadata.ResourceVersion))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	r.log.WithField("resourceVersion", svc.Metadata.ResourceVersion).Debug("replacing service")
+	updated, err := r.runClient.ReplaceService(r.project, r.serviceName, svc)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("conflict", runapi.IsConflict(err)))
+		return errors.Wrapf(err, "could not update service %q", r.serviceName)
+	}
+	if r.verifyTimeout <= 0 || trafficMatches(svc.Spec.Traffic, r.previousTraffic) {
+		return nil
+	}
+
+	verifyErr := r.verifyUpdate(updated.Metadata.Generation)
+	if verifyErr == nil {
+		return nil
+	}
+	if err := r.recordFailedUpdate(r.previousAnnotations, verifyErr); err != nil {
+		r.log.WithError(err).Error("could not record failed update")
+	}
+	return errors.Wrapf(verifyErr, "update of service %q did not take effect", r.serviceName)
 }
 
 // updateAnnotations updates the annotations to keep some state about the rollout.
 func (r *Rollout) updateAnnotations(svc *run.Service, stable, candidate string) *run.Service {
+	now := r.time.Now().Format(time.RFC3339)
 	if r.shouldRollout {
-		now := r.time.Now().Format(time.RFC3339)
 		setAnnotation(svc, LastRolloutAnnotation, now)
 	}
 
@@ -197,6 +519,7 @@ func (r *Rollout) updateAnnotations(svc *run.Service, stable, candidate string)
 	setAnnotation(svc, CandidateRevisionAnnotation, candidate)
 	if r.shouldRollback {
 		setAnnotation(svc, LastFailedCandidateRevisionAnnotation, candidate)
+		setAnnotation(svc, LastFailedCandidateTimeAnnotation, now)
 	}
 
 	return svc
@@ -213,10 +536,22 @@ func setAnnotation(svc *run.Service, key, value string) {
 // setHealthReportAnnotation appends the current time to the report and sets
 // the health report annotation.
 func (r *Rollout) setHealthReportAnnotation(svc *run.Service, report string) {
+	r.healthReport = report
 	report += fmt.Sprintf("\nlastUpdate: %s", r.time.Now().Format(time.RFC3339))
 	setAnnotation(svc, LastHealthReportAnnotation, report)
 }
 
+// setDiagnosisAnnotation sets the diagnosis annotation to the structured
+// report of the diagnosis, in JSON.
+func (r *Rollout) setDiagnosisAnnotation(svc *run.Service, diagnosis health.Diagnosis) error {
+	data, err := json.Marshal(health.NewDiagnosisReport(r.strategy.HealthCriteria, diagnosis))
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal diagnosis report")
+	}
+	setAnnotation(svc, LastDiagnosisAnnotation, string(data))
+	return nil
+}
+
 // diagnoseCandidate returns the candidate's diagnosis based on metrics.
 func (r *Rollout) diagnoseCandidate(candidate string, healthCriteria []config.HealthCriterion) (d health.Diagnosis, err error) {
 	r.log.Debug("collecting metrics from API")
@@ -2,18 +2,23 @@ package rollout_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
 	metricsmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification"
+	notificationmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/notification/mock"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
 	runmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run/mock"
 	"github.com/jonboulle/clockwork"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/run/v1"
 )
 
@@ -70,6 +75,13 @@ func TestUpdateService(t *testing.T) {
 		traffic     []*run.TrafficTarget
 		annotations map[string]string
 		lastReady   string
+		queued      bool
+
+		// Traffic limit is only applied if a reason is given.
+		trafficLimit int64
+		limitReason  string
+
+		forcedRollback string
 
 		// See the metrics mock to know what would make the diagnosis the needed
 		// value for testing.
@@ -77,6 +89,7 @@ func TestUpdateService(t *testing.T) {
 		outAnnotations map[string]string
 		outTraffic     []*run.TrafficTarget
 		changedTraffic bool
+		outReason      rollout.ReasonCode
 		shouldErr      bool
 	}{
 		{
@@ -104,6 +117,156 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.NewCandidateReason,
+		},
+		{
+			name: "new candidate is queued",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			lastReady: "test-002",
+			queued:    true,
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastHealthReportAnnotation: "status: queued, too many rollouts in progress" +
+					"\nhint: the candidate gets traffic once other rollouts are done, or raise maxConcurrentRollouts" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			changedTraffic: false,
+			outReason:      rollout.QueuedReason,
+		},
+		{
+			name: "paused rollout keeps traffic",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			annotations: map[string]string{
+				rollout.PausedAnnotation: "paused manually",
+			},
+			lastReady: "test-002",
+			outAnnotations: map[string]string{
+				rollout.PausedAnnotation:            "paused manually",
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastHealthReportAnnotation: "status: paused, paused manually" +
+					"\nhint: run the resume action to resume the rollout" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			changedTraffic: false,
+			outReason:      rollout.PausedReason,
+		},
+		{
+			name: "new candidate waits for its dependencies",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			lastReady:    "test-002",
+			trafficLimit: 0,
+			limitReason:  "waiting for backend to be fully promoted",
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastHealthReportAnnotation: "status: waiting, waiting for backend to be fully promoted" +
+					"\nhint: the candidate gets traffic once the services it depends on or the previous regions are done" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			changedTraffic: false,
+			outReason:      rollout.TrafficLimitReason,
+		},
+		{
+			name: "healthy candidate capped by traffic limit",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100 - strategy.Steps[0], Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: strategy.Steps[0], Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			lastReady:    "test-002",
+			trafficLimit: 25,
+			limitReason:  "waiting for backend to be fully promoted",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:     `{"result":"healthy","checks":[{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, 0),
+				rollout.LastHealthReportAnnotation: "status: healthy\n" +
+					"metrics:" +
+					"\n- error-rate-percent: 1.00 (needs 5.00)" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 75, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 25, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			changedTraffic: true,
+			outReason:      rollout.AdvancedReason,
+		},
+		{
+			name: "healthy candidate at traffic limit, do not roll forward",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100 - strategy.Steps[0], Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: strategy.Steps[0], Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			lastReady:    "test-002",
+			trafficLimit: 5,
+			limitReason:  "waiting for backend to be fully promoted",
+			healthCriteria: []config.HealthCriterion{
+				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			},
+			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:     `{"result":"healthy","checks":[{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
+				rollout.StableRevisionAnnotation:    "test-001",
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, -30),
+				rollout.LastHealthReportAnnotation: "status: healthy\n" +
+					"metrics:" +
+					"\n- error-rate-percent: 1.00 (needs 5.00)" +
+					"\ntrafficLimit: 5%, waiting for backend to be fully promoted" +
+					"\nhint: the candidate rolls forward once the services it depends on or the previous regions are done" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			changedTraffic: false,
+			outReason:      rollout.TrafficLimitReason,
+		},
+		{
+			name: "forced rollback of candidate",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 20, Tag: rollout.CandidateTag},
+				{RevisionName: "test-001", Percent: 80, Tag: rollout.StableTag},
+			},
+			lastReady:      "test-002",
+			forcedRollback: "candidate failed in region us-east1",
+			outAnnotations: map[string]string{
+				rollout.StableRevisionAnnotation:              "test-001",
+				rollout.CandidateRevisionAnnotation:           "test-002",
+				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+				rollout.LastFailedCandidateTimeAnnotation:     clockMock.Now().Format(time.RFC3339),
+				rollout.LastHealthReportAnnotation: "status: rolled back, candidate failed in region us-east1" +
+					"\nhint: run the retry action to roll out test-002 again" +
+					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
+			},
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+			changedTraffic: true,
+			outReason:      rollout.ForcedRollbackReason,
 		},
 		{
 			name: "no stable revision",
@@ -113,6 +276,7 @@ func TestUpdateService(t *testing.T) {
 			},
 			lastReady:      "test-002",
 			changedTraffic: false,
+			outReason:      rollout.NoStableRevisionReason,
 		},
 		{
 			name: "same stable and latest revision",
@@ -121,6 +285,7 @@ func TestUpdateService(t *testing.T) {
 			},
 			lastReady:      "test-001",
 			changedTraffic: false,
+			outReason:      rollout.NoCandidateReason,
 		},
 		{
 			name: "new candidate and non-existing previous candidate",
@@ -142,6 +307,7 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.NewCandidateReason,
 		},
 		{
 			name: "keep rolling out the same candidate",
@@ -159,6 +325,7 @@ func TestUpdateService(t *testing.T) {
 				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
 			},
 			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:     `{"result":"healthy","checks":[{"metric":"request-latency","percentile":99,"threshold":750,"actualValue":500,"met":true},{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
 				rollout.StableRevisionAnnotation:    "test-001",
 				rollout.CandidateRevisionAnnotation: "test-002",
 				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, 0),
@@ -174,6 +341,7 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.AdvancedReason,
 		},
 		{
 			name: "healthy but not enough time has elapsed, do not roll forward",
@@ -191,6 +359,7 @@ func TestUpdateService(t *testing.T) {
 				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
 			},
 			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:     `{"result":"healthy","checks":[{"metric":"request-latency","percentile":99,"threshold":750,"actualValue":500,"met":true},{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
 				rollout.StableRevisionAnnotation:    "test-001",
 				rollout.CandidateRevisionAnnotation: "test-002",
 				rollout.LastRolloutAnnotation:       makeLastRolloutAnnotation(clockMock, 0),
@@ -201,6 +370,7 @@ func TestUpdateService(t *testing.T) {
 					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
 			},
 			changedTraffic: false,
+			outReason:      rollout.NotEnoughTimeReason,
 		},
 		{
 			name: "different candidate, restart rollout",
@@ -223,6 +393,7 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.NewCandidateReason,
 		},
 		{
 			name: "candidate is ready to become stable",
@@ -239,6 +410,7 @@ func TestUpdateService(t *testing.T) {
 				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
 			},
 			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:  `{"result":"healthy","checks":[{"metric":"request-latency","percentile":99,"threshold":750,"actualValue":500,"met":true},{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
 				rollout.StableRevisionAnnotation: "test-002",
 				rollout.LastRolloutAnnotation:    makeLastRolloutAnnotation(clockMock, 0),
 				rollout.LastHealthReportAnnotation: "status: healthy\n" +
@@ -252,6 +424,7 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.PromotedReason,
 		},
 		{
 			name: "unhealthy candidate, rollback",
@@ -265,13 +438,16 @@ func TestUpdateService(t *testing.T) {
 				{Metric: config.ErrorRateMetricsCheck, Threshold: 0.95},
 			},
 			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:               `{"result":"unhealthy","checks":[{"metric":"request-latency","percentile":99,"threshold":100,"actualValue":500,"met":false},{"metric":"error-rate-percent","threshold":0.95,"actualValue":1,"met":false}]}`,
 				rollout.StableRevisionAnnotation:              "test-001",
 				rollout.CandidateRevisionAnnotation:           "test-002",
 				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+				rollout.LastFailedCandidateTimeAnnotation:     clockMock.Now().Format(time.RFC3339),
 				rollout.LastHealthReportAnnotation: "status: unhealthy\n" +
 					"metrics:" +
 					"\n- request-latency[p99]: 500.00 (needs 100.00)" +
 					"\n- error-rate-percent: 1.00 (needs 0.95)" +
+					"\nhint: deploy a fixed revision, or run the retry action to roll out test-002 again" +
 					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
 			},
 			outTraffic: []*run.TrafficTarget{
@@ -280,6 +456,7 @@ func TestUpdateService(t *testing.T) {
 				{LatestRevision: true, Tag: rollout.LatestTag},
 			},
 			changedTraffic: true,
+			outReason:      rollout.UnhealthyReason,
 		},
 		{
 			name: "latest ready is a failed candidate",
@@ -295,6 +472,7 @@ func TestUpdateService(t *testing.T) {
 				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
 			},
 			changedTraffic: false,
+			outReason:      rollout.FailedCandidateReason,
 		},
 		{
 			name: "inconclusive diagnosis",
@@ -308,15 +486,18 @@ func TestUpdateService(t *testing.T) {
 				{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
 			},
 			outAnnotations: map[string]string{
+				rollout.LastDiagnosisAnnotation:     `{"result":"inconclusive","checks":[{"metric":"request-count","threshold":1500,"actualValue":1000,"met":false},{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`,
 				rollout.StableRevisionAnnotation:    "test-001",
 				rollout.CandidateRevisionAnnotation: "test-002",
 				rollout.LastHealthReportAnnotation: "status: inconclusive\n" +
 					"metrics:" +
 					"\n- request-count: 1000 (needs 1500)" +
 					"\n- error-rate-percent: 1.00 (needs 5.00)" +
+					"\nhint: wait for more traffic, or lower the threshold of the request count criterion" +
 					fmt.Sprintf("\nlastUpdate: %s", clockMock.Now().Format(time.RFC3339)),
 			},
 			changedTraffic: false,
+			outReason:      rollout.InconclusiveReason,
 		},
 		{
 			name: "unknown diagnosis",
@@ -349,17 +530,35 @@ func TestUpdateService(t *testing.T) {
 		strategy.HealthCriteria = test.healthCriteria
 		lg := logrus.New()
 		lg.SetLevel(logrus.DebugLevel)
-		r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithLogger(lg).WithClock(clockMock)
+		r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).WithClient(runclient).WithLogger(lg).WithClock(clockMock).WithQueued(test.queued)
+		if test.limitReason != "" {
+			r = r.WithTrafficLimit(test.trafficLimit, test.limitReason)
+		}
+		if test.forcedRollback != "" {
+			r = r.WithForcedRollback(test.forcedRollback)
+		}
 
 		t.Run(test.name, func(tt *testing.T) {
-			retSvc, changedTraffic, err := r.UpdateService(svc)
+			retSvc, reason, changedTraffic, err := r.UpdateService(svc)
 			if test.shouldErr {
 				assert.NotNil(tt, err)
 				return
 			}
 
 			assert.Equal(tt, test.changedTraffic, changedTraffic)
-			assert.Equal(tt, test.outAnnotations, retSvc.Metadata.Annotations)
+			assert.Equal(tt, test.outReason, reason.Code)
+			assert.NotEmpty(tt, reason.Message)
+
+			// The reason is recorded in the service, unless the service was
+			// left unchanged.
+			annotations := retSvc.Metadata.Annotations
+			if data, ok := annotations[rollout.LastReasonAnnotation]; ok {
+				var recorded rollout.Reason
+				assert.Nil(tt, json.Unmarshal([]byte(data), &recorded))
+				assert.Equal(tt, reason, recorded)
+				delete(annotations, rollout.LastReasonAnnotation)
+			}
+			assert.Equal(tt, test.outAnnotations, annotations)
 			if !test.changedTraffic {
 				assert.Equal(tt, svc.Spec.Traffic, retSvc.Spec.Traffic)
 			} else {
@@ -369,3 +568,308 @@ func TestUpdateService(t *testing.T) {
 
 	}
 }
+
+func TestRolloutConflictRetry(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsmock.Metrics{}
+	strategy := config.Strategy{
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	conflictErr := &googleapi.Error{Code: http.StatusConflict, Message: "resource version mismatch"}
+
+	var tests = []struct {
+		name       string
+		conflicts  int
+		shouldErr  bool
+		outTraffic []*run.TrafficTarget
+	}{
+		{
+			name:      "no conflict",
+			conflicts: 0,
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name:      "conflict resolved with latest version",
+			conflicts: 2,
+			outTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-003", Percent: 10, Tag: rollout.CandidateTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+		{
+			name:      "too many conflicts",
+			conflicts: 4,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			// The retrieved service has a new candidate that was deployed after
+			// the service was first listed.
+			svc := generateService(&ServiceOpts{
+				LatestReadyRevision: "test-002",
+				Traffic: []*run.TrafficTarget{
+					{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				},
+			})
+			svc.Metadata.ResourceVersion = "1"
+
+			var replaced []*run.Service
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = append(replaced, svc)
+				if len(replaced) <= test.conflicts {
+					return nil, conflictErr
+				}
+				return svc, nil
+			}
+			runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+				latest := generateService(&ServiceOpts{
+					LatestReadyRevision: "test-003",
+					Traffic: []*run.TrafficTarget{
+						{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+					},
+				})
+				latest.Metadata.ResourceVersion = "2"
+				return latest, nil
+			}
+
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithConflictRetries(3, 0)
+
+			changed, err := r.Rollout()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+				assert.Len(tt, replaced, 4)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.True(tt, changed)
+			assert.Equal(tt, test.conflicts > 0, runclient.ServiceInvoked)
+			assert.Len(tt, replaced, test.conflicts+1)
+			assert.Equal(tt, test.outTraffic, svcRecord.Spec.Traffic)
+		})
+	}
+}
+
+func TestRolloutPublishesEvents(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	metricsMock := &metricsmock.Metrics{}
+	metricsMock.SetCandidateRevisionFn = func(revisionName string) {}
+	metricsMock.RequestCountFn = func(ctx context.Context, offset time.Duration) (int64, error) {
+		return 500, nil
+	}
+	metricsMock.ErrorRateFn = func(ctx context.Context, offset time.Duration) (float64, error) {
+		return 0.01, nil
+	}
+	strategy := config.Strategy{
+		Name:                "backend",
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	stableOnly := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+	}
+	inProgress := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+
+	var tests = []struct {
+		name         string
+		traffic      []*run.TrafficTarget
+		annotations  map[string]string
+		queued       bool
+		minRequests  float64
+		maxErrorRate float64
+		replaceErr   error
+		publishErr   error
+		outEvents    []notification.EventType
+		outPercent   int
+		diagnosed    bool
+		shouldErr    bool
+	}{
+		{
+			name:         "new candidate",
+			traffic:      stableOnly,
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.CandidateDetectedEvent, notification.InitialTrafficEvent},
+			outPercent:   10,
+		},
+		{
+			name:         "new candidate queued",
+			traffic:      stableOnly,
+			queued:       true,
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.CandidateDetectedEvent, notification.PausedEvent},
+		},
+		{
+			name:    "new candidate still queued",
+			traffic: stableOnly,
+			annotations: map[string]string{
+				rollout.CandidateRevisionAnnotation: "test-002",
+				rollout.LastEventAnnotation:         "paused: too many rollouts in progress",
+			},
+			queued:       true,
+			maxErrorRate: 5,
+		},
+		{
+			name:    "step advanced",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.StepAdvancedEvent},
+			diagnosed:    true,
+			outPercent:   40,
+		},
+		{
+			name: "candidate promoted",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: rollout.CandidateTag},
+				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
+			},
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, -30),
+			},
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.PromotedEvent},
+			diagnosed:    true,
+			outPercent:   100,
+		},
+		{
+			name:         "candidate rolled back",
+			traffic:      inProgress,
+			maxErrorRate: 0.001,
+			outEvents:    []notification.EventType{notification.RolledBackEvent},
+			diagnosed:    true,
+		},
+		{
+			name:    "waiting for time between rollouts",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, 0),
+			},
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.WaitingEvent},
+			diagnosed:    true,
+			outPercent:   10,
+		},
+		{
+			name:    "still waiting for time between rollouts",
+			traffic: inProgress,
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation: makeLastRolloutAnnotation(clockMock, 0),
+				rollout.LastEventAnnotation:   "waiting: not enough time since last rollout",
+			},
+			maxErrorRate: 5,
+		},
+		{
+			name:         "not enough requests",
+			traffic:      inProgress,
+			minRequests:  1000,
+			maxErrorRate: 5,
+			outEvents:    []notification.EventType{notification.InconclusiveEvent},
+			diagnosed:    true,
+			outPercent:   10,
+		},
+		{
+			name:         "failed update",
+			traffic:      stableOnly,
+			maxErrorRate: 5,
+			replaceErr:   fmt.Errorf("permission denied"),
+			outEvents:    []notification.EventType{notification.ErrorEvent},
+			outPercent:   10,
+			shouldErr:    true,
+		},
+		{
+			name:         "publish error",
+			traffic:      stableOnly,
+			maxErrorRate: 5,
+			publishErr:   fmt.Errorf("topic not found"),
+			outEvents:    []notification.EventType{notification.CandidateDetectedEvent, notification.InitialTrafficEvent},
+			outPercent:   10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{
+				Annotations:         test.annotations,
+				LatestReadyRevision: "test-002",
+				Traffic:             test.traffic,
+			})
+			svc.Metadata.Name = "mysvc"
+			svc.Status.Url = "https://mysvc.a.run.app"
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				return svc, test.replaceErr
+			}
+
+			var events []notification.RolloutEvent
+			notifierMock := &notificationmock.Notifier{}
+			notifierMock.NotifyFn = func(ctx context.Context, e notification.RolloutEvent) error {
+				events = append(events, e)
+				return test.publishErr
+			}
+
+			strategy.HealthCriteria = []config.HealthCriterion{
+				{Metric: config.RequestCountMetricsCheck, Threshold: test.minRequests},
+				{Metric: config.ErrorRateMetricsCheck, Threshold: test.maxErrorRate},
+			}
+			svcRecord := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+			r := rollout.New(context.TODO(), metricsMock, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithQueued(test.queued).
+				WithNotifier(notifierMock)
+
+			_, err := r.Rollout()
+			if test.shouldErr {
+				assert.NotNil(tt, err)
+			} else {
+				assert.Nil(tt, err)
+			}
+
+			var eventTypes []notification.EventType
+			for _, e := range events {
+				eventTypes = append(eventTypes, e.Event)
+			}
+			assert.Equal(tt, test.outEvents, eventTypes)
+			if len(events) == 0 {
+				return
+			}
+
+			event := events[len(events)-1]
+			assert.Equal(tt, "myproject", event.Project)
+			assert.Equal(tt, "us-east1", event.Region)
+			assert.Equal(tt, "mysvc", event.ServiceName)
+			assert.Equal(tt, "backend", event.Strategy)
+			assert.Equal(tt, "test-001", event.StableRevisionName)
+			assert.Equal(tt, "test-002", event.CandidateRevisionName)
+			assert.Equal(tt, test.outPercent, event.CandidateRevisionPercent)
+			assert.Equal(tt, test.traffic, event.PreviousTraffic)
+			assert.Equal(tt, test.replaceErr != nil, event.Error != "")
+
+			if !test.diagnosed {
+				assert.Nil(tt, event.Diagnosis)
+				return
+			}
+			assert.NotNil(tt, event.Diagnosis)
+			assert.Len(tt, event.Diagnosis.Checks, 2)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package rollout
+
+import (
+	"google.golang.org/api/run/v1"
+)
+
+// State is the rollout state of a service.
+type State int
+
+// Possible rollout states.
+const (
+	// UnknownState means no stable revision could be detected.
+	UnknownState State = iota
+	// StableState means there is no candidate to roll out.
+	StableState
+	// NewCandidateState means a candidate exists but receives no traffic yet.
+	NewCandidateState
+	// InProgressState means the candidate is receiving some traffic.
+	InProgressState
+	// FailedState means the latest revision was a candidate that failed to
+	// meet the health criteria.
+	FailedState
+)
+
+func (s State) String() string {
+	switch s {
+	case StableState:
+		return "stable"
+	case NewCandidateState:
+		return "new candidate"
+	case InProgressState:
+		return "in progress"
+	case FailedState:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectState determines the rollout state of the service based on its
+// traffic configuration.
+func DetectState(svc *run.Service) State {
+	stable := DetectStableRevisionName(svc)
+	if stable == "" {
+		return UnknownState
+	}
+
+	candidate := DetectCandidateRevisionName(svc, stable)
+	if candidate == "" {
+		latest := svc.Status.LatestReadyRevisionName
+		if latest != "" && latest != stable && isFailedCandidate(svc, latest) {
+			return FailedState
+		}
+		return StableState
+	}
+	if isNewCandidate(svc, candidate) {
+		return NewCandidateState
+	}
+	return InProgressState
+}
@@ -0,0 +1,76 @@
+package rollout_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestDetectState(t *testing.T) {
+	var tests = []struct {
+		name        string
+		traffic     []*run.TrafficTarget
+		lastReady   string
+		annotations map[string]string
+		expected    rollout.State
+	}{
+		{
+			name: "no stable revision",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 50},
+				{RevisionName: "test-002", Percent: 50},
+			},
+			lastReady: "test-002",
+			expected:  rollout.UnknownState,
+		},
+		{
+			name: "latest revision is stable",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			lastReady: "test-001",
+			expected:  rollout.StableState,
+		},
+		{
+			name: "latest revision previously failed",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+			},
+			expected: rollout.FailedState,
+		},
+		{
+			name: "new candidate without traffic",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			lastReady: "test-002",
+			expected:  rollout.NewCandidateState,
+		},
+		{
+			name: "candidate receiving traffic",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 80, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 20, Tag: rollout.CandidateTag},
+			},
+			lastReady: "test-002",
+			expected:  rollout.InProgressState,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{
+				Annotations:         test.annotations,
+				LatestReadyRevision: test.lastReady,
+				Traffic:             test.traffic,
+			})
+			assert.Equal(tt, test.expected, rollout.DetectState(svc))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package rollout
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// Status describes the rollout of a service, as recorded in its traffic
+// configuration and annotations.
+type Status struct {
+	Project                     string                  `json:"project"`
+	Region                      string                  `json:"region"`
+	Service                     string                  `json:"service"`
+	Strategy                    string                  `json:"strategy"`
+	State                       string                  `json:"state"`
+	StableRevision              string                  `json:"stableRevision,omitempty"`
+	CandidateRevision           string                  `json:"candidateRevision,omitempty"`
+	CandidatePercent            int64                   `json:"candidatePercent"`
+	Traffic                     []TrafficStatus         `json:"traffic"`
+	NextStep                    *NextStep               `json:"nextStep,omitempty"`
+	Reason                      *Reason                 `json:"reason,omitempty"`
+	Paused                      string                  `json:"paused,omitempty"`
+	LastRollout                 string                  `json:"lastRollout,omitempty"`
+	LastFailedCandidateRevision string                  `json:"lastFailedCandidateRevision,omitempty"`
+	LastDiagnosis               *health.DiagnosisReport `json:"lastDiagnosis,omitempty"`
+	LastHealthReport            string                  `json:"lastHealthReport,omitempty"`
+	LastEvent                   string                  `json:"lastEvent,omitempty"`
+	LastFailedUpdate            string                  `json:"lastFailedUpdate,omitempty"`
+	Errors                      []string                `json:"errors,omitempty"`
+}
+
+// TrafficStatus is the share of traffic served by a revision.
+type TrafficStatus struct {
+	Revision       string `json:"revision,omitempty"`
+	LatestRevision bool   `json:"latestRevision,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	Percent        int64  `json:"percent"`
+}
+
+// NextStep is the traffic the candidate gets next if it is healthy.
+//
+// The step is eligible once enough time has elapsed since the last rollout,
+// and it is taken by the first pass after that, subject to the candidate's
+// health and the concurrency and dependency constraints.
+type NextStep struct {
+	Percent    int64      `json:"percent"`
+	Promotion  bool       `json:"promotion"`
+	EligibleAt *time.Time `json:"eligibleAt,omitempty"`
+	EligibleIn string     `json:"eligibleIn,omitempty"`
+}
+
+// NewStatus returns the rollout status of the service at the given time.
+//
+// Annotations that cannot be parsed are reported in the errors of the status
+// rather than failing.
+func NewStatus(svc *ServiceRecord, strategy config.Strategy, now time.Time) Status {
+	annotations := svc.Metadata.Annotations
+	status := Status{
+		Project:                     svc.Project,
+		Region:                      svc.Region,
+		Service:                     svc.Metadata.Name,
+		Strategy:                    strategy.DisplayName(),
+		State:                       DetectState(svc.Service).String(),
+		LastRollout:                 annotations[LastRolloutAnnotation],
+		LastFailedCandidateRevision: annotations[LastFailedCandidateRevisionAnnotation],
+		LastHealthReport:            annotations[LastHealthReportAnnotation],
+		LastEvent:                   annotations[LastEventAnnotation],
+		LastFailedUpdate:            annotations[LastFailedUpdateAnnotation],
+		Paused:                      annotations[PausedAnnotation],
+	}
+
+	traffic := servedTraffic(svc.Service)
+	for _, target := range traffic {
+		status.Traffic = append(status.Traffic, TrafficStatus{
+			Revision:       target.RevisionName,
+			LatestRevision: target.LatestRevision,
+			Tag:            target.Tag,
+			Percent:        target.Percent,
+		})
+	}
+
+	if data := annotations[LastDiagnosisAnnotation]; data != "" {
+		var diagnosis health.DiagnosisReport
+		if err := json.Unmarshal([]byte(data), &diagnosis); err != nil {
+			status.Errors = append(status.Errors, errors.Wrap(err, "failed to parse last diagnosis").Error())
+		} else {
+			status.LastDiagnosis = &diagnosis
+		}
+	}
+
+	// A service without candidate is not updated, so the reason is determined
+	// from its current state rather than from the last recorded one.
+	status.StableRevision = DetectStableRevisionName(svc.Service)
+	if status.StableRevision != "" {
+		status.CandidateRevision = DetectCandidateRevisionName(svc.Service, status.StableRevision)
+	}
+	if status.CandidateRevision == "" {
+		reason := noCandidateReason(svc.Service, status.StableRevision)
+		status.Reason = &reason
+		return status
+	}
+	if data := annotations[LastReasonAnnotation]; data != "" {
+		var reason Reason
+		if err := json.Unmarshal([]byte(data), &reason); err != nil {
+			status.Errors = append(status.Errors, errors.Wrap(err, "failed to parse last reason").Error())
+		} else {
+			status.Reason = &reason
+		}
+	}
+	for _, target := range traffic {
+		if target.RevisionName == status.CandidateRevision {
+			status.CandidatePercent += target.Percent
+		}
+	}
+
+	// A new candidate gets the first step in the next pass.
+	if isNewCandidate(svc.Service, status.CandidateRevision) {
+		status.NextStep = &NextStep{Percent: strategy.Steps[0], EligibleAt: &now, EligibleIn: "0s"}
+		return status
+	}
+
+	next := nextStep(strategy.Steps, status.CandidatePercent)
+	status.NextStep = &NextStep{Percent: next, Promotion: next == status.CandidatePercent}
+	lastRollout, err := time.Parse(time.RFC3339, status.LastRollout)
+	if err != nil {
+		status.Errors = append(status.Errors, errors.Wrap(err, "failed to parse last roll out time").Error())
+		return status
+	}
+	eligibleAt := lastRollout.Add(strategy.TimeBetweenRollouts)
+	eligibleIn := eligibleAt.Sub(now)
+	if eligibleIn < 0 {
+		eligibleIn = 0
+	}
+	status.NextStep.EligibleAt = &eligibleAt
+	status.NextStep.EligibleIn = eligibleIn.Round(time.Second).String()
+	return status
+}
+
+// servedTraffic returns the traffic configuration being served, falling back
+// to the desired one if the service has no status yet.
+func servedTraffic(svc *run.Service) []*run.TrafficTarget {
+	if svc.Status != nil && len(svc.Status.Traffic) != 0 {
+		return svc.Status.Traffic
+	}
+	if svc.Spec == nil {
+		return nil
+	}
+	return svc.Spec.Traffic
+}
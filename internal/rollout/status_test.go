@@ -0,0 +1,196 @@
+package rollout_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestNewStatus(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	now := clockMock.Now()
+	strategy := config.Strategy{
+		Name:                "gradual",
+		Steps:               []int64{10, 40, 70},
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	inFive := now.Add(5 * time.Minute)
+	tenAgo := now.Add(-10 * time.Minute)
+	diagnosis := `{"result":"healthy","checks":[{"metric":"error-rate-percent","threshold":5,"actualValue":1,"met":true}]}`
+
+	var tests = []struct {
+		name        string
+		traffic     []*run.TrafficTarget
+		lastReady   string
+		annotations map[string]string
+		expected    rollout.Status
+	}{
+		{
+			name: "stable",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			lastReady: "test-001",
+			expected: rollout.Status{
+				State:          "stable",
+				StableRevision: "test-001",
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-001", Percent: 100, Tag: rollout.StableTag},
+				},
+				Reason: &rollout.Reason{
+					Code:    rollout.NoCandidateReason,
+					Message: "the latest ready revision test-001 is the stable revision",
+					Hint:    "deploy new revisions with --no-traffic so they are rolled out gradually",
+				},
+			},
+		},
+		{
+			name: "failed candidate",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+			},
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.LastFailedCandidateRevisionAnnotation: "test-002",
+				rollout.LastReasonAnnotation:                  `{"code":"unhealthy","message":"candidate test-002 did not meet the health criteria"}`,
+			},
+			expected: rollout.Status{
+				State:          "failed",
+				StableRevision: "test-001",
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-001", Percent: 100, Tag: rollout.StableTag},
+					{Revision: "test-002", Percent: 0, Tag: rollout.CandidateTag},
+				},
+				LastFailedCandidateRevision: "test-002",
+				Reason: &rollout.Reason{
+					Code:    rollout.FailedCandidateReason,
+					Message: "candidate test-002 previously failed",
+					Hint:    "deploy a new revision, or run the retry action (which clears the rollout.cloud.run/lastFailedCandidateRevision annotation) to roll out test-002 again",
+				},
+			},
+		},
+		{
+			name: "new candidate",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+			},
+			lastReady: "test-002",
+			expected: rollout.Status{
+				State:             "new candidate",
+				StableRevision:    "test-001",
+				CandidateRevision: "test-002",
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-001", Percent: 100, Tag: rollout.StableTag},
+				},
+				NextStep: &rollout.NextStep{Percent: 10, EligibleAt: &now, EligibleIn: "0s"},
+			},
+		},
+		{
+			name: "waiting for next step",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 60, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+			},
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.LastRolloutAnnotation:   makeLastRolloutAnnotation(clockMock, -5),
+				rollout.LastDiagnosisAnnotation: diagnosis,
+				rollout.LastReasonAnnotation:    `{"code":"advanced","message":"candidate test-002 is healthy and got more traffic"}`,
+			},
+			expected: rollout.Status{
+				State:             "in progress",
+				StableRevision:    "test-001",
+				CandidateRevision: "test-002",
+				CandidatePercent:  40,
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-001", Percent: 60, Tag: rollout.StableTag},
+					{Revision: "test-002", Percent: 40, Tag: rollout.CandidateTag},
+				},
+				NextStep:    &rollout.NextStep{Percent: 70, EligibleAt: &inFive, EligibleIn: "5m0s"},
+				Reason:      &rollout.Reason{Code: rollout.AdvancedReason, Message: "candidate test-002 is healthy and got more traffic"},
+				LastRollout: makeLastRolloutAnnotation(clockMock, -5),
+				LastDiagnosis: &health.DiagnosisReport{
+					Result: "healthy",
+					Checks: []health.CheckReport{
+						{Metric: config.ErrorRateMetricsCheck, Threshold: 5, ActualValue: 1, Met: true},
+					},
+				},
+			},
+		},
+		{
+			name: "ready to be promoted",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-002", Percent: 100, Tag: rollout.CandidateTag},
+				{RevisionName: "test-001", Percent: 0, Tag: rollout.StableTag},
+			},
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.StableRevisionAnnotation: "test-001",
+				rollout.LastRolloutAnnotation:    makeLastRolloutAnnotation(clockMock, -20),
+			},
+			expected: rollout.Status{
+				State:             "in progress",
+				StableRevision:    "test-001",
+				CandidateRevision: "test-002",
+				CandidatePercent:  100,
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-002", Percent: 100, Tag: rollout.CandidateTag},
+					{Revision: "test-001", Percent: 0, Tag: rollout.StableTag},
+				},
+				NextStep:    &rollout.NextStep{Percent: 100, Promotion: true, EligibleAt: &tenAgo, EligibleIn: "0s"},
+				LastRollout: makeLastRolloutAnnotation(clockMock, -20),
+			},
+		},
+		{
+			name: "invalid annotations",
+			traffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+				{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+			},
+			lastReady: "test-002",
+			annotations: map[string]string{
+				rollout.LastDiagnosisAnnotation: "{",
+				rollout.LastReasonAnnotation:    "{",
+			},
+			expected: rollout.Status{
+				State:             "in progress",
+				StableRevision:    "test-001",
+				CandidateRevision: "test-002",
+				CandidatePercent:  10,
+				Traffic: []rollout.TrafficStatus{
+					{Revision: "test-001", Percent: 90, Tag: rollout.StableTag},
+					{Revision: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+				},
+				NextStep: &rollout.NextStep{Percent: 40},
+				Errors: []string{
+					"failed to parse last diagnosis: unexpected end of JSON input",
+					"failed to parse last reason: unexpected end of JSON input",
+					`failed to parse last roll out time: parsing time "" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "2006"`,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			svc := generateService(&ServiceOpts{
+				Annotations:         test.annotations,
+				LatestReadyRevision: test.lastReady,
+				Traffic:             test.traffic,
+			})
+			svc.Metadata.Name = "mysvc"
+			record := &rollout.ServiceRecord{Service: svc, Project: "myproject", Region: "us-east1"}
+
+			expected := test.expected
+			expected.Project, expected.Region, expected.Service, expected.Strategy = "myproject", "us-east1", "mysvc", "gradual"
+			assert.Equal(tt, expected, rollout.NewStatus(record, strategy, now))
+		})
+	}
+}
@@ -27,6 +27,11 @@ func (r *Rollout) determineTraffic(svc *run.Service, diagnosis health.DiagnosisR
 			r.log.WithField("lastRollout", lastRollout).Debug("no enough time elapsed since last roll out")
 			return svc.Spec.Traffic, false, nil
 		}
+		if r.reachedTrafficLimit(svc.Spec.Traffic, candidate) {
+			r.log.WithField("trafficLimit", r.trafficLimit).Info("candidate reached its traffic limit, not rolling forward")
+			r.heldByTrafficLimit = true
+			return svc.Spec.Traffic, false, nil
+		}
 		r.log.Info("rolling forward")
 		r.shouldRollout = true
 		return r.rollForwardTraffic(svc.Spec.Traffic, stable, candidate), true, nil
@@ -102,6 +107,9 @@ func (r *Rollout) newCandidateTraffic(traffic []*run.TrafficTarget, candidate st
 			promoteToStable = true
 		}
 	}
+	if candidatePercent > r.trafficLimit {
+		candidatePercent = r.trafficLimit
+	}
 
 	candidateTarget = newTrafficTarget(candidate, candidatePercent, CandidateTag)
 	return candidateTarget, promoteToStable
@@ -144,9 +152,29 @@ func (r *Rollout) currentCandidateTraffic(traffic []*run.TrafficTarget, candidat
 	return nil
 }
 
+// reachedTrafficLimit determines if the candidate already gets the maximum
+// traffic it is allowed to get before being promoted.
+func (r *Rollout) reachedTrafficLimit(traffic []*run.TrafficTarget, candidate string) bool {
+	if r.trafficLimit >= 100 {
+		return false
+	}
+
+	var current int64
+	if target := r.currentCandidateTraffic(traffic, candidate); target != nil {
+		current = target.Percent
+	}
+	return current >= r.trafficLimit
+}
+
 // nextCandidateTraffic calculates the next traffic share for the candidate.
 func (r *Rollout) nextCandidateTraffic(current int64) int64 {
-	for _, step := range r.strategy.Steps {
+	return nextStep(r.strategy.Steps, current)
+}
+
+// nextStep returns the first step above the current traffic share, or 100 if
+// there is none.
+func nextStep(steps []int64, current int64) int64 {
+	for _, step := range steps {
 		if step > current {
 			return step
 		}
@@ -0,0 +1,141 @@
+package rollout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/run/v1"
+)
+
+// Condition types of a Cloud Run service.
+const (
+	readyCondition       = "Ready"
+	routesReadyCondition = "RoutesReady"
+)
+
+// verifyUpdate polls the service until the update with the given generation is
+// observed and the traffic configuration in the status matches the one in the
+// spec.
+//
+// It returns an error if the routes failed to become ready or the update was
+// not observed before the verification timeout.
+func (r *Rollout) verifyUpdate(generation int64) error {
+	deadline := r.time.Now().Add(r.verifyTimeout)
+	lg := r.log.WithField("generation", generation)
+	for {
+		svc, err := r.runClient.Service(r.project, r.serviceName)
+		if err != nil {
+			return errors.Wrap(err, "failed to retrieve service to verify the update")
+		}
+
+		if svc.Status.ObservedGeneration >= generation {
+			cond := routesCondition(svc)
+			if cond != nil && cond.Status == "False" {
+				return errors.Errorf("traffic was not updated, %s=False: %s", cond.Type, cond.Message)
+			}
+			if cond != nil && cond.Status == "True" && trafficMatches(svc.Spec.Traffic, svc.Status.Traffic) {
+				lg.Debug("traffic update observed in service status")
+				return nil
+			}
+		}
+
+		if !r.time.Now().Before(deadline) {
+			return errors.Errorf("traffic update was not observed after %s", r.verifyTimeout)
+		}
+		lg.Debug("traffic update not observed yet, waiting")
+		r.time.Sleep(r.verifyInterval)
+	}
+}
+
+// recordFailedUpdate replaces the service to reflect that the last update did
+// not take effect.
+//
+// The annotations are restored to their values before the update and the
+// traffic in the spec is set to the traffic actually being served, so the next
+// rollout does not assume the failed update was applied.
+func (r *Rollout) recordFailedUpdate(previousAnnotations map[string]string, updateErr error) error {
+	svc, err := r.runClient.Service(r.project, r.serviceName)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve service to record failed update")
+	}
+
+	if len(svc.Status.Traffic) != 0 {
+		var traffic []*run.TrafficTarget
+		for _, target := range svc.Status.Traffic {
+			// The status resolves the revision of the latest target, but the
+			// spec cannot set a revision name along with the latest revision.
+			revisionName := target.RevisionName
+			if target.LatestRevision {
+				revisionName = ""
+			}
+			traffic = append(traffic, &run.TrafficTarget{
+				RevisionName:   revisionName,
+				LatestRevision: target.LatestRevision,
+				Percent:        target.Percent,
+				Tag:            target.Tag,
+			})
+		}
+		svc.Spec.Traffic = traffic
+	}
+
+	annotations := make(map[string]string)
+	for key, value := range svc.Metadata.Annotations {
+		annotations[key] = value
+	}
+	for _, key := range []string{StableRevisionAnnotation, CandidateRevisionAnnotation, LastFailedCandidateRevisionAnnotation, LastFailedCandidateTimeAnnotation, LastRolloutAnnotation, LastEventAnnotation, PausedAnnotation} {
+		if value, ok := previousAnnotations[key]; ok {
+			annotations[key] = value
+		} else {
+			delete(annotations, key)
+		}
+	}
+	annotations[LastFailedUpdateAnnotation] = fmt.Sprintf("%s: %v", r.time.Now().Format(time.RFC3339), updateErr)
+	svc.Metadata.Annotations = annotations
+
+	r.log.WithError(updateErr).Warn("update did not take effect, restoring previous rollout state")
+	_, err = r.runClient.ReplaceService(r.project, r.serviceName, svc)
+	return errors.Wrap(err, "failed to restore previous rollout state")
+}
+
+// routesCondition returns the condition that reflects whether the traffic
+// configuration is being served. It falls back to the Ready condition if the
+// RoutesReady condition is not available.
+func routesCondition(svc *run.Service) *run.GoogleCloudRunV1Condition {
+	var ready *run.GoogleCloudRunV1Condition
+	for _, cond := range svc.Status.Conditions {
+		switch cond.Type {
+		case routesReadyCondition:
+			return cond
+		case readyCondition:
+			ready = cond
+		}
+	}
+	return ready
+}
+
+// trafficMatches determines if the status traffic configuration serves the
+// same percentages to each revision as the spec.
+func trafficMatches(spec, status []*run.TrafficTarget) bool {
+	percents := func(traffic []*run.TrafficTarget) map[string]int64 {
+		m := make(map[string]int64)
+		for _, target := range traffic {
+			if target.Percent == 0 {
+				continue
+			}
+			m[target.RevisionName] += target.Percent
+		}
+		return m
+	}
+
+	specPercents, statusPercents := percents(spec), percents(status)
+	if len(specPercents) != len(statusPercents) {
+		return false
+	}
+	for name, percent := range specPercents {
+		if statusPercents[name] != percent {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package rollout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	metricsmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics/mock"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	runmock "github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/run/mock"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/run/v1"
+)
+
+func TestUpdateVerification(t *testing.T) {
+	strategy := config.Strategy{
+		Steps:               []int64{10, 40, 70},
+		HealthCheckOffset:   5 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+	}
+	servedTraffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+	}
+	// The status resolves the revision of the latest target, which must not be
+	// restored in the spec.
+	servedTrafficWithLatest := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		{RevisionName: "test-002", LatestRevision: true, Tag: rollout.LatestTag},
+	}
+	newTraffic := []*run.TrafficTarget{
+		{RevisionName: "test-001", Percent: 90, Tag: rollout.StableTag},
+		{RevisionName: "test-002", Percent: 10, Tag: rollout.CandidateTag},
+	}
+
+	var tests = []struct {
+		name string
+
+		// statuses are the consecutive statuses returned while polling. The
+		// last one is returned once all the others were returned.
+		statuses  []*run.ServiceStatus
+		shouldErr bool
+
+		// outRestoredTraffic is the traffic in the spec of the service
+		// restored after a failed update.
+		outRestoredTraffic []*run.TrafficTarget
+	}{
+		{
+			name: "update observed after polling",
+			statuses: []*run.ServiceStatus{
+				{ObservedGeneration: 1, Traffic: servedTraffic},
+				{
+					ObservedGeneration: 2,
+					Traffic:            newTraffic,
+					Conditions: []*run.GoogleCloudRunV1Condition{
+						{Type: "Ready", Status: "True"},
+						{Type: "RoutesReady", Status: "True"},
+					},
+				},
+			},
+		},
+		{
+			name: "routes failed to become ready",
+			statuses: []*run.ServiceStatus{
+				{
+					ObservedGeneration: 2,
+					Traffic:            servedTraffic,
+					Conditions: []*run.GoogleCloudRunV1Condition{
+						{Type: "RoutesReady", Status: "False", Message: "revision not found"},
+					},
+				},
+			},
+			shouldErr:          true,
+			outRestoredTraffic: servedTraffic,
+		},
+		{
+			name: "update not observed before timeout",
+			statuses: []*run.ServiceStatus{
+				{ObservedGeneration: 1, Traffic: servedTraffic},
+			},
+			shouldErr:          true,
+			outRestoredTraffic: servedTraffic,
+		},
+		{
+			name: "latest target restored without revision name",
+			statuses: []*run.ServiceStatus{
+				{ObservedGeneration: 1, Traffic: servedTrafficWithLatest},
+			},
+			shouldErr: true,
+			outRestoredTraffic: []*run.TrafficTarget{
+				{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+				{LatestRevision: true, Tag: rollout.LatestTag},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			clockMock := clockwork.NewFakeClock()
+			previousRollout := makeLastRolloutAnnotation(clockMock, -60)
+			svc := generateService(&ServiceOpts{
+				LatestReadyRevision: "test-002",
+				Annotations: map[string]string{
+					rollout.StableRevisionAnnotation: "test-001",
+					rollout.LastRolloutAnnotation:    previousRollout,
+				},
+				Traffic: servedTraffic,
+			})
+
+			var replaced []*run.Service
+			runclient := &runmock.RunAPI{}
+			runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+				replaced = append(replaced, svc)
+				updated := *svc
+				updated.Metadata = &run.ObjectMeta{Generation: 2, Annotations: svc.Metadata.Annotations}
+				return &updated, nil
+			}
+			polls := 0
+			runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+				status := test.statuses[len(test.statuses)-1]
+				if polls < len(test.statuses) {
+					status = test.statuses[polls]
+				}
+				polls++
+				clockMock.Advance(10 * time.Second)
+
+				latest := *replaced[0]
+				latest.Status = status
+				return &latest, nil
+			}
+
+			svcRecord := &rollout.ServiceRecord{Service: svc}
+			r := rollout.New(context.TODO(), &metricsmock.Metrics{}, svcRecord, strategy).
+				WithClient(runclient).
+				WithClock(clockMock).
+				WithUpdateVerification(time.Minute, 0)
+
+			_, err := r.Rollout()
+			if !test.shouldErr {
+				assert.Nil(tt, err)
+				assert.Len(tt, replaced, 1)
+				return
+			}
+
+			// The failure is recorded and the previous rollout state restored.
+			assert.NotNil(tt, err)
+			assert.Len(tt, replaced, 2)
+			restored := replaced[1]
+			assert.Equal(tt, previousRollout, restored.Metadata.Annotations[rollout.LastRolloutAnnotation])
+			assert.Equal(tt, "test-001", restored.Metadata.Annotations[rollout.StableRevisionAnnotation])
+			assert.NotContains(tt, restored.Metadata.Annotations, rollout.CandidateRevisionAnnotation)
+			assert.Contains(tt, restored.Metadata.Annotations, rollout.LastFailedUpdateAnnotation)
+			assert.Equal(tt, test.outRestoredTraffic, restored.Spec.Traffic)
+		})
+	}
+}
+
+func TestUpdateVerificationUnchangedTraffic(t *testing.T) {
+	clockMock := clockwork.NewFakeClock()
+	svc := generateService(&ServiceOpts{
+		LatestReadyRevision: "test-002",
+		Annotations: map[string]string{
+			rollout.StableRevisionAnnotation: "test-001",
+			rollout.PausedAnnotation:         "paused manually",
+		},
+		Traffic: []*run.TrafficTarget{
+			{RevisionName: "test-001", Percent: 100, Tag: rollout.StableTag},
+		},
+	})
+
+	runclient := &runmock.RunAPI{}
+	runclient.ReplaceServiceFn = func(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+		return svc, nil
+	}
+	runclient.ServiceFn = func(namespace, serviceID string) (*run.Service, error) {
+		return nil, errors.New("unexpected verification")
+	}
+
+	svcRecord := &rollout.ServiceRecord{Service: svc}
+	r := rollout.New(context.TODO(), &metricsmock.Metrics{}, svcRecord, config.Strategy{Steps: []int64{10}}).
+		WithClient(runclient).
+		WithClock(clockMock).
+		WithUpdateVerification(time.Minute, 0)
+
+	changed, err := r.Rollout()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.True(t, runclient.ReplaceServiceInvoked)
+	assert.False(t, runclient.ServiceInvoked)
+}
@@ -3,9 +3,13 @@ package run
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
 	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/util"
 	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/run/v1"
 )
@@ -22,6 +26,10 @@ type API struct {
 	Region string
 }
 
+// UserAgent is sent with the requests to the Cloud Run API, so the updates
+// made by the Release Manager can be told apart in the audit logs.
+const UserAgent = "cloud-run-release-manager"
+
 // regions are the available regions.
 //
 // TODO: caching regions might be unnecessary if we are querying them once during
@@ -31,7 +39,7 @@ var regions = []string{}
 // NewAPIClient initializes an instance of APIService.
 func NewAPIClient(ctx context.Context, region string) (*API, error) {
 	regionalEndpoint := fmt.Sprintf("https://%s-run.googleapis.com/", region)
-	client, err := run.NewService(ctx, option.WithEndpoint(regionalEndpoint))
+	client, err := run.NewService(ctx, option.WithEndpoint(regionalEndpoint), option.WithUserAgent(UserAgent))
 	if err != nil {
 		return nil, errors.Wrap(err, "could not initialize client for the Cloud Run API")
 	}
@@ -45,20 +53,42 @@ func NewAPIClient(ctx context.Context, region string) (*API, error) {
 // Service retrieves information about a service.
 func (a *API) Service(namespace, serviceID string) (*run.Service, error) {
 	serviceName := serviceName(namespace, serviceID)
-	return a.Client.Namespaces.Services.Get(serviceName).Do()
+	start := time.Now()
+	svc, err := a.Client.Namespaces.Services.Get(serviceName).Do()
+	selfmetrics.ObserveAPICall(selfmetrics.RunAPI, "GetService", start, err)
+	return svc, err
 }
 
 // ReplaceService replaces an existing service.
 func (a *API) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
 	serviceName := serviceName(namespace, serviceID)
-	return a.Client.Namespaces.Services.ReplaceService(serviceName, svc).Do()
+	start := time.Now()
+	svc, err := a.Client.Namespaces.Services.ReplaceService(serviceName, svc).Do()
+	selfmetrics.ObserveAPICall(selfmetrics.RunAPI, "ReplaceService", start, err)
+	return svc, err
+}
+
+// IsConflict determines if the error is caused by a concurrent modification of
+// the resource, i.e. the resource version sent in the request is outdated.
+func IsConflict(err error) bool {
+	apiErr, ok := errors.Cause(err).(*googleapi.Error)
+	return ok && apiErr.Code == http.StatusConflict
+}
+
+// IsNotFound determines if the error is caused by a resource that does not
+// exist.
+func IsNotFound(err error) bool {
+	apiErr, ok := errors.Cause(err).(*googleapi.Error)
+	return ok && apiErr.Code == http.StatusNotFound
 }
 
 // ServicesWithLabelSelector gets services filtered by a label selector.
 func (a *API) ServicesWithLabelSelector(namespace string, labelSelector string) ([]*run.Service, error) {
 	parent := fmt.Sprintf("namespaces/%s", namespace)
 
+	start := time.Now()
 	servicesList, err := a.Client.Namespaces.Services.List(parent).LabelSelector(labelSelector).Do()
+	selfmetrics.ObserveAPICall(selfmetrics.RunAPI, "ListServices", start, err)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to filter services by label selector")
 	}
@@ -80,7 +110,9 @@ func Regions(ctx context.Context, project string) ([]string, error) {
 	}
 
 	name := fmt.Sprintf("projects/%s", project)
+	start := time.Now()
 	resp, err := client.Projects.Locations.List(name).Do()
+	selfmetrics.ObserveAPICall(selfmetrics.RunAPI, "ListLocations", start, err)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get locations")
 	}
@@ -0,0 +1,91 @@
+package selfmetrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+)
+
+// APIs whose calls are measured.
+const (
+	RunAPI        = "run"
+	MonitoringAPI = "monitoring"
+)
+
+// latencyBuckets are the buckets of API call durations, in seconds.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// passBuckets are the buckets of pass durations, in seconds.
+var passBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics of the Release Manager.
+var (
+	Passes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_passes_total",
+		Help: "Rollout passes over all the targeted services, by result (success, partial or failure).",
+	}, []string{"result"})
+	PassDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "release_manager_pass_duration_seconds",
+		Help:    "Duration of the rollout passes over all the targeted services.",
+		Buckets: passBuckets,
+	})
+	LastPass = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "release_manager_last_pass_timestamp_seconds",
+		Help: "Unix time at which the last rollout pass over all the targeted services completed.",
+	})
+	ServicesEvaluated = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_services_evaluated_total",
+		Help: "Services whose rollout was handled, by strategy.",
+	}, []string{"strategy"})
+	Decisions = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_decisions_total",
+		Help: "Actions taken on the services, by strategy and action.",
+	}, []string{"strategy", "action"})
+	Rollbacks = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_rollbacks_total",
+		Help: "Candidates rolled back, by strategy.",
+	}, []string{"strategy"})
+	RolloutErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_rollout_errors_total",
+		Help: "Rollouts of a service that failed, by strategy.",
+	}, []string{"strategy"})
+	Conflicts = factory.NewCounter(prometheus.CounterOpts{
+		Name: "release_manager_conflicts_total",
+		Help: "Service updates rejected because the service was modified concurrently.",
+	})
+	APIRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_manager_api_requests_total",
+		Help: "Calls to Google Cloud APIs, by API, method and response code.",
+	}, []string{"api", "method", "code"})
+	APIRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "release_manager_api_request_duration_seconds",
+		Help:    "Duration of the calls to Google Cloud APIs, by API and method.",
+		Buckets: latencyBuckets,
+	}, []string{"api", "method"})
+	CandidatePercent = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "release_manager_candidate_percent",
+		Help: "Percent of the traffic served by the candidate of each service.",
+	}, []string{"project", "region", "service"})
+)
+
+// ObserveAPICall records a call to an API that started at the given time and
+// failed with the error, if not nil.
+func ObserveAPICall(api, method string, start time.Time, err error) {
+	APIRequestDuration.WithLabelValues(api, method).Observe(time.Since(start).Seconds())
+	APIRequests.WithLabelValues(api, method, responseCode(err)).Inc()
+}
+
+// responseCode returns the HTTP status code of the error, OK if there was no
+// error, or "error" if the request did not get a response.
+func responseCode(err error) string {
+	if err == nil {
+		return "OK"
+	}
+	if apiErr, ok := errors.Cause(err).(*googleapi.Error); ok {
+		return strconv.Itoa(apiErr.Code)
+	}
+	return "error"
+}
@@ -0,0 +1,22 @@
+// Package selfmetrics records metrics about the Release Manager itself and
+// exposes them in the Prometheus text format.
+package selfmetrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry is the registry of the Release Manager's own metrics.
+var Registry = prometheus.NewRegistry()
+
+// factory registers the metrics in the registry.
+var factory = promauto.With(Registry)
+
+// Handler returns a handler that serves the metrics of the registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
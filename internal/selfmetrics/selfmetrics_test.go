@@ -0,0 +1,52 @@
+package selfmetrics_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/selfmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestHandler(t *testing.T) {
+	selfmetrics.CandidatePercent.WithLabelValues("myproject", "us-east1", `my"svc\`).Set(50)
+
+	rec := httptest.NewRecorder()
+	selfmetrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "# TYPE release_manager_candidate_percent gauge\n")
+	assert.Contains(t, rec.Body.String(), `release_manager_candidate_percent{project="myproject",region="us-east1",service="my\"svc\\"} 50`+"\n")
+}
+
+func TestObserveAPICall(t *testing.T) {
+	var tests = []struct {
+		name    string
+		err     error
+		outCode string
+	}{
+		{name: "success", outCode: "OK"},
+		{name: "API error", err: &googleapi.Error{Code: http.StatusConflict}, outCode: "409"},
+		{name: "no response", err: fmt.Errorf("connection reset"), outCode: "error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			method := "Method" + test.outCode
+			requests := selfmetrics.APIRequests.WithLabelValues(selfmetrics.RunAPI, method, test.outCode)
+			before := testutil.ToFloat64(requests)
+			selfmetrics.ObserveAPICall(selfmetrics.RunAPI, method, time.Now(), test.err)
+			assert.Equal(tt, before+1, testutil.ToFloat64(requests))
+			var duration dto.Metric
+			assert.Nil(tt, selfmetrics.APIRequestDuration.WithLabelValues(selfmetrics.RunAPI, method).(prometheus.Histogram).Write(&duration))
+			assert.Equal(tt, uint64(1), duration.GetHistogram().GetSampleCount())
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package simulation
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+)
+
+// Formats of the recorded metrics.
+const (
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+)
+
+// Sample is the metrics of a service during the interval that ends at its
+// time. Latencies are in milliseconds.
+type Sample struct {
+	Time         time.Time `json:"time"`
+	RequestCount int64     `json:"requestCount"`
+	ErrorCount   int64     `json:"errorCount"`
+	LatencyP50   float64   `json:"latencyP50,omitempty"`
+	LatencyP95   float64   `json:"latencyP95,omitempty"`
+	LatencyP99   float64   `json:"latencyP99,omitempty"`
+}
+
+// csvColumns are the columns of the CSV format, which must have a header.
+var csvColumns = []string{"time", "requestCount", "errorCount", "latencyP50", "latencyP95", "latencyP99"}
+
+// ReadSamples reads the samples in the format, either a CSV file with a header
+// or a JSON array.
+func ReadSamples(r io.Reader, format string) ([]Sample, error) {
+	switch format {
+	case CSVFormat:
+		return readCSV(r)
+	case JSONFormat:
+		var samples []Sample
+		if err := json.NewDecoder(r).Decode(&samples); err != nil {
+			return nil, errors.Wrap(err, "failed to decode samples")
+		}
+		return samples, nil
+	default:
+		return nil, errors.Errorf("unknown format %q, must be %s or %s", format, CSVFormat, JSONFormat)
+	}
+}
+
+// readCSV reads the samples of a CSV file. The columns are identified by the
+// header, and only the time and request count are required.
+func readCSV(r io.Reader) ([]Sample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		if !isCSVColumn(name) {
+			return nil, errors.Errorf("unknown column %q, must be one of %v", name, csvColumns)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"time", "requestCount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, errors.Errorf("missing column %q", name)
+		}
+	}
+
+	var samples []Sample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read line %d", line)
+		}
+		sample, err := parseCSVRecord(record, columns)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sample on line %d", line)
+		}
+		samples = append(samples, sample)
+	}
+}
+
+// parseCSVRecord parses the values of a sample. Empty values are zero.
+func parseCSVRecord(record []string, columns map[string]int) (Sample, error) {
+	var sample Sample
+	var err error
+	sample.Time, err = time.Parse(time.RFC3339, record[columns["time"]])
+	if err != nil {
+		return sample, errors.Wrap(err, "invalid time")
+	}
+	for name, i := range columns {
+		value := record[i]
+		if name == "time" || value == "" {
+			continue
+		}
+		switch name {
+		case "requestCount":
+			sample.RequestCount, err = strconv.ParseInt(value, 10, 64)
+		case "errorCount":
+			sample.ErrorCount, err = strconv.ParseInt(value, 10, 64)
+		case "latencyP50":
+			sample.LatencyP50, err = strconv.ParseFloat(value, 64)
+		case "latencyP95":
+			sample.LatencyP95, err = strconv.ParseFloat(value, 64)
+		case "latencyP99":
+			sample.LatencyP99, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return sample, errors.Wrapf(err, "invalid %s", name)
+		}
+	}
+	return sample, nil
+}
+
+// isCSVColumn determines if the name is a column of the CSV format.
+func isCSVColumn(name string) bool {
+	for _, column := range csvColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Series is a metrics provider for recorded samples. The metrics are those of
+// the samples in the interval that ends at the time of its clock.
+type Series struct {
+	samples []Sample
+	clock   clockwork.Clock
+}
+
+// NewSeries returns a series of the samples, sorted by time.
+func NewSeries(samples []Sample) *Series {
+	sorted := append([]Sample{}, samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	return &Series{samples: sorted, clock: clockwork.NewRealClock()}
+}
+
+// WithClock updates the clock that gives the end of the intervals the metrics
+// are provided for.
+func (s *Series) WithClock(clock clockwork.Clock) *Series {
+	s.clock = clock
+	return s
+}
+
+// Start returns the time of the first sample.
+func (s *Series) Start() time.Time {
+	if len(s.samples) == 0 {
+		return time.Time{}
+	}
+	return s.samples[0].Time
+}
+
+// End returns the time of the last sample.
+func (s *Series) End() time.Time {
+	if len(s.samples) == 0 {
+		return time.Time{}
+	}
+	return s.samples[len(s.samples)-1].Time
+}
+
+// SetCandidateRevision does nothing, since the samples are not specific to a
+// revision.
+func (s *Series) SetCandidateRevision(revisionName string) {}
+
+// RequestCount returns the number of requests of the samples in the offset.
+func (s *Series) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	var count int64
+	for _, sample := range s.window(offset) {
+		count += sample.RequestCount
+	}
+	return count, nil
+}
+
+// Latency returns the mean of the latency percentile of the samples in the
+// offset, weighted by their number of requests.
+// It returns 0 if no request was made during the interval.
+func (s *Series) Latency(ctx context.Context, offset time.Duration, alignReduceType metrics.AlignReduce) (float64, error) {
+	percentile := func(sample Sample) float64 { return sample.LatencyP99 }
+	switch alignReduceType {
+	case metrics.Align99Reduce99:
+	case metrics.Align95Reduce95:
+		percentile = func(sample Sample) float64 { return sample.LatencyP95 }
+	case metrics.Align50Reduce50:
+		percentile = func(sample Sample) float64 { return sample.LatencyP50 }
+	default:
+		return 0, errors.Errorf("unsupported latency aligner and reducer %d", alignReduceType)
+	}
+
+	var sum float64
+	var requests int64
+	for _, sample := range s.window(offset) {
+		sum += percentile(sample) * float64(sample.RequestCount)
+		requests += sample.RequestCount
+	}
+	if requests == 0 {
+		return 0, nil
+	}
+	return sum / float64(requests), nil
+}
+
+// ErrorRate returns the rate of errors of the samples in the offset.
+// It returns 0 if no request was made during the interval.
+func (s *Series) ErrorRate(ctx context.Context, offset time.Duration) (float64, error) {
+	var errs, requests int64
+	for _, sample := range s.window(offset) {
+		errs += sample.ErrorCount
+		requests += sample.RequestCount
+	}
+	if requests == 0 {
+		return 0, nil
+	}
+	return float64(errs) / float64(requests), nil
+}
+
+// window returns the samples whose interval ends in the offset before the
+// current time.
+func (s *Series) window(offset time.Duration) []Sample {
+	end := s.clock.Now()
+	start := end.Add(-offset)
+	var samples []Sample
+	for _, sample := range s.samples {
+		if sample.Time.After(start) && !sample.Time.After(end) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
@@ -0,0 +1,200 @@
+// Package simulation replays a rollout strategy against recorded metrics, to
+// tune its steps and health criteria before using it on real services.
+package simulation
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/health"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/run/v1"
+)
+
+// Revision names of the simulated service.
+const (
+	StableRevision    = "simulated-stable"
+	CandidateRevision = "simulated-candidate"
+)
+
+// Decision is the decision made by a simulated rollout pass.
+type Decision struct {
+	Time             time.Time               `json:"time"`
+	Outcome          rollout.Outcome         `json:"action"`
+	CandidatePercent int64                   `json:"candidatePercent"`
+	Diagnosis        *health.DiagnosisReport `json:"diagnosis,omitempty"`
+	Reason           *rollout.Reason         `json:"reason,omitempty"`
+}
+
+// Simulation replays the rollout of a candidate.
+//
+// The metrics are those of the service as a whole: the candidate is assumed to
+// behave like the service did, and to get its share of the requests.
+type Simulation struct {
+	strategy config.Strategy
+	provider metrics.Provider
+	clock    clockwork.FakeClock
+	interval time.Duration
+	logger   *logrus.Logger
+}
+
+// New returns a simulation of the strategy. The provider must get its metrics
+// at the time of the clock, which the simulation advances.
+func New(strategy config.Strategy, provider metrics.Provider, clock clockwork.FakeClock) *Simulation {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	return &Simulation{
+		strategy: strategy,
+		provider: provider,
+		clock:    clock,
+		interval: time.Minute,
+		logger:   logger,
+	}
+}
+
+// WithInterval updates the time between rollout passes.
+func (s *Simulation) WithInterval(interval time.Duration) *Simulation {
+	s.interval = interval
+	return s
+}
+
+// WithLogger updates the logger the rollout passes log to.
+func (s *Simulation) WithLogger(logger *logrus.Logger) *Simulation {
+	s.logger = logger
+	return s
+}
+
+// Run runs a rollout pass at every interval, from the time of the clock until
+// the end, or until the candidate is promoted or rolled back. It returns the
+// decision of every pass.
+func (s *Simulation) Run(ctx context.Context, end time.Time) ([]Decision, error) {
+	if s.interval <= 0 {
+		return nil, errors.Errorf("interval must be positive, got %s", s.interval)
+	}
+	svc := newService()
+	client := &serviceClient{service: svc}
+	provider := &candidateProvider{Provider: s.provider}
+
+	var decisions []Decision
+	for ; !s.clock.Now().After(end); s.clock.Advance(s.interval) {
+		provider.percent = candidatePercent(svc)
+		svcRecord := &rollout.ServiceRecord{Service: svc}
+		r := rollout.New(ctx, provider, svcRecord, s.strategy).
+			WithClient(client).
+			WithLogger(s.logger).
+			WithClock(s.clock)
+		if _, _, _, err := r.UpdateService(svc); err != nil {
+			return decisions, errors.Wrapf(err, "failed to simulate rollout pass at %s", s.clock.Now().Format(time.RFC3339))
+		}
+
+		result := r.Result()
+		decisions = append(decisions, Decision{
+			Time:             s.clock.Now(),
+			Outcome:          result.Outcome,
+			CandidatePercent: result.NewCandidatePercent,
+			Diagnosis:        result.Diagnosis,
+			Reason:           result.Reason,
+		})
+		if result.Outcome == rollout.PromotedOutcome || result.Outcome == rollout.RolledBackOutcome {
+			break
+		}
+	}
+	return decisions, nil
+}
+
+// Timeline returns the decisions that changed the traffic of the candidate or
+// were made for a different reason than the previous one, so consecutive
+// passes waiting for the same reason are listed once.
+func Timeline(decisions []Decision) []Decision {
+	var timeline []Decision
+	for i, decision := range decisions {
+		if i == 0 {
+			timeline = append(timeline, decision)
+			continue
+		}
+		previous := decisions[i-1]
+		if decision.CandidatePercent != previous.CandidatePercent ||
+			decision.Outcome != previous.Outcome ||
+			reasonCode(decision.Reason) != reasonCode(previous.Reason) {
+			timeline = append(timeline, decision)
+		}
+	}
+	return timeline
+}
+
+// reasonCode returns the code of the reason, or an empty code if there is no
+// reason.
+func reasonCode(reason *rollout.Reason) rollout.ReasonCode {
+	if reason == nil {
+		return ""
+	}
+	return reason.Code
+}
+
+// newService returns the simulated service, whose stable revision serves all
+// the traffic and whose candidate is the latest ready revision.
+func newService() *run.Service {
+	traffic := []*run.TrafficTarget{
+		{RevisionName: StableRevision, Percent: 100, Tag: rollout.StableTag},
+	}
+	return &run.Service{
+		Metadata: &run.ObjectMeta{Name: "simulation", Annotations: map[string]string{}},
+		Spec:     &run.ServiceSpec{Traffic: traffic},
+		Status: &run.ServiceStatus{
+			Traffic:                 traffic,
+			LatestReadyRevisionName: CandidateRevision,
+		},
+	}
+}
+
+// candidatePercent returns the share of traffic served by the candidate.
+func candidatePercent(svc *run.Service) int64 {
+	var percent int64
+	for _, target := range svc.Status.Traffic {
+		if target.RevisionName == CandidateRevision {
+			percent += target.Percent
+		}
+	}
+	return percent
+}
+
+// serviceClient is a Cloud Run client for the simulated service, which serves
+// a new traffic configuration as soon as the service is updated.
+type serviceClient struct {
+	service *run.Service
+}
+
+func (c *serviceClient) Service(namespace, serviceID string) (*run.Service, error) {
+	return c.service, nil
+}
+
+func (c *serviceClient) ReplaceService(namespace, serviceID string, svc *run.Service) (*run.Service, error) {
+	svc.Status.Traffic = svc.Spec.Traffic
+	c.service = svc
+	return svc, nil
+}
+
+// candidateProvider provides the metrics of the candidate from the metrics of
+// the whole service, by scaling the number of requests to the candidate's
+// share of traffic.
+type candidateProvider struct {
+	metrics.Provider
+	percent int64
+}
+
+// SetCandidateRevision does nothing, since the metrics are not filtered by
+// revision.
+func (p *candidateProvider) SetCandidateRevision(revisionName string) {}
+
+// RequestCount returns the candidate's share of the requests.
+func (p *candidateProvider) RequestCount(ctx context.Context, offset time.Duration) (int64, error) {
+	count, err := p.Provider.RequestCount(ctx, offset)
+	return count * p.percent / 100, err
+}
@@ -0,0 +1,218 @@
+package simulation_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/metrics"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/rollout"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/simulation"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+)
+
+// timelineEntry is the time, in minutes since the start, and the outcome of a
+// decision.
+type timelineEntry struct {
+	minute  int
+	outcome rollout.Outcome
+	percent int64
+	reason  rollout.ReasonCode
+}
+
+func TestSimulation(t *testing.T) {
+	start := time.Date(2020, 8, 13, 10, 0, 0, 0, time.UTC)
+	strategy := config.Strategy{
+		Steps:               []int64{10, 50},
+		HealthCheckOffset:   10 * time.Minute,
+		TimeBetweenRollouts: 10 * time.Minute,
+		HealthCriteria: []config.HealthCriterion{
+			{Metric: config.RequestCountMetricsCheck, Threshold: 100},
+			{Metric: config.ErrorRateMetricsCheck, Threshold: 5},
+			{Metric: config.LatencyMetricsCheck, Percentile: 99, Threshold: 500},
+		},
+	}
+
+	var tests = []struct {
+		name        string
+		sample      func(minute int) simulation.Sample
+		outTimeline []timelineEntry
+	}{
+		{
+			name: "healthy candidate is promoted",
+			sample: func(minute int) simulation.Sample {
+				return simulation.Sample{RequestCount: 1000, ErrorCount: 1, LatencyP99: 200}
+			},
+			outTimeline: []timelineEntry{
+				{0, rollout.InitialOutcome, 10, rollout.NewCandidateReason},
+				{1, rollout.WaitingOutcome, 10, rollout.NotEnoughTimeReason},
+				{10, rollout.AdvancedOutcome, 50, rollout.AdvancedReason},
+				{11, rollout.WaitingOutcome, 50, rollout.NotEnoughTimeReason},
+				{20, rollout.AdvancedOutcome, 100, rollout.AdvancedReason},
+				{21, rollout.WaitingOutcome, 100, rollout.NotEnoughTimeReason},
+				{30, rollout.PromotedOutcome, 100, rollout.PromotedReason},
+			},
+		},
+		{
+			name: "errors roll back the candidate",
+			sample: func(minute int) simulation.Sample {
+				sample := simulation.Sample{RequestCount: 1000, ErrorCount: 1, LatencyP99: 200}
+				if minute >= 15 {
+					sample.ErrorCount = 200
+				}
+				return sample
+			},
+			outTimeline: []timelineEntry{
+				{0, rollout.InitialOutcome, 10, rollout.NewCandidateReason},
+				{1, rollout.WaitingOutcome, 10, rollout.NotEnoughTimeReason},
+				{10, rollout.AdvancedOutcome, 50, rollout.AdvancedReason},
+				{11, rollout.WaitingOutcome, 50, rollout.NotEnoughTimeReason},
+				{17, rollout.RolledBackOutcome, 0, rollout.UnhealthyReason},
+			},
+		},
+		{
+			name: "not enough requests",
+			sample: func(minute int) simulation.Sample {
+				return simulation.Sample{RequestCount: 50, LatencyP99: 200}
+			},
+			outTimeline: []timelineEntry{
+				{0, rollout.InitialOutcome, 10, rollout.NewCandidateReason},
+				{1, rollout.InconclusiveOutcome, 10, rollout.InconclusiveReason},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			var samples []simulation.Sample
+			for minute := 0; minute <= 60; minute++ {
+				sample := test.sample(minute)
+				sample.Time = start.Add(time.Duration(minute) * time.Minute)
+				samples = append(samples, sample)
+			}
+			clock := clockwork.NewFakeClockAt(start)
+			series := simulation.NewSeries(samples).WithClock(clock)
+
+			decisions, err := simulation.New(strategy, series, clock).Run(context.Background(), series.End())
+			assert.Nil(tt, err)
+			var timeline []timelineEntry
+			for _, decision := range simulation.Timeline(decisions) {
+				timeline = append(timeline, timelineEntry{
+					minute:  int(decision.Time.Sub(start) / time.Minute),
+					outcome: decision.Outcome,
+					percent: decision.CandidatePercent,
+					reason:  decision.Reason.Code,
+				})
+			}
+			assert.Equal(tt, test.outTimeline, timeline)
+		})
+	}
+}
+
+func TestSeries(t *testing.T) {
+	start := time.Date(2020, 8, 13, 10, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(start.Add(10 * time.Minute))
+	series := simulation.NewSeries([]simulation.Sample{
+		{Time: start.Add(10 * time.Minute), RequestCount: 300, ErrorCount: 3, LatencyP50: 20, LatencyP99: 400},
+		{Time: start, RequestCount: 1000, ErrorCount: 100, LatencyP99: 2000},
+		{Time: start.Add(5 * time.Minute), RequestCount: 100, ErrorCount: 1, LatencyP50: 40, LatencyP99: 800},
+		{Time: start.Add(11 * time.Minute), RequestCount: 1000, ErrorCount: 100, LatencyP99: 2000},
+	}).WithClock(clock)
+	assert.Equal(t, start, series.Start())
+	assert.Equal(t, start.Add(11*time.Minute), series.End())
+
+	// The first sample ends at the start of the interval and the last one
+	// after its end.
+	ctx := context.Background()
+	count, err := series.RequestCount(ctx, 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(400), count)
+	errorRate, err := series.ErrorRate(ctx, 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.01, errorRate)
+	latency, err := series.Latency(ctx, 10*time.Minute, metrics.Align99Reduce99)
+	assert.Nil(t, err)
+	assert.Equal(t, 500.0, latency)
+	latency, err = series.Latency(ctx, 10*time.Minute, metrics.Align50Reduce50)
+	assert.Nil(t, err)
+	assert.Equal(t, 25.0, latency)
+
+	// No request was made in the interval.
+	clock.Advance(time.Hour)
+	errorRate, err = series.ErrorRate(ctx, 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, errorRate)
+	latency, err = series.Latency(ctx, 10*time.Minute, metrics.Align95Reduce95)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, latency)
+}
+
+func TestReadSamples(t *testing.T) {
+	start := time.Date(2020, 8, 13, 10, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name       string
+		format     string
+		data       string
+		outSamples []simulation.Sample
+		outErr     string
+	}{
+		{
+			name:   "csv",
+			format: simulation.CSVFormat,
+			data: "time,requestCount,errorCount,latencyP99\n" +
+				"2020-08-13T10:00:00Z,1000,2,350.5\n" +
+				"2020-08-13T10:01:00Z,900,,\n",
+			outSamples: []simulation.Sample{
+				{Time: start, RequestCount: 1000, ErrorCount: 2, LatencyP99: 350.5},
+				{Time: start.Add(time.Minute), RequestCount: 900},
+			},
+		},
+		{
+			name:   "json",
+			format: simulation.JSONFormat,
+			data:   `[{"time": "2020-08-13T10:00:00Z", "requestCount": 1000, "errorCount": 2, "latencyP95": 120}]`,
+			outSamples: []simulation.Sample{
+				{Time: start, RequestCount: 1000, ErrorCount: 2, LatencyP95: 120},
+			},
+		},
+		{
+			name:   "unknown column",
+			format: simulation.CSVFormat,
+			data:   "time,requestCount,latency\n",
+			outErr: `unknown column "latency"`,
+		},
+		{
+			name:   "missing column",
+			format: simulation.CSVFormat,
+			data:   "time,errorCount\n",
+			outErr: `missing column "requestCount"`,
+		},
+		{
+			name:   "invalid value",
+			format: simulation.CSVFormat,
+			data:   "time,requestCount\n2020-08-13T10:00:00Z,1000\n2020-08-13T10:01:00Z,many\n",
+			outErr: "invalid sample on line 3: invalid requestCount",
+		},
+		{
+			name:   "unknown format",
+			format: "xml",
+			outErr: `unknown format "xml"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			samples, err := simulation.ReadSamples(strings.NewReader(test.data), test.format)
+			if test.outErr != "" {
+				assert.NotNil(tt, err)
+				assert.Contains(tt, err.Error(), test.outErr)
+				return
+			}
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.outSamples, samples)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package tracing records OpenTelemetry spans of the work done during a
+// rollout pass.
+//
+// Spans are recorded by the global tracer provider, which Setup configures.
+// Until it is called, spans are not recorded.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the instrumentation that records the
+// spans.
+const instrumentationName = "github.com/GoogleCloudPlatform/cloud-run-release-manager"
+
+// defaultServiceName is the service.name of the spans if the configuration
+// does not specify one.
+const defaultServiceName = "cloud-run-release-manager"
+
+// NewExporter initializes the exporter of spans in the configuration.
+//
+// The otlp exporter sends the spans to the /v1/traces path of the endpoint.
+func NewExporter(ctx context.Context, cfg config.Tracing) (sdktrace.SpanExporter, error) {
+	if cfg.Exporter == config.StdoutTracingExporter {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid endpoint")
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(endpoint.Path, "/") + "/v1/traces"),
+	}
+	if endpoint.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// Setup sets the global tracer provider to one that exports the spans with
+// the exporter on behalf of the service, and the global propagator to the W3C
+// trace context. The returned provider must be shut down to export the
+// remaining spans.
+func Setup(exporter sdktrace.SpanExporter, serviceName string) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider
+}
+
+// Start starts a span as a child of the span in the context, if any, and
+// returns a context holding the new span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marks the span as failed with the error, if not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Middleware returns a handler that calls the next handler with the trace
+// context of the request, so that its spans join the trace of the caller,
+// e.g. Cloud Scheduler or Eventarc.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
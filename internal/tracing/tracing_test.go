@@ -0,0 +1,95 @@
+package tracing_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/config"
+	"github.com/GoogleCloudPlatform/cloud-run-release-manager/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStart(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Setup(exporter, "")
+
+	ctx, root := tracing.Start(context.Background(), "runRollouts")
+	childCtx, child := tracing.Start(ctx, "handleRollout", attribute.String("service", "hello"))
+	_, grandchild := tracing.Start(childCtx, "replaceService")
+	tracing.RecordError(grandchild, fmt.Errorf("conflict"))
+	grandchild.End()
+	child.SetAttributes(attribute.String("decision", "advanced"))
+	tracing.RecordError(child, nil)
+	// A span that ends after the root span is still exported.
+	root.End()
+	child.End()
+	assert.Nil(t, provider.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	rootCtx := byName["runRollouts"].SpanContext
+	for _, span := range spans {
+		assert.Equal(t, rootCtx.TraceID(), span.SpanContext.TraceID())
+		assert.Contains(t, span.Resource.Attributes(), semconv.ServiceNameKey.String("cloud-run-release-manager"))
+	}
+	assert.False(t, byName["runRollouts"].Parent.IsValid())
+	assert.Equal(t, rootCtx.SpanID(), byName["handleRollout"].Parent.SpanID())
+	assert.Equal(t, byName["handleRollout"].SpanContext.SpanID(), byName["replaceService"].Parent.SpanID())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("service", "hello"), attribute.String("decision", "advanced")}, byName["handleRollout"].Attributes)
+	assert.Equal(t, codes.Unset, byName["handleRollout"].Status.Code)
+	assert.Equal(t, codes.Error, byName["replaceService"].Status.Code)
+	assert.Equal(t, "conflict", byName["replaceService"].Status.Description)
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Setup(exporter, "release-manager")
+
+	var spanCtx trace.SpanContext
+	handler := tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, span := tracing.Start(req.Context(), "runRollouts")
+		spanCtx = span.SpanContext()
+		span.End()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/rollout", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, provider.ForceFlush(context.Background()))
+
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spanCtx.TraceID().String())
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "b7ad6b7169203331", spans[0].Parent.SpanID().String())
+	assert.True(t, spans[0].Parent.IsRemote())
+}
+
+func TestNewExporter(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	exporter, err := tracing.NewExporter(context.Background(), config.Tracing{
+		Exporter: config.OTLPTracingExporter,
+		Endpoint: server.URL + "/",
+	})
+	assert.Nil(t, err)
+	provider := tracing.Setup(exporter, "release-manager")
+	_, span := tracing.Start(context.Background(), "runRollouts")
+	span.End()
+	assert.Nil(t, provider.Shutdown(context.Background()))
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+}